@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Moneda de los importes cuando no se indica otra (código ISO 4217)
+const monedaPorDefecto = "ARS"
+
+// Dinero es un importe en centavos. Evita los errores de redondeo de float64:
+// en la base se guarda como NUMERIC(10,2) y en JSON viaja como número con dos decimales.
+type Dinero int64
+
+// Convierte "1234", "1234.5" o "-1234.50" a Dinero. Acepta un signo al principio y
+// solo dígitos en la parte entera y decimal; más de dos decimales se redondean
+// (NUMERIC puede traerlos, ej. resultado de una división).
+func parseDinero(s string) (Dinero, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("importe vacío")
+	}
+	invalido := fmt.Errorf("importe inválido: %s", s)
+
+	numero := s
+	negativo := false
+	if numero[0] == '-' || numero[0] == '+' {
+		negativo = numero[0] == '-'
+		numero = numero[1:]
+	}
+	entero, decimales, _ := strings.Cut(numero, ".")
+	if entero == "" && decimales == "" {
+		return 0, invalido
+	}
+	for _, r := range entero + decimales {
+		if r < '0' || r > '9' {
+			return 0, invalido
+		}
+	}
+
+	// d = d*mult + v, controlando el desborde de int64
+	var d Dinero
+	fueraDeRango := false
+	acumular := func(mult, v Dinero) {
+		if d > (math.MaxInt64-v)/mult {
+			fueraDeRango = true
+		}
+		d = d*mult + v
+	}
+	for _, r := range entero {
+		acumular(10, Dinero(r-'0')*100)
+	}
+	for i, r := range decimales {
+		switch {
+		case i == 0:
+			acumular(1, Dinero(r-'0')*10)
+		case i == 1:
+			acumular(1, Dinero(r-'0'))
+		case i == 2 && r >= '5':
+			acumular(1, 1)
+		}
+	}
+	if fueraDeRango {
+		return 0, fmt.Errorf("importe fuera de rango: %s", s)
+	}
+	if negativo {
+		d = -d
+	}
+	return d, nil
+}
+
+// Importe en pesos enteros
+func pesos(n int) Dinero {
+	return Dinero(n * 100)
+}
+
+func (d Dinero) String() string {
+	signo := ""
+	if d < 0 {
+		signo = "-"
+		d = -d
+	}
+	return fmt.Sprintf("%s%d.%02d", signo, d/100, d%100)
+}
+
+// Importe con formato es-AR para documentos: "$ 1.234,50"
+func (d Dinero) Formato() string {
+	signo := ""
+	if d < 0 {
+		signo = "-"
+		d = -d
+	}
+	enteros := fmt.Sprintf("%d", d/100)
+	for i := len(enteros) - 3; i > 0; i -= 3 {
+		enteros = enteros[:i] + "." + enteros[i:]
+	}
+	return fmt.Sprintf("%s$ %s,%02d", signo, enteros, d%100)
+}
+
+// Aplica un porcentaje (ej. 15 = 15%) redondeando al centavo
+func (d Dinero) Porcentaje(p float64) Dinero {
+	return Dinero(math.Round(float64(d) * p / 100))
+}
+
+func (d Dinero) Float64() float64 {
+	return float64(d) / 100
+}
+
+func (d Dinero) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Acepta número (10000 / 10000.5) o string ("10000.50")
+func (d *Dinero) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		*d = 0
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := parseDinero(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Scan lee columnas NUMERIC
+func (d *Dinero) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = 0
+		return nil
+	case []byte:
+		p, err := parseDinero(string(v))
+		*d = p
+		return err
+	case string:
+		p, err := parseDinero(v)
+		*d = p
+		return err
+	case int64:
+		*d = Dinero(v * 100)
+		return nil
+	case float64:
+		*d = Dinero(math.Round(v * 100))
+		return nil
+	}
+	return fmt.Errorf("no se puede leer %T como Dinero", src)
+}
+
+// Value escribe el importe como texto decimal para NUMERIC
+func (d Dinero) Value() (driver.Value, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestParseDinero(t *testing.T) {
+	casos := []struct {
+		s    string
+		want Dinero
+		ok   bool
+	}{
+		{"1234", 123400, true},
+		{"1234.5", 123450, true},
+		{"-1234.50", -123450, true},
+		{"+7.05", 705, true},
+		{" 10 ", 1000, true},
+		{".5", 50, true},
+		{"5.", 500, true},
+		{"0.125", 13, true}, // NUMERIC con más decimales: se redondea
+		{"0.124", 12, true},
+		{"-0.999", -100, true},
+		{"92233720368547758.07", 9223372036854775807, true},
+		{"92233720368547758.08", 0, false}, // desborda int64 al redondear
+		{"922337203685477580", 0, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{"+", 0, false},
+		{".", 0, false},
+		{"1.-5", 0, false},
+		{"1.+5", 0, false},
+		{"--5", 0, false},
+		{"+-5", 0, false},
+		{"1,50", 0, false},
+		{"1.5.0", 0, false},
+		{"1e3", 0, false},
+		{"abc", 0, false},
+	}
+	for _, c := range casos {
+		got, err := parseDinero(c.s)
+		if (err == nil) != c.ok {
+			t.Errorf("parseDinero(%q): error = %v, se esperaba ok = %v", c.s, err, c.ok)
+			continue
+		}
+		if c.ok && got != c.want {
+			t.Errorf("parseDinero(%q) = %d, se esperaba %d", c.s, got, c.want)
+		}
+	}
+}
+
+func TestPorcentaje(t *testing.T) {
+	casos := []struct {
+		d    Dinero
+		p    float64
+		want Dinero
+	}{
+		{pesos(1000), 10, pesos(100)},
+		{pesos(1000), 0, 0},
+		{pesos(1000), 100, pesos(1000)},
+		{999, 50, 500}, // 4,995 -> 5,00
+		{333, 33.3, 111},
+		{-pesos(100), 21, -pesos(21)},
+		{1, 21, 0},
+	}
+	for _, c := range casos {
+		if got := c.d.Porcentaje(c.p); got != c.want {
+			t.Errorf("%s.Porcentaje(%v) = %s, se esperaba %s", c.d, c.p, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facturación electrónica. La implementación se elige con FACTURADOR:
+// "arca" (web service WSFEv1, homologación salvo ARCA_PRODUCCION=1) o "fake" (por defecto, para desarrollo y pruebas).
+
+// Códigos de ARCA
+const (
+	facturaA = 1
+	facturaB = 6
+	facturaC = 11
+
+	docCUIT           = 80
+	docDNI            = 96
+	docSinIdentificar = 99 // consumidor final sin documento
+)
+
+// Condiciones frente al IVA y su código de receptor (RG 5616)
+var condicionesIVA = map[string]int{
+	"responsable_inscripto": 1,
+	"exento":                4,
+	"consumidor_final":      5,
+	"monotributo":           6,
+}
+
+// Comprobante a autorizar
+type SolicitudFactura struct {
+	PuntoVenta           int
+	TipoComprobante      int
+	Numero               int
+	Fecha                time.Time
+	DocTipo              int
+	DocNro               string
+	CondicionIVAReceptor int
+	Neto                 Dinero
+	IVA                  Dinero // 0 en Factura C
+	Total                Dinero
+}
+
+type ResultadoFactura struct {
+	CAE            string
+	CAEVencimiento time.Time
+}
+
+// Error definitivo: ARCA rechazó el comprobante y reintentar no sirve sin corregir datos
+type RechazoFactura struct {
+	Motivo string
+}
+
+func (r *RechazoFactura) Error() string { return "comprobante rechazado: " + r.Motivo }
+
+type Facturador interface {
+	Nombre() string
+	UltimoAutorizado(puntoVenta, tipoComprobante int) (int, error)
+	Autorizar(s SolicitudFactura) (ResultadoFactura, error)
+	// Comprobante ya autorizado con ese número (nil si ARCA no lo tiene)
+	Consultar(puntoVenta, tipoComprobante, numero int) (*ResultadoFactura, error)
+}
+
+var facturador Facturador
+
+func nuevoFacturador() Facturador {
+	switch env("FACTURADOR", "fake") {
+	case "arca":
+		url := arcaHomologacion
+		if os.Getenv("ARCA_PRODUCCION") == "1" {
+			url = arcaProduccion
+		}
+		return &arca{
+			url:   url,
+			cuit:  os.Getenv("ARCA_CUIT"),
+			token: os.Getenv("ARCA_TOKEN"),
+			sign:  os.Getenv("ARCA_SIGN"),
+		}
+	default:
+		log.Println("Facturador: fake (solo desarrollo)")
+		return &facturadorFake{ultimos: map[string]int{}, autorizados: map[string]ResultadoFactura{}, fallar: os.Getenv("FACTURADOR_FAKE_ERROR") == "1"}
+	}
+}
+
+// Valida la condición frente al IVA y el CUIT (obligatorio salvo consumidor final)
+func validarDatosFiscales(condicion, cuit *string) error {
+	if *condicion == "" {
+		*condicion = "consumidor_final"
+	}
+	if _, ok := condicionesIVA[*condicion]; !ok {
+		return fmt.Errorf("condicion_iva inválida: %s", *condicion)
+	}
+
+	*cuit = strings.NewReplacer("-", "", " ", "", ".", "").Replace(*cuit)
+	if *cuit == "" {
+		if *condicion != "consumidor_final" {
+			return errors.New("cuit es requerido para la condición " + *condicion)
+		}
+		return nil
+	}
+	if len(*cuit) != 11 || strings.Trim(*cuit, "0123456789") != "" {
+		return errors.New("cuit inválido: deben ser 11 dígitos")
+	}
+	suma := 0
+	for i, peso := range []int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2} {
+		suma += int((*cuit)[i]-'0') * peso
+	}
+	verificador := 11 - suma%11
+	if verificador == 11 {
+		verificador = 0
+	}
+	if verificador == 10 || verificador != int((*cuit)[10]-'0') {
+		return errors.New("cuit inválido: dígito verificador incorrecto")
+	}
+	return nil
+}
+
+// Letra según la condición del emisor y del receptor
+func letraFactura(emisor, receptor string) (string, int) {
+	if emisor != "responsable_inscripto" {
+		return "C", facturaC
+	}
+	if receptor == "responsable_inscripto" || receptor == "monotributo" {
+		return "A", facturaA
+	}
+	return "B", facturaB
+}
+
+// Facturador local: CAE aleatorio y numeración en memoria.
+// Con FACTURADOR_FAKE_ERROR=1 falla siempre, para probar la cola de reintentos.
+type facturadorFake struct {
+	mu          sync.Mutex
+	ultimos     map[string]int
+	autorizados map[string]ResultadoFactura
+	fallar      bool
+}
+
+func (f *facturadorFake) Nombre() string { return "fake" }
+
+func (f *facturadorFake) UltimoAutorizado(puntoVenta, tipoComprobante int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ultimos[fmt.Sprintf("%d-%d", puntoVenta, tipoComprobante)], nil
+}
+
+func (f *facturadorFake) Autorizar(s SolicitudFactura) (ResultadoFactura, error) {
+	if f.fallar {
+		return ResultadoFactura{}, errors.New("facturador fake: servicio no disponible")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ultimos[fmt.Sprintf("%d-%d", s.PuntoVenta, s.TipoComprobante)] = s.Numero
+	res := ResultadoFactura{
+		CAE:            fmt.Sprintf("7%013d", rand.Int63n(1e13)),
+		CAEVencimiento: s.Fecha.AddDate(0, 0, 10),
+	}
+	f.autorizados[fmt.Sprintf("%d-%d-%d", s.PuntoVenta, s.TipoComprobante, s.Numero)] = res
+	return res, nil
+}
+
+func (f *facturadorFake) Consultar(puntoVenta, tipoComprobante, numero int) (*ResultadoFactura, error) {
+	if f.fallar {
+		return nil, errors.New("facturador fake: servicio no disponible")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if res, ok := f.autorizados[fmt.Sprintf("%d-%d-%d", puntoVenta, tipoComprobante, numero)]; ok {
+		return &res, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cliente del web service de factura electrónica de ARCA (WSFEv1).
+// El token y la firma de WSAA se obtienen por fuera (ARCA_TOKEN / ARCA_SIGN, duran 12 horas):
+// el login de WSAA requiere firmar con el certificado del contribuyente.
+
+const (
+	arcaHomologacion = "https://wswhomo.afip.gov.ar/wsfev1/service.asmx"
+	arcaProduccion   = "https://servicios1.afip.gov.ar/wsfev1/service.asmx"
+	arcaNamespace    = "http://ar.gov.afip.dif.FEV1/"
+)
+
+type arca struct {
+	url   string
+	cuit  string
+	token string
+	sign  string
+}
+
+func (a *arca) Nombre() string { return "arca" }
+
+type arcaError struct {
+	Code int    `xml:"Code"`
+	Msg  string `xml:"Msg"`
+}
+
+func mensajesARCA(errs []arcaError) string {
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, fmt.Sprintf("%d: %s", e.Code, e.Msg))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (a *arca) auth() string {
+	return fmt.Sprintf(`<ar:Auth><ar:Token>%s</ar:Token><ar:Sign>%s</ar:Sign><ar:Cuit>%s</ar:Cuit></ar:Auth>`,
+		a.token, a.sign, a.cuit)
+}
+
+// Envía una operación SOAP y decodifica el Body en destino
+func (a *arca) llamar(operacion, contenido string, destino interface{}) error {
+	if a.token == "" || a.sign == "" || a.cuit == "" {
+		return errors.New("ARCA no configurado: faltan ARCA_CUIT, ARCA_TOKEN o ARCA_SIGN")
+	}
+
+	envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ar="` + arcaNamespace + `">` +
+		`<soap:Body><ar:` + operacion + `>` + a.auth() + contenido + `</ar:` + operacion + `></soap:Body></soap:Envelope>`
+
+	req, err := http.NewRequest("POST", a.url, strings.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", arcaNamespace+operacion)
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ARCA respondió %s", resp.Status)
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+	var env struct {
+		Body struct {
+			Contenido []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &env); err != nil {
+		return err
+	}
+	return xml.Unmarshal(env.Body.Contenido, destino)
+}
+
+func (a *arca) UltimoAutorizado(puntoVenta, tipoComprobante int) (int, error) {
+	var resp struct {
+		Result struct {
+			CbteNro int         `xml:"CbteNro"`
+			Errors  []arcaError `xml:"Errors>Err"`
+		} `xml:"FECompUltimoAutorizadoResult"`
+	}
+	contenido := fmt.Sprintf(`<ar:PtoVta>%d</ar:PtoVta><ar:CbteTipo>%d</ar:CbteTipo>`, puntoVenta, tipoComprobante)
+	if err := a.llamar("FECompUltimoAutorizado", contenido, &resp); err != nil {
+		return 0, err
+	}
+	if len(resp.Result.Errors) > 0 {
+		return 0, errors.New(mensajesARCA(resp.Result.Errors))
+	}
+	return resp.Result.CbteNro, nil
+}
+
+func (a *arca) Autorizar(s SolicitudFactura) (ResultadoFactura, error) {
+	var res ResultadoFactura
+	fecha := s.Fecha.Format("20060102")
+
+	iva := ""
+	if s.TipoComprobante != facturaC {
+		// Alícuota 21% (Id 5)
+		iva = fmt.Sprintf(`<ar:Iva><ar:AlicIva><ar:Id>5</ar:Id><ar:BaseImp>%s</ar:BaseImp><ar:Importe>%s</ar:Importe></ar:AlicIva></ar:Iva>`,
+			s.Neto.String(), s.IVA.String())
+	}
+
+	// Concepto 2 = servicios: requiere período de servicio y vencimiento de pago
+	contenido := fmt.Sprintf(`<ar:FeCAEReq>
+		<ar:FeCabReq><ar:CantReg>1</ar:CantReg><ar:PtoVta>%d</ar:PtoVta><ar:CbteTipo>%d</ar:CbteTipo></ar:FeCabReq>
+		<ar:FeDetReq><ar:FECAEDetRequest>
+			<ar:Concepto>2</ar:Concepto><ar:DocTipo>%d</ar:DocTipo><ar:DocNro>%s</ar:DocNro>
+			<ar:CbteDesde>%d</ar:CbteDesde><ar:CbteHasta>%d</ar:CbteHasta><ar:CbteFch>%s</ar:CbteFch>
+			<ar:ImpTotal>%s</ar:ImpTotal><ar:ImpTotConc>0</ar:ImpTotConc><ar:ImpNeto>%s</ar:ImpNeto>
+			<ar:ImpOpEx>0</ar:ImpOpEx><ar:ImpTrib>0</ar:ImpTrib><ar:ImpIVA>%s</ar:ImpIVA>
+			<ar:FchServDesde>%s</ar:FchServDesde><ar:FchServHasta>%s</ar:FchServHasta><ar:FchVtoPago>%s</ar:FchVtoPago>
+			<ar:MonId>PES</ar:MonId><ar:MonCotiz>1</ar:MonCotiz>%s
+			<ar:CondicionIVAReceptorId>%d</ar:CondicionIVAReceptorId>
+		</ar:FECAEDetRequest></ar:FeDetReq>
+	</ar:FeCAEReq>`,
+		s.PuntoVenta, s.TipoComprobante, s.DocTipo, s.DocNro, s.Numero, s.Numero, fecha,
+		s.Total.String(), s.Neto.String(), s.IVA.String(), fecha, fecha, fecha, iva, s.CondicionIVAReceptor)
+
+	var resp struct {
+		Result struct {
+			Det struct {
+				Resultado     string      `xml:"Resultado"`
+				CAE           string      `xml:"CAE"`
+				CAEFchVto     string      `xml:"CAEFchVto"`
+				Observaciones []arcaError `xml:"Observaciones>Obs"`
+			} `xml:"FeDetResp>FECAEDetResponse"`
+			Errors []arcaError `xml:"Errors>Err"`
+		} `xml:"FECAESolicitarResult"`
+	}
+	if err := a.llamar("FECAESolicitar", contenido, &resp); err != nil {
+		return res, err
+	}
+
+	det := resp.Result.Det
+	if det.Resultado != "A" {
+		motivo := mensajesARCA(append(resp.Result.Errors, det.Observaciones...))
+		if det.Resultado == "R" {
+			return res, &RechazoFactura{Motivo: motivo}
+		}
+		return res, errors.New("ARCA: " + motivo)
+	}
+
+	vto, err := time.Parse("20060102", det.CAEFchVto)
+	if err != nil {
+		return res, err
+	}
+	return ResultadoFactura{CAE: det.CAE, CAEVencimiento: vto}, nil
+}
+
+// Código de FECompConsultar cuando el comprobante no existe
+const arcaSinDatos = 602
+
+func (a *arca) Consultar(puntoVenta, tipoComprobante, numero int) (*ResultadoFactura, error) {
+	var resp struct {
+		Result struct {
+			Get struct {
+				Resultado       string `xml:"Resultado"`
+				CodAutorizacion string `xml:"CodAutorizacion"`
+				FchVto          string `xml:"FchVto"`
+			} `xml:"ResultGet"`
+			Errors []arcaError `xml:"Errors>Err"`
+		} `xml:"FECompConsultarResult"`
+	}
+	contenido := fmt.Sprintf(`<ar:FeCompConsReq><ar:CbteTipo>%d</ar:CbteTipo><ar:CbteNro>%d</ar:CbteNro><ar:PtoVta>%d</ar:PtoVta></ar:FeCompConsReq>`,
+		tipoComprobante, numero, puntoVenta)
+	if err := a.llamar("FECompConsultar", contenido, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Result.Errors) > 0 {
+		if resp.Result.Errors[0].Code == arcaSinDatos {
+			return nil, nil
+		}
+		return nil, errors.New(mensajesARCA(resp.Result.Errors))
+	}
+
+	get := resp.Result.Get
+	if get.Resultado != "A" || get.CodAutorizacion == "" {
+		return nil, nil
+	}
+	vto, err := time.Parse("20060102", get.FchVto)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultadoFactura{CAE: get.CodAutorizacion, CAEVencimiento: vto}, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Agenda del día: por empleado, los turnos en orden con los nombres resueltos,
+// el estado de pago y los huecos libres dentro de su horario de trabajo.
+
+// Turno tal como lo muestra la agenda
+type TurnoAgenda struct {
+	ID          int    `json:"id"`
+	ClienteID   int    `json:"cliente_id"`
+	Cliente     string `json:"cliente"`
+	Telefono    string `json:"telefono"`
+	ServicioID  int    `json:"servicio_id"`
+	Servicio    string `json:"servicio"`
+	DuracionMin int    `json:"duracion_min"`
+	Estado      string `json:"estado"`
+	Notas       string `json:"notas"`
+	Origen      string `json:"origen"`
+	PrecioFinal Dinero `json:"precio_final"`
+	Pagado      Dinero `json:"pagado"`
+	Saldo       Dinero `json:"saldo"`
+	EstadoPago  string `json:"estado_pago"` // sin_cargo, impago, parcial, pagado
+}
+
+// Bloque de la agenda: un turno o un hueco libre
+type BloqueAgenda struct {
+	Tipo        string       `json:"tipo"` // turno, libre
+	HoraInicio  string       `json:"hora_inicio"`
+	HoraFin     string       `json:"hora_fin"`
+	DuracionMin int          `json:"duracion_min"`
+	Turno       *TurnoAgenda `json:"turno,omitempty"`
+}
+
+type AgendaEmpleado struct {
+	EmpleadoID int            `json:"empleado_id"`
+	Empleado   string         `json:"empleado"`
+	Bloques    []BloqueAgenda `json:"bloques"`
+}
+
+func estadoPago(precioFinal, pagado Dinero) string {
+	switch {
+	case precioFinal == 0:
+		return "sin_cargo"
+	case pagado <= 0:
+		return "impago"
+	case pagado < precioFinal:
+		return "parcial"
+	default:
+		return "pagado"
+	}
+}
+
+func minutosEntre(desde, hasta string) int {
+	d, err1 := time.Parse("15:04", desde)
+	h, err2 := time.Parse("15:04", hasta)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return int(h.Sub(d).Minutes())
+}
+
+// Agrega los huecos libres de cada franja de trabajo entre los turnos (ordenados por hora)
+func armarBloques(turnos []BloqueAgenda, franjas []franja) []BloqueAgenda {
+	bloques := append([]BloqueAgenda{}, turnos...)
+	libre := func(desde, hasta int) {
+		if desde < hasta {
+			bloques = append(bloques, BloqueAgenda{Tipo: "libre", HoraInicio: horaDelDia(desde), HoraFin: horaDelDia(hasta), DuracionMin: hasta - desde})
+		}
+	}
+
+	for _, f := range franjas {
+		cursor := f.Inicio
+		for _, t := range turnos {
+			ini, _ := minutosDelDia(t.HoraInicio)
+			fin, _ := minutosDelDia(t.HoraFin)
+			if ini > cursor {
+				libre(cursor, min(ini, f.Fin))
+			}
+			cursor = max(cursor, fin)
+		}
+		libre(cursor, f.Fin)
+	}
+
+	sort.SliceStable(bloques, func(i, j int) bool { return bloques[i].HoraInicio < bloques[j].HoraInicio })
+	return bloques
+}
+
+// GET /agenda?fecha=2025-09-16&empleado_id=2  (sin empleado_id: todos)
+func getAgenda(c *gin.Context, db *sql.DB) {
+	fecha := c.DefaultQuery("fecha", time.Now().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", fecha); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fecha inválida: usar YYYY-MM-DD"})
+		return
+	}
+
+	empleadoID := 0
+	if v := c.Query("empleado_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "empleado_id inválido"})
+			return
+		}
+		empleadoID = id
+	}
+
+	rows, err := db.Query(`SELECT id, nombre || ' ' || apellido FROM empleados WHERE $1 = 0 OR id = $1 ORDER BY nombre, apellido`, empleadoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	agenda := []AgendaEmpleado{}
+	indice := map[int]int{}
+	for rows.Next() {
+		var a AgendaEmpleado
+		if err := rows.Scan(&a.EmpleadoID, &a.Empleado); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		indice[a.EmpleadoID] = len(agenda)
+		agenda = append(agenda, a)
+	}
+	rows.Close()
+
+	if empleadoID != 0 && len(agenda) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "empleado no encontrado"})
+		return
+	}
+
+	rows, err = db.Query(`
+		SELECT t.empleado_id, t.id, t.cliente_id, c.nombre || ' ' || c.apellido, COALESCE(c.telefono, ''),
+		       t.servicio_id, s.nombre, t.duracion_min, t.estado, COALESCE(t.notas, ''), t.origen,
+		       TO_CHAR(t.hora_inicio, 'HH24:MI'), TO_CHAR(t.hora_fin, 'HH24:MI'),
+		       ts.precio_final, ts.pagado, ts.saldo
+		FROM turnos t
+		JOIN clientes c ON c.id = t.cliente_id
+		JOIN servicios s ON s.id = t.servicio_id
+		JOIN turno_saldos ts ON ts.turno_id = t.id
+		WHERE t.fecha = $1 AND t.estado != 'cancelado' AND ($2 = 0 OR t.empleado_id = $2)
+		ORDER BY t.empleado_id, t.hora_inicio`, fecha, empleadoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	turnos := map[int][]BloqueAgenda{}
+	for rows.Next() {
+		var empID int
+		var t TurnoAgenda
+		var b BloqueAgenda
+		err := rows.Scan(&empID, &t.ID, &t.ClienteID, &t.Cliente, &t.Telefono, &t.ServicioID, &t.Servicio, &t.DuracionMin,
+			&t.Estado, &t.Notas, &t.Origen, &b.HoraInicio, &b.HoraFin, &t.PrecioFinal, &t.Pagado, &t.Saldo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		t.EstadoPago = estadoPago(t.PrecioFinal, t.Pagado)
+		b.Tipo, b.Turno = "turno", &t
+		b.DuracionMin = minutosEntre(b.HoraInicio, b.HoraFin)
+		turnos[empID] = append(turnos[empID], b)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	dia, _ := time.Parse("2006-01-02", fecha)
+	for empID, i := range indice {
+		franjas, err := franjasEmpleado(db, empID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		agenda[i].Bloques = armarBloques(turnos[empID], franjas[diaISO(dia)])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"fecha": fecha, "empleados": agenda})
+}
@@ -17,9 +17,26 @@ import (
 //     Dni      string `json:"dni"`
 // }
 
+// Columnas comunes para leer un cliente (email/telefono quedan NULL al anonimizar)
+const columnasCliente = `id, nombre, COALESCE(telefono, ''), COALESCE(email, ''),
+	consentimiento_datos, consentimiento_datos_fecha,
+	consentimiento_marketing, consentimiento_marketing_fecha, anonimizado_en,
+	condicion_iva, COALESCE(cuit, ''), creado_en`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCliente(s scanner, cl *Cliente) error {
+	return s.Scan(&cl.ID, &cl.Nombre, &cl.Telefono, &cl.Email,
+		&cl.ConsentimientoDatos, &cl.ConsentimientoDatosFecha,
+		&cl.ConsentimientoMarketing, &cl.ConsentimientoMarketingFecha, &cl.AnonimizadoEn,
+		&cl.CondicionIVA, &cl.CUIT, &cl.CreadoEn)
+}
+
 // Listar todos los clientes
 func getClientes(c *gin.Context, db *sql.DB) {
-	rows, err := db.Query("SELECT id, nombre, telefono, email FROM clientes")
+	rows, err := db.Query("SELECT " + columnasCliente + " FROM clientes")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -29,7 +46,7 @@ func getClientes(c *gin.Context, db *sql.DB) {
 	var clientes []Cliente
 	for rows.Next() {
 		var cl Cliente
-		if err := rows.Scan(&cl.ID, &cl.Nombre, &cl.Telefono, &cl.Email); err != nil {
+		if err := scanCliente(rows, &cl); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -43,8 +60,7 @@ func getClientes(c *gin.Context, db *sql.DB) {
 func getCliente(c *gin.Context, db *sql.DB) {
 	id := c.Param("id")
 	var cl Cliente
-	err := db.QueryRow("SELECT id, nombre, telefono, email FROM clientes WHERE id=$1", id).
-		Scan(&cl.ID, &cl.Nombre, &cl.Telefono, &cl.Email)
+	err := scanCliente(db.QueryRow("SELECT "+columnasCliente+" FROM clientes WHERE id=$1", id), &cl)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
@@ -53,6 +69,19 @@ func getCliente(c *gin.Context, db *sql.DB) {
 		}
 		return
 	}
+
+	cl.Etiquetas, err = etiquetasDeCliente(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	conf, err := calcularConfiabilidad(db, cl.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cl.Confiabilidad = &conf.Puntaje
 	c.JSON(http.StatusOK, cl)
 }
 
@@ -63,14 +92,47 @@ func createCliente(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validarDatosFiscales(&cl.CondicionIVA, &cl.CUIT); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := `INSERT INTO clientes (id, nombre, apellido, telefono, email) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := db.QueryRow(query, cl.Dni, cl.Nombre, cl.Apellido, cl.Telefono, cl.Email).Scan(&cl.ID)
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO clientes (id, nombre, apellido, telefono, email,
+	              consentimiento_datos, consentimiento_datos_fecha, consentimiento_marketing, consentimiento_marketing_fecha,
+	              condicion_iva, cuit)
+	          VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $6 THEN NOW() END, $7, CASE WHEN $7 THEN NOW() END, $8, $9)
+	          RETURNING id, consentimiento_datos_fecha, consentimiento_marketing_fecha, creado_en`
+	err = tx.QueryRow(query, cl.Dni, cl.Nombre, cl.Apellido, cl.Telefono, cl.Email, cl.ConsentimientoDatos, cl.ConsentimientoMarketing,
+		cl.CondicionIVA, nullSiVacio(cl.CUIT)).
+		Scan(&cl.ID, &cl.ConsentimientoDatosFecha, &cl.ConsentimientoMarketingFecha, &cl.CreadoEn)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Dejar constancia de los consentimientos otorgados al alta
+	for tipo, otorgado := range map[string]bool{"datos": cl.ConsentimientoDatos, "marketing": cl.ConsentimientoMarketing} {
+		if !otorgado {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO consentimientos (cliente_id, tipo, otorgado) VALUES ($1, $2, TRUE)`, cl.ID, tipo); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusCreated, cl)
 }
 
@@ -83,7 +145,8 @@ func updateCliente(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	query := `UPDATE clientes SET nombre=$1, telefono=$2, email=$3 WHERE id=$4`
+	// Un cliente anonimizado no se puede volver a completar con datos personales
+	query := `UPDATE clientes SET nombre=$1, telefono=$2, email=$3 WHERE id=$4 AND anonimizado_en IS NULL`
 	res, err := db.Exec(query, cl.Nombre, cl.Telefono, cl.Email, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -92,42 +155,84 @@ func updateCliente(c *gin.Context, db *sql.DB) {
 
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		var existe bool
+		if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM clientes WHERE id=$1)", id).Scan(&existe); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if existe {
+			c.JSON(http.StatusConflict, gin.H{"error": "el cliente fue anonimizado y no se puede modificar"})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "cliente actualizado"})
 }
 
-// Borrar cliente (solo si no tiene turnos)
+// Borrar cliente. Si tiene turnos o registros contables (compras de paquetes o tarjetas,
+// períodos de membresía pagados, movimientos de puntos) se anonimiza en lugar de borrarlo,
+// para cumplir el pedido de supresión sin perder las estadísticas ni la contabilidad.
 func deleteCliente(c *gin.Context, db *sql.DB) {
 	id := c.Param("id")
 
-	// Verificar si tiene turnos asignados
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM turnos WHERE cliente_id=$1", id).Scan(&count)
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no se puede eliminar: el cliente tiene turnos asignados"})
+	defer tx.Rollback()
+
+	var conHistorial bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM turnos WHERE cliente_id = c.id)
+		    OR EXISTS (SELECT 1 FROM paquetes_cliente WHERE cliente_id = c.id)
+		    OR EXISTS (SELECT 1 FROM tarjetas_regalo WHERE comprador_id = c.id)
+		    OR EXISTS (SELECT 1 FROM puntos_movimientos WHERE cliente_id = c.id)
+		    OR EXISTS (SELECT 1 FROM suscripcion_periodos sp JOIN suscripciones s ON s.id = sp.suscripcion_id
+		               WHERE s.cliente_id = c.id AND sp.pagado_en IS NOT NULL)
+		FROM clientes c WHERE c.id = $1 FOR UPDATE`, id).Scan(&conHistorial)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
 		return
 	}
-
-	// Borrar cliente
-	res, err := db.Exec("DELETE FROM clientes WHERE id=$1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+	resp := gin.H{"status": "cliente eliminado"}
+	var datos []string
+	if conHistorial {
+		var nuevoID int
+		nuevoID, datos, err = anonimizarClienteTx(db, tx, id)
+		resp = gin.H{"status": "cliente anonimizado: tiene turnos o compras registradas", "id": nuevoID}
+	} else {
+		// Sin historial: se borra junto con consentimientos, etiquetas, cupones y membresías sin pagar
+		for _, q := range []string{
+			"DELETE FROM consentimientos WHERE cliente_id=$1",
+			"DELETE FROM cliente_etiquetas WHERE cliente_id=$1",
+			"DELETE FROM cupon_canjes WHERE cliente_id=$1",
+			"DELETE FROM suscripcion_periodos WHERE suscripcion_id IN (SELECT id FROM suscripciones WHERE cliente_id=$1)",
+			"DELETE FROM suscripciones WHERE cliente_id=$1",
+			"DELETE FROM clientes WHERE id=$1",
+		} {
+			if _, err = tx.Exec(q, id); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == nil {
+		err = borrarEmailsCliente(datos)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "cliente eliminado"})
+	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Datos personales de clientes (Ley 25.326): consentimientos,
+// derecho de acceso (export) y supresión (anonimización).
+
+// PUT /clientes/:id/consentimiento
+// { "consentimiento_datos": true, "consentimiento_marketing": false }
+func updateConsentimiento(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var body struct {
+		ConsentimientoDatos     *bool `json:"consentimiento_datos"`
+		ConsentimientoMarketing *bool `json:"consentimiento_marketing"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.ConsentimientoDatos == nil && body.ConsentimientoMarketing == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "consentimiento_datos o consentimiento_marketing es requerido"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var datos, marketing bool
+	err = tx.QueryRow(`SELECT consentimiento_datos, consentimiento_marketing FROM clientes
+	                   WHERE id=$1 AND anonimizado_en IS NULL FOR UPDATE`, id).Scan(&datos, &marketing)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Solo se registran los cambios efectivos, con su fecha
+	cambios := map[string]bool{}
+	if body.ConsentimientoDatos != nil && *body.ConsentimientoDatos != datos {
+		cambios["datos"] = *body.ConsentimientoDatos
+	}
+	if body.ConsentimientoMarketing != nil && *body.ConsentimientoMarketing != marketing {
+		cambios["marketing"] = *body.ConsentimientoMarketing
+	}
+
+	for tipo, otorgado := range cambios {
+		query := fmt.Sprintf(`UPDATE clientes SET consentimiento_%[1]s=$1, consentimiento_%[1]s_fecha=NOW() WHERE id=$2`, tipo)
+		if _, err := tx.Exec(query, otorgado, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := tx.Exec(`INSERT INTO consentimientos (cliente_id, tipo, otorgado) VALUES ($1, $2, $3)`, id, tipo, otorgado); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "consentimiento actualizado"})
+}
+
+// Reúne todos los datos que guardamos sobre un cliente, agrupados por sección
+func datosCliente(db *sql.DB, id string) (map[string]interface{}, error) {
+	var cl Cliente
+	err := db.QueryRow(`SELECT id, nombre, apellido, COALESCE(telefono, ''), COALESCE(email, ''),
+	                           condicion_iva, COALESCE(cuit, ''),
+	                           consentimiento_datos, consentimiento_datos_fecha,
+	                           consentimiento_marketing, consentimiento_marketing_fecha, anonimizado_en
+	                    FROM clientes WHERE id=$1`, id).
+		Scan(&cl.ID, &cl.Nombre, &cl.Apellido, &cl.Telefono, &cl.Email, &cl.CondicionIVA, &cl.CUIT,
+			&cl.ConsentimientoDatos, &cl.ConsentimientoDatosFecha,
+			&cl.ConsentimientoMarketing, &cl.ConsentimientoMarketingFecha, &cl.AnonimizadoEn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Historial de consentimientos
+	rows, err := db.Query(`SELECT id, cliente_id, tipo, otorgado, fecha FROM consentimientos
+	                       WHERE cliente_id=$1 ORDER BY fecha`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consentimientos := []Consentimiento{}
+	for rows.Next() {
+		var co Consentimiento
+		if err := rows.Scan(&co.ID, &co.ClienteID, &co.Tipo, &co.Otorgado, &co.Fecha); err != nil {
+			return nil, err
+		}
+		consentimientos = append(consentimientos, co)
+	}
+
+	// Turnos con nombres resueltos
+	turnoRows, err := db.Query(`
+		SELECT t.id, TO_CHAR(t.fecha, 'YYYY-MM-DD'), TO_CHAR(t.hora_inicio, 'HH24:MI'), TO_CHAR(t.hora_fin, 'HH24:MI'),
+		       t.estado, COALESCE(t.notas, ''), s.nombre, e.nombre
+		FROM turnos t
+		JOIN servicios s ON t.servicio_id = s.id
+		JOIN empleados e ON t.empleado_id = e.id
+		WHERE t.cliente_id = $1
+		ORDER BY t.fecha, t.hora_inicio`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer turnoRows.Close()
+
+	type turnoExport struct {
+		ID         int    `json:"id"`
+		Fecha      string `json:"fecha"`
+		HoraInicio string `json:"hora_inicio"`
+		HoraFin    string `json:"hora_fin"`
+		Estado     string `json:"estado"`
+		Notas      string `json:"notas"`
+		Servicio   string `json:"servicio"`
+		Empleado   string `json:"empleado"`
+	}
+	turnos := []turnoExport{}
+	for turnoRows.Next() {
+		var t turnoExport
+		if err := turnoRows.Scan(&t.ID, &t.Fecha, &t.HoraInicio, &t.HoraFin, &t.Estado, &t.Notas, &t.Servicio, &t.Empleado); err != nil {
+			return nil, err
+		}
+		turnos = append(turnos, t)
+	}
+
+	cl.Etiquetas, err = etiquetasDeCliente(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	puntos, err := movimientosPuntos(db, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pagos, err := listarPagos(db, "t.cliente_id = $1", cl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	paquetes, err := paquetesDeCliente(db, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	suscripciones, err := listarSuscripciones(db, "s.cliente_id = $1", cl.ID)
+	if err == nil {
+		err = cargarPeriodos(db, suscripciones)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cupones, err := canjesCuponCliente(db, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	facturas := []Factura{}
+	facturaRows, err := db.Query("SELECT "+columnasFactura+` FROM facturas
+	                             WHERE turno_id IN (SELECT id FROM turnos WHERE cliente_id = $1) ORDER BY id`, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer facturaRows.Close()
+	for facturaRows.Next() {
+		var f Factura
+		if err := scanFactura(facturaRows, &f); err != nil {
+			return nil, err
+		}
+		facturas = append(facturas, f)
+	}
+
+	tarjetas := []TarjetaRegalo{}
+	tarjetaRows, err := db.Query("SELECT "+columnasTarjeta+" FROM tarjetas_regalo WHERE comprador_id = $1 ORDER BY id", cl.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer tarjetaRows.Close()
+	for tarjetaRows.Next() {
+		var tr TarjetaRegalo
+		if err := scanTarjeta(tarjetaRows, &tr); err != nil {
+			return nil, err
+		}
+		tarjetas = append(tarjetas, tr)
+	}
+
+	usos, err := usosMembresiaCliente(db, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"cliente":         cl,
+		"consentimientos": consentimientos,
+		"turnos":          turnos,
+		"puntos":          puntos,
+		"pagos":           pagos,
+		"paquetes":        paquetes,
+		"suscripciones":   suscripciones,
+		"cupones":         cupones,
+		"facturas":        facturas,
+		"tarjetas_regalo": tarjetas,
+		"membresia_usos":  usos,
+	}, nil
+}
+
+type canjeCuponExport struct {
+	Codigo    string     `json:"codigo"`
+	TurnoID   *int       `json:"turno_id"`
+	Descuento Dinero     `json:"descuento"`
+	CreadoEn  time.Time  `json:"creado_en"`
+	AnuladoEn *time.Time `json:"anulado_en"`
+}
+
+// Cupones usados por el cliente (incluye los anulados al cancelar el turno)
+func canjesCuponCliente(db *sql.DB, clienteID int) ([]canjeCuponExport, error) {
+	rows, err := db.Query(`SELECT cu.codigo, cc.turno_id, cc.descuento, cc.creado_en, cc.anulado_en
+	                       FROM cupon_canjes cc JOIN cupones cu ON cu.id = cc.cupon_id
+	                       WHERE cc.cliente_id = $1 ORDER BY cc.creado_en, cc.id`, clienteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	canjes := []canjeCuponExport{}
+	for rows.Next() {
+		var cc canjeCuponExport
+		if err := rows.Scan(&cc.Codigo, &cc.TurnoID, &cc.Descuento, &cc.CreadoEn, &cc.AnuladoEn); err != nil {
+			return nil, err
+		}
+		canjes = append(canjes, cc)
+	}
+	return canjes, rows.Err()
+}
+
+type usoMembresiaExport struct {
+	SuscripcionID int       `json:"suscripcion_id"`
+	TurnoID       int       `json:"turno_id"`
+	PeriodoDesde  string    `json:"periodo_desde"`
+	CreadoEn      time.Time `json:"creado_en"`
+}
+
+// Turnos cubiertos por la membresía, con el período al que descontaron
+func usosMembresiaCliente(db *sql.DB, clienteID int) ([]usoMembresiaExport, error) {
+	rows, err := db.Query(`SELECT mu.suscripcion_id, mu.turno_id, TO_CHAR(mu.periodo_desde, 'YYYY-MM-DD'), mu.creado_en
+	                       FROM membresia_usos mu JOIN suscripciones s ON s.id = mu.suscripcion_id
+	                       WHERE s.cliente_id = $1 ORDER BY mu.periodo_desde, mu.id`, clienteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usos := []usoMembresiaExport{}
+	for rows.Next() {
+		var u usoMembresiaExport
+		if err := rows.Scan(&u.SuscripcionID, &u.TurnoID, &u.PeriodoDesde, &u.CreadoEn); err != nil {
+			return nil, err
+		}
+		usos = append(usos, u)
+	}
+	return usos, rows.Err()
+}
+
+// GET /clientes/:id/export?formato=json|zip
+func exportCliente(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	formato := c.DefaultQuery("formato", "json")
+
+	datos, err := datosCliente(db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	datos["exportado_en"] = time.Now()
+
+	switch formato {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=cliente_%s.json", id))
+		c.JSON(http.StatusOK, datos)
+	case "zip":
+		// Un archivo JSON por sección, en orden alfabético para que dos exportaciones
+		// de los mismos datos sean iguales
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=cliente_%s.zip", id))
+		c.Status(http.StatusOK)
+
+		secciones := make([]string, 0, len(datos))
+		for seccion := range datos {
+			secciones = append(secciones, seccion)
+		}
+		sort.Strings(secciones)
+
+		zw := zip.NewWriter(c.Writer)
+		for _, seccion := range secciones {
+			contenido := datos[seccion]
+			f, err := zw.Create(seccion + ".json")
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(contenido); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			c.Error(err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "formato inválido: usar json o zip"})
+	}
+}
+
+// Borra los datos personales del cliente y conserva sus turnos para estadísticas.
+// Devuelve el id nuevo del cliente, o sql.ErrNoRows si no existe.
+func anonimizarCliente(db *sql.DB, id string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	nuevoID, datos, err := anonimizarClienteTx(db, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return nuevoID, borrarEmailsCliente(datos)
+}
+
+// Anonimiza dentro de la transacción. El id del cliente es su DNI, así que se
+// reemplaza por uno negativo de clientes_anonimos_seq (las FK actualizan en cascada)
+// y los comprobantes dejan de mostrarlo. Solo las facturas ya autorizadas por ARCA
+// conservan el documento: son registros fiscales que no se pueden modificar.
+// Devuelve el id nuevo y los datos personales que tenía el cliente (nombre, email,
+// teléfono), para borrar después del commit los emails guardados por el notificador
+// de archivo que los mencionan.
+func anonimizarClienteTx(db *sql.DB, tx *sql.Tx, id string) (int, []string, error) {
+	var nombre, email, telefono string
+	err := tx.QueryRow(`SELECT TRIM(nombre || ' ' || apellido), COALESCE(email, ''), COALESCE(telefono, '')
+	                    FROM clientes WHERE id = $1 FOR UPDATE`, id).Scan(&nombre, &email, &telefono)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var nuevoID int
+	err = tx.QueryRow(`
+		UPDATE clientes
+		SET id = CASE WHEN id > 0 THEN -nextval('clientes_anonimos_seq') ELSE id END,
+		    nombre = 'Anónimo', apellido = '', telefono = NULL, email = NULL,
+		    cuit = NULL, condicion_iva = 'consumidor_final',
+		    consentimiento_datos = FALSE, consentimiento_marketing = FALSE,
+		    anonimizado_en = COALESCE(anonimizado_en, NOW())
+		WHERE id = $1
+		RETURNING id`, id).Scan(&nuevoID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Las notas de los turnos, las etiquetas y el destinatario de las tarjetas
+	// compradas pueden contener datos personales
+	for _, q := range []string{
+		`UPDATE turnos SET notas = NULL WHERE cliente_id = $1`,
+		`DELETE FROM cliente_etiquetas WHERE cliente_id = $1`,
+		`UPDATE tarjetas_regalo SET destinatario = '' WHERE comprador_id = $1`,
+	} {
+		if _, err := tx.Exec(q, nuevoID); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// Los comprobantes ya emitidos guardan el PDF con el nombre y el email: se
+	// regeneran con el mismo número y fecha de emisión y los datos anonimizados
+	rows, err := tx.Query(`SELECT co.turno_id, co.sucursal, co.numero, co.creado_en
+	                       FROM comprobantes co JOIN turnos t ON t.id = co.turno_id
+	                       WHERE t.cliente_id = $1`, nuevoID)
+	if err != nil {
+		return 0, nil, err
+	}
+	type emitido struct {
+		turnoID, sucursal, numero int
+		creado                    time.Time
+	}
+	var emitidos []emitido
+	for rows.Next() {
+		var e emitido
+		if err := rows.Scan(&e.turnoID, &e.sucursal, &e.numero, &e.creado); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		emitidos = append(emitidos, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	for _, e := range emitidos {
+		d, _, err := cargarDatosComprobante(db, tx, e.turnoID)
+		if err != nil {
+			return 0, nil, err
+		}
+		d.Numero = numeroComprobante(e.sucursal, e.numero)
+		d.Emitido = e.creado
+		pdf, err := generarPDFComprobante(d)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, err := tx.Exec(`UPDATE comprobantes SET pdf = $1 WHERE turno_id = $2`, pdf, e.turnoID); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return nuevoID, []string{nombre, email, telefono}, nil
+}
+
+// POST /clientes/:id/anonimizar
+func anonimizarClienteHandler(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	nuevoID, err := anonimizarCliente(db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "cliente anonimizado", "id": nuevoID})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// Columnas del formato de importación/exportación de clientes (en este orden)
+var columnasImportCliente = []string{"dni", "nombre", "apellido", "telefono", "email"}
+
+// Fila del archivo ya mapeada a los campos del cliente
+type filaImport struct {
+	Fila    int               `json:"fila"` // número de fila en el archivo (1 = encabezado)
+	Campos  map[string]string `json:"campos"`
+	Errores []string          `json:"errores,omitempty"`
+}
+
+// Deja solo dígitos y quita prefijos de Argentina (+54, 9 de celulares, 0 de larga distancia)
+func normalizarTelefono(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	tel := b.String()
+	if strings.HasPrefix(tel, "54") && len(tel) > 10 {
+		tel = strings.TrimPrefix(tel, "54")
+		if strings.HasPrefix(tel, "9") && len(tel) == 11 {
+			tel = tel[1:]
+		}
+	}
+	return strings.TrimPrefix(tel, "0")
+}
+
+func normalizarEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// Lee todas las filas (encabezado incluido) de un CSV (coma o punto y coma) o XLSX
+func leerFilasArchivo(nombre string, contenido []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(nombre)) {
+	case ".xlsx":
+		f, err := excelize.OpenReader(bytes.NewReader(contenido))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		hojas := f.GetSheetList()
+		if len(hojas) == 0 {
+			return nil, fmt.Errorf("el archivo no tiene hojas")
+		}
+		return f.GetRows(hojas[0])
+
+	case ".csv", ".txt":
+		contenido = bytes.TrimPrefix(contenido, []byte("\xef\xbb\xbf")) // BOM de Excel
+		r := csv.NewReader(bytes.NewReader(contenido))
+		// Excel en español exporta con ';'
+		primera := contenido
+		if i := bytes.IndexByte(contenido, '\n'); i >= 0 {
+			primera = contenido[:i]
+		}
+		if bytes.Count(primera, []byte(";")) > bytes.Count(primera, []byte(",")) {
+			r.Comma = ';'
+		}
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		return r.ReadAll()
+
+	default:
+		return nil, fmt.Errorf("formato no soportado: usar .csv o .xlsx")
+	}
+}
+
+// Asocia cada columna del archivo a un campo del cliente.
+// mapeo es {"Encabezado en el archivo": "campo"}; sin mapeo se usa el nombre del encabezado.
+func mapearColumnas(encabezado []string, mapeo map[string]string) (map[int]string, error) {
+	validos := map[string]bool{}
+	for _, col := range columnasImportCliente {
+		validos[col] = true
+	}
+
+	columnas := map[int]string{}
+	usados := map[string]bool{}
+	for i, h := range encabezado {
+		h = strings.TrimSpace(h)
+		campo, ok := mapeo[h]
+		if !ok {
+			campo = strings.ToLower(h)
+		}
+		if campo == "" || !validos[campo] {
+			continue // columna ignorada
+		}
+		if usados[campo] {
+			return nil, fmt.Errorf("el campo %s está mapeado a más de una columna", campo)
+		}
+		usados[campo] = true
+		columnas[i] = campo
+	}
+
+	for _, campo := range mapeo {
+		if campo != "" && !validos[campo] {
+			return nil, fmt.Errorf("campo desconocido en el mapeo: %s", campo)
+		}
+	}
+	if !usados["nombre"] {
+		return nil, fmt.Errorf("falta la columna nombre")
+	}
+	return columnas, nil
+}
+
+// Teléfonos y emails ya registrados, normalizados igual que los del archivo
+// ("campo:valor" -> id del cliente): en la base pueden estar cargados con otro formato.
+func contactosRegistrados(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(telefono, ''), COALESCE(email, '') FROM clientes
+	                       WHERE telefono IS NOT NULL OR email IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	registrados := map[string]int{}
+	for rows.Next() {
+		var id int
+		var telefono, email string
+		if err := rows.Scan(&id, &telefono, &email); err != nil {
+			return nil, err
+		}
+		if tel := normalizarTelefono(telefono); tel != "" {
+			registrados["telefono:"+tel] = id
+		}
+		if email = normalizarEmail(email); email != "" {
+			registrados["email:"+email] = id
+		}
+	}
+	return registrados, rows.Err()
+}
+
+// Normaliza y valida cada fila, buscando duplicados dentro del archivo y contra la base
+func validarFilasImport(db *sql.DB, filas [][]string, columnas map[int]string) ([]filaImport, error) {
+	var resultado []filaImport
+	vistos := map[string]int{} // "campo:valor" -> fila donde apareció
+
+	registrados, err := contactosRegistrados(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, fila := range filas[1:] {
+		fi := filaImport{Fila: n + 2, Campos: map[string]string{}}
+
+		vacia := true
+		for i, campo := range columnas {
+			if i < len(fila) {
+				fi.Campos[campo] = strings.TrimSpace(fila[i])
+				if fi.Campos[campo] != "" {
+					vacia = false
+				}
+			}
+		}
+		if vacia {
+			continue
+		}
+
+		fi.Campos["telefono"] = normalizarTelefono(fi.Campos["telefono"])
+		fi.Campos["email"] = normalizarEmail(fi.Campos["email"])
+
+		if fi.Campos["nombre"] == "" {
+			fi.Errores = append(fi.Errores, "nombre es requerido")
+		}
+		if dni := fi.Campos["dni"]; dni != "" {
+			if _, err := strconv.Atoi(dni); err != nil {
+				fi.Errores = append(fi.Errores, "dni inválido: "+dni)
+			}
+		}
+		if tel := fi.Campos["telefono"]; tel != "" && (len(tel) < 8 || len(tel) > 20) {
+			fi.Errores = append(fi.Errores, "teléfono inválido: "+tel)
+		}
+		if email := fi.Campos["email"]; email != "" {
+			if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+				fi.Errores = append(fi.Errores, "email inválido: "+email)
+			}
+		}
+
+		// Duplicados
+		for _, campo := range []string{"dni", "telefono", "email"} {
+			valor := fi.Campos[campo]
+			if valor == "" {
+				continue
+			}
+			clave := campo + ":" + valor
+			if otra, ok := vistos[clave]; ok {
+				fi.Errores = append(fi.Errores, fmt.Sprintf("%s duplicado en el archivo (fila %d)", campo, otra))
+				continue
+			}
+			vistos[clave] = fi.Fila
+
+			if campo != "dni" {
+				if existente, ok := registrados[clave]; ok {
+					fi.Errores = append(fi.Errores, fmt.Sprintf("%s ya registrado (cliente %d)", campo, existente))
+				}
+				continue
+			}
+			dni, err := strconv.Atoi(valor)
+			if err != nil {
+				continue // ya informado como dni inválido
+			}
+			var existente int
+			err = db.QueryRow("SELECT id FROM clientes WHERE id = $1", dni).Scan(&existente)
+			if err == nil {
+				fi.Errores = append(fi.Errores, fmt.Sprintf("dni ya registrado (cliente %d)", existente))
+			} else if err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		resultado = append(resultado, fi)
+	}
+	return resultado, nil
+}
+
+func nullSiVacio(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// POST /clientes/import?dry_run=true
+// multipart: archivo (.csv o .xlsx), mapeo (opcional) {"Encabezado": "campo"}
+func importClientes(c *gin.Context, db *sql.DB) {
+	dryRun := c.Query("dry_run") == "true" || c.PostForm("dry_run") == "true"
+
+	fh, err := c.FormFile("archivo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archivo es requerido"})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	contenido, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mapeo := map[string]string{}
+	if m := c.PostForm("mapeo"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapeo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapeo inválido: " + err.Error()})
+			return
+		}
+	}
+
+	filas, err := leerFilasArchivo(fh.Filename, contenido)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(filas) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "el archivo no tiene filas de datos"})
+		return
+	}
+
+	columnas, err := mapearColumnas(filas[0], mapeo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resultado, err := validarFilasImport(db, filas, columnas)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var conErrores []filaImport
+	for _, fi := range resultado {
+		if len(fi.Errores) > 0 {
+			conErrores = append(conErrores, fi)
+		}
+	}
+
+	reporte := gin.H{
+		"dry_run": dryRun,
+		"total":   len(resultado),
+		"validas": len(resultado) - len(conErrores),
+		"errores": conErrores,
+	}
+
+	if dryRun {
+		reporte["filas"] = resultado
+		c.JSON(http.StatusOK, reporte)
+		return
+	}
+
+	// Todo o nada: si alguna fila tiene errores no se importa ninguna
+	if len(conErrores) > 0 {
+		reporte["importados"] = 0
+		c.JSON(http.StatusUnprocessableEntity, reporte)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	conDNI := false
+	for _, fi := range resultado {
+		campos := fi.Campos
+		var err error
+		if campos["dni"] != "" {
+			conDNI = true
+			_, err = tx.Exec(`INSERT INTO clientes (id, nombre, apellido, telefono, email) VALUES ($1, $2, $3, $4, $5)`,
+				campos["dni"], campos["nombre"], campos["apellido"], nullSiVacio(campos["telefono"]), nullSiVacio(campos["email"]))
+		} else {
+			_, err = tx.Exec(`INSERT INTO clientes (nombre, apellido, telefono, email) VALUES ($1, $2, $3, $4)`,
+				campos["nombre"], campos["apellido"], nullSiVacio(campos["telefono"]), nullSiVacio(campos["email"]))
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("fila %d: %s", fi.Fila, err.Error())})
+			return
+		}
+	}
+
+	// Los ids explícitos no avanzan la secuencia: sin esto el próximo alta chocaría con un dni importado
+	if conDNI {
+		_, err := tx.Exec(`SELECT setval(pg_get_serial_sequence('clientes', 'id'), (SELECT MAX(id) FROM clientes))`)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reporte["importados"] = len(resultado)
+	c.JSON(http.StatusCreated, reporte)
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestNormalizarTelefono(t *testing.T) {
+	casos := []struct{ tel, want string }{
+		{"11 4567-8901", "1145678901"},
+		{"011 4567-8901", "1145678901"},
+		{"+54 9 11 4567-8901", "1145678901"},
+		{"+54 11 4567-8901", "1145678901"},
+		{"5491145678901", "1145678901"},
+		{"(0351) 15-456-7890", "351154567890"},
+		{"", ""},
+	}
+	for _, c := range casos {
+		if got := normalizarTelefono(c.tel); got != c.want {
+			t.Errorf("normalizarTelefono(%q) = %q, se esperaba %q", c.tel, got, c.want)
+		}
+	}
+}
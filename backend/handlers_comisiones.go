@@ -0,0 +1,458 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Comisiones y propinas de empleados. La liquidación de un período se calcula sobre los
+// turnos completados; al cerrarla se guarda el detalle y el período queda bloqueado:
+// los turnos del empleado en esas fechas ya no se modifican ni reciben propinas.
+
+const columnasReglaComision = `id, empleado_id, servicio_id, tipo, valor, tramos, activo`
+
+func scanReglaComision(sc scanner, r *ReglaComision) error {
+	var tramos []byte
+	if err := sc.Scan(&r.ID, &r.EmpleadoID, &r.ServicioID, &r.Tipo, &r.Valor, &tramos, &r.Activo); err != nil {
+		return err
+	}
+	return json.Unmarshal(tramos, &r.Tramos)
+}
+
+// La regla más específica para el turno: empleado y servicio, solo empleado, solo servicio, general
+func reglaComisionPara(reglas []ReglaComision, servicioID int) *ReglaComision {
+	var mejor *ReglaComision
+	mejorPeso := -1
+	for i, r := range reglas {
+		if r.ServicioID != nil && *r.ServicioID != servicioID {
+			continue
+		}
+		peso := 0
+		if r.EmpleadoID != nil {
+			peso += 2
+		}
+		if r.ServicioID != nil {
+			peso++
+		}
+		if peso > mejorPeso {
+			mejor, mejorPeso = &reglas[i], peso
+		}
+	}
+	return mejor
+}
+
+// Comisión de un turno y descripción de cómo se calculó
+func calcularComision(r *ReglaComision, base, ventasMes Dinero) (Dinero, string) {
+	if r == nil {
+		return 0, "sin regla"
+	}
+	switch r.Tipo {
+	case "fijo":
+		return r.Valor, "fijo " + r.Valor.Formato()
+	case "escalonado":
+		porcentaje := 0.0
+		for _, t := range r.Tramos { // ordenados por Desde
+			if ventasMes >= t.Desde {
+				porcentaje = t.Porcentaje
+			}
+		}
+		return base.Porcentaje(porcentaje), fmt.Sprintf("escalonado %g%% (ventas del mes %s)", porcentaje, ventasMes.Formato())
+	default:
+		return base.Porcentaje(r.Valor.Float64()), fmt.Sprintf("%g%%", r.Valor.Float64())
+	}
+}
+
+// Indica si el turno cae en un período ya liquidado de su empleado
+func turnoLiquidado(q ejecutor, turnoID int) (bool, error) {
+	var liquidado bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM turnos t JOIN liquidaciones l
+		               ON l.empleado_id = t.empleado_id AND t.fecha BETWEEN l.desde AND l.hasta
+		               WHERE t.id = $1)`, turnoID).Scan(&liquidado)
+	return liquidado, err
+}
+
+func periodoLiquidado(q ejecutor, empleadoID int, fecha string) (bool, error) {
+	var liquidado bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM liquidaciones WHERE empleado_id = $1 AND $2::date BETWEEN desde AND hasta)`,
+		empleadoID, fecha).Scan(&liquidado)
+	return liquidado, err
+}
+
+// Calcula la liquidación de los turnos completados del período que todavía no se liquidaron
+func calcularLiquidacion(q ejecutor, empleadoID int, desde, hasta string) (Liquidacion, error) {
+	l := Liquidacion{EmpleadoID: empleadoID, Desde: desde, Hasta: hasta, Items: []ItemLiquidacion{}}
+	if err := q.QueryRow("SELECT nombre FROM empleados WHERE id=$1", empleadoID).Scan(&l.Empleado); err != nil {
+		return l, err
+	}
+
+	rows, err := q.Query("SELECT "+columnasReglaComision+" FROM reglas_comision WHERE activo AND (empleado_id IS NULL OR empleado_id = $1) ORDER BY id", empleadoID)
+	if err != nil {
+		return l, err
+	}
+	var reglas []ReglaComision
+	for rows.Next() {
+		var r ReglaComision
+		if err := scanReglaComision(rows, &r); err != nil {
+			rows.Close()
+			return l, err
+		}
+		reglas = append(reglas, r)
+	}
+	rows.Close()
+
+	// Ventas de cada mes completo (para las reglas escalonadas)
+	rows, err = q.Query(`
+		SELECT TO_CHAR(fecha, 'YYYY-MM'), SUM(COALESCE(precio_final, 0)) FROM turnos
+		WHERE empleado_id = $1 AND estado = 'completado'
+		  AND fecha >= date_trunc('month', $2::date) AND fecha < date_trunc('month', $3::date) + INTERVAL '1 month'
+		GROUP BY 1`, empleadoID, desde, hasta)
+	if err != nil {
+		return l, err
+	}
+	ventasMes := map[string]Dinero{}
+	for rows.Next() {
+		var mes string
+		var ventas Dinero
+		if err := rows.Scan(&mes, &ventas); err != nil {
+			rows.Close()
+			return l, err
+		}
+		ventasMes[mes] = ventas
+	}
+	rows.Close()
+
+	rows, err = q.Query(`
+		SELECT t.id, TO_CHAR(t.fecha, 'YYYY-MM-DD'), s.nombre, t.servicio_id, COALESCE(t.precio_final, 0),
+		       (SELECT COALESCE(SUM(p.propina), 0) FROM pagos p WHERE p.turno_id = t.id)
+		FROM turnos t JOIN servicios s ON s.id = t.servicio_id
+		WHERE t.empleado_id = $1 AND t.estado = 'completado' AND t.fecha BETWEEN $2 AND $3
+		  AND NOT EXISTS (SELECT 1 FROM liquidacion_items li WHERE li.turno_id = t.id)
+		ORDER BY t.fecha, t.hora_inicio`, empleadoID, desde, hasta)
+	if err != nil {
+		return l, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it ItemLiquidacion
+		var servicioID int
+		if err := rows.Scan(&it.TurnoID, &it.Fecha, &it.Servicio, &servicioID, &it.Base, &it.Propinas); err != nil {
+			return l, err
+		}
+		it.Comision, it.Regla = calcularComision(reglaComisionPara(reglas, servicioID), it.Base, ventasMes[it.Fecha[:7]])
+
+		l.Items = append(l.Items, it)
+		l.TotalVentas += it.Base
+		l.TotalComision += it.Comision
+		l.TotalPropinas += it.Propinas
+	}
+	l.Total = l.TotalComision + l.TotalPropinas
+	return l, rows.Err()
+}
+
+func validarReglaComision(r *ReglaComision) error {
+	switch r.Tipo {
+	case "porcentaje":
+		if r.Valor <= 0 || r.Valor > pesos(100) {
+			return errors.New("valor debe ser un porcentaje entre 0 y 100")
+		}
+	case "fijo":
+		if r.Valor <= 0 {
+			return errors.New("valor debe ser mayor a 0")
+		}
+	case "escalonado":
+		if len(r.Tramos) == 0 {
+			return errors.New("tramos es requerido en las reglas escalonadas")
+		}
+		for _, t := range r.Tramos {
+			if t.Desde < 0 || t.Porcentaje < 0 || t.Porcentaje > 100 {
+				return errors.New("tramos: desde no negativo y porcentaje entre 0 y 100")
+			}
+		}
+		sort.Slice(r.Tramos, func(i, j int) bool { return r.Tramos[i].Desde < r.Tramos[j].Desde })
+	default:
+		return errors.New("tipo inválido: usar porcentaje, fijo o escalonado")
+	}
+	if r.Tramos == nil {
+		r.Tramos = []TramoComision{}
+	}
+	return nil
+}
+
+// Listar reglas de comisión
+func getReglasComision(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT " + columnasReglaComision + " FROM reglas_comision ORDER BY empleado_id NULLS FIRST, servicio_id NULLS FIRST, id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reglas := []ReglaComision{}
+	for rows.Next() {
+		var r ReglaComision
+		if err := scanReglaComision(rows, &r); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reglas = append(reglas, r)
+	}
+
+	c.JSON(http.StatusOK, reglas)
+}
+
+// Crear regla de comisión
+func createReglaComision(c *gin.Context, db *sql.DB) {
+	r := ReglaComision{Activo: true}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarReglaComision(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tramos, _ := json.Marshal(r.Tramos)
+	err := db.QueryRow(`INSERT INTO reglas_comision (empleado_id, servicio_id, tipo, valor, tramos, activo)
+	                    VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		r.EmpleadoID, r.ServicioID, r.Tipo, r.Valor, tramos, r.Activo).Scan(&r.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// Actualizar regla de comisión (no cambia las liquidaciones cerradas)
+func updateReglaComision(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	r := ReglaComision{Activo: true}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarReglaComision(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tramos, _ := json.Marshal(r.Tramos)
+	res, err := db.Exec(`UPDATE reglas_comision SET empleado_id=$1, servicio_id=$2, tipo=$3, valor=$4, tramos=$5, activo=$6 WHERE id=$7`,
+		r.EmpleadoID, r.ServicioID, r.Tipo, r.Valor, tramos, r.Activo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "regla no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "regla actualizada"})
+}
+
+// Borrar regla de comisión
+func deleteReglaComision(c *gin.Context, db *sql.DB) {
+	res, err := db.Exec("DELETE FROM reglas_comision WHERE id=$1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "regla no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "regla eliminada"})
+}
+
+// Lee :id, desde y hasta (YYYY-MM-DD)
+func paramsLiquidacion(c *gin.Context, desde, hasta string) (int, bool) {
+	empleadoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return 0, false
+	}
+	if desde == "" || hasta == "" || desde > hasta {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "desde y hasta son requeridos (desde <= hasta)"})
+		return 0, false
+	}
+	return empleadoID, true
+}
+
+// GET /empleados/:id/liquidacion?desde=2025-09-01&hasta=2025-09-30  (vista previa, sin cerrar)
+func getLiquidacionEmpleado(c *gin.Context, db *sql.DB) {
+	desde, hasta := c.Query("desde"), c.Query("hasta")
+	empleadoID, ok := paramsLiquidacion(c, desde, hasta)
+	if !ok {
+		return
+	}
+
+	l, err := calcularLiquidacion(db, empleadoID, desde, hasta)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "empleado no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, l)
+}
+
+// POST /empleados/:id/liquidaciones  { "desde": "2025-09-01", "hasta": "2025-09-30" }
+func cerrarLiquidacion(c *gin.Context, db *sql.DB) {
+	var body struct {
+		Desde string `json:"desde"`
+		Hasta string `json:"hasta"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	empleadoID, ok := paramsLiquidacion(c, body.Desde, body.Hasta)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Bloquear al empleado serializa los cierres de sus liquidaciones
+	var tmp int
+	if err := tx.QueryRow("SELECT id FROM empleados WHERE id=$1 FOR UPDATE", empleadoID).Scan(&tmp); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "empleado no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var superpuesta bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM liquidaciones WHERE empleado_id=$1 AND desde <= $3 AND hasta >= $2)`,
+		empleadoID, body.Desde, body.Hasta).Scan(&superpuesta)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if superpuesta {
+		c.JSON(http.StatusConflict, gin.H{"error": "el período se superpone con una liquidación ya cerrada"})
+		return
+	}
+
+	l, err := calcularLiquidacion(tx, empleadoID, body.Desde, body.Hasta)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = tx.QueryRow(`INSERT INTO liquidaciones (empleado_id, desde, hasta, total_ventas, total_comision, total_propinas, total)
+	                   VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, cerrada_en`,
+		empleadoID, l.Desde, l.Hasta, l.TotalVentas, l.TotalComision, l.TotalPropinas, l.Total).Scan(&l.ID, &l.CerradaEn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, it := range l.Items {
+		_, err := tx.Exec(`INSERT INTO liquidacion_items (liquidacion_id, turno_id, fecha, servicio, base, regla, comision, propinas)
+		                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			l.ID, it.TurnoID, it.Fecha, it.Servicio, it.Base, it.Regla, it.Comision, it.Propinas)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, l)
+}
+
+const columnasLiquidacion = `l.id, l.empleado_id, e.nombre, TO_CHAR(l.desde, 'YYYY-MM-DD'), TO_CHAR(l.hasta, 'YYYY-MM-DD'),
+	l.total_ventas, l.total_comision, l.total_propinas, l.total, l.cerrada_en`
+
+const fromLiquidaciones = ` FROM liquidaciones l JOIN empleados e ON e.id = l.empleado_id`
+
+func scanLiquidacion(sc scanner, l *Liquidacion) error {
+	return sc.Scan(&l.ID, &l.EmpleadoID, &l.Empleado, &l.Desde, &l.Hasta,
+		&l.TotalVentas, &l.TotalComision, &l.TotalPropinas, &l.Total, &l.CerradaEn)
+}
+
+// GET /empleados/:id/liquidaciones  (cerradas, sin detalle)
+func getLiquidacionesEmpleado(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT "+columnasLiquidacion+fromLiquidaciones+" WHERE l.empleado_id=$1 ORDER BY l.desde DESC", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	liquidaciones := []Liquidacion{}
+	for rows.Next() {
+		var l Liquidacion
+		if err := scanLiquidacion(rows, &l); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		liquidaciones = append(liquidaciones, l)
+	}
+
+	c.JSON(http.StatusOK, liquidaciones)
+}
+
+// GET /liquidaciones/:id  (con el detalle guardado al cerrar)
+func getLiquidacion(c *gin.Context, db *sql.DB) {
+	var l Liquidacion
+	err := scanLiquidacion(db.QueryRow("SELECT "+columnasLiquidacion+fromLiquidaciones+" WHERE l.id=$1", c.Param("id")), &l)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "liquidación no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	rows, err := db.Query(`SELECT turno_id, TO_CHAR(fecha, 'YYYY-MM-DD'), servicio, base, regla, comision, propinas
+	                       FROM liquidacion_items WHERE liquidacion_id=$1 ORDER BY fecha, id`, l.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	l.Items = []ItemLiquidacion{}
+	for rows.Next() {
+		var it ItemLiquidacion
+		if err := rows.Scan(&it.TurnoID, &it.Fecha, &it.Servicio, &it.Base, &it.Regla, &it.Comision, &it.Propinas); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		l.Items = append(l.Items, it)
+	}
+
+	c.JSON(http.StatusOK, l)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// Comprobantes de pago en PDF. Se emiten una sola vez por turno: el PDF se guarda en
+// la tabla comprobantes y las re-descargas devuelven exactamente el mismo archivo.
+
+// Próximo número de un numerador. Dentro de una transacción la fila queda bloqueada
+// hasta el commit y un rollback devuelve el número: la numeración no tiene huecos.
+func siguienteNumero(tx *sql.Tx, sucursal int, tipo string) (int, error) {
+	var numero int
+	err := tx.QueryRow(`INSERT INTO numeradores (sucursal, tipo, ultimo) VALUES ($1, $2, 1)
+	                    ON CONFLICT (sucursal, tipo) DO UPDATE SET ultimo = numeradores.ultimo + 1
+	                    RETURNING ultimo`, sucursal, tipo).Scan(&numero)
+	return numero, err
+}
+
+// "0001-00000042"
+func numeroComprobante(sucursal, numero int) string {
+	return fmt.Sprintf("%04d-%08d", sucursal, numero)
+}
+
+type datosComprobante struct {
+	Numero    string
+	Emitido   time.Time
+	Negocio   map[string]string
+	ClienteID int
+	Cliente   string
+	Email     string
+	Fecha     string
+	Hora      string
+	Servicio  string
+	Empleado  string
+
+	PrecioLista    Dinero
+	Ajustes        []AjustePrecio
+	Cupon          string
+	DescuentoCupon Dinero
+	Descuento      Dinero
+	PrecioFinal    Dinero
+	Pagos          []Pago
+	Pagado         Dinero
+	Saldo          Dinero
+}
+
+// Reúne los datos del turno para el comprobante. Bloquea el turno (FOR UPDATE).
+func cargarDatosComprobante(db *sql.DB, tx *sql.Tx, turnoID int) (datosComprobante, string, error) {
+	var d datosComprobante
+	var estado string
+	var ajustes []byte
+	err := tx.QueryRow(`
+		SELECT t.estado, TO_CHAR(t.fecha, 'DD/MM/YYYY'), TO_CHAR(t.hora_inicio, 'HH24:MI'),
+		       s.nombre, e.nombre || ' ' || e.apellido,
+		       c.id, c.nombre || ' ' || c.apellido, COALESCE(c.email, ''),
+		       t.precio_lista, t.descuento, t.precio_final, t.ajustes_precio
+		FROM turnos t
+		JOIN servicios s ON s.id = t.servicio_id
+		JOIN empleados e ON e.id = t.empleado_id
+		JOIN clientes c ON c.id = t.cliente_id
+		WHERE t.id = $1
+		FOR UPDATE OF t`, turnoID).
+		Scan(&estado, &d.Fecha, &d.Hora, &d.Servicio, &d.Empleado, &d.ClienteID, &d.Cliente, &d.Email,
+			&d.PrecioLista, &d.Descuento, &d.PrecioFinal, &ajustes)
+	if err != nil {
+		return d, "", err
+	}
+	if err := json.Unmarshal(ajustes, &d.Ajustes); err != nil {
+		return d, "", err
+	}
+
+	err = tx.QueryRow(`SELECT cu.codigo, cc.descuento FROM cupon_canjes cc JOIN cupones cu ON cu.id = cc.cupon_id
+	                   WHERE cc.turno_id = $1 AND cc.anulado_en IS NULL`, turnoID).Scan(&d.Cupon, &d.DescuentoCupon)
+	if err != nil && err != sql.ErrNoRows {
+		return d, "", err
+	}
+
+	if d.Pagos, err = listarPagos(tx, "p.turno_id = $1", turnoID); err != nil {
+		return d, "", err
+	}
+	if _, d.Pagado, d.Saldo, err = saldoTurno(tx, turnoID); err != nil {
+		return d, "", err
+	}
+
+	d.Negocio = map[string]string{}
+	for _, clave := range []string{"negocio_nombre", "negocio_cuit", "negocio_direccion", "negocio_telefono", "negocio_email"} {
+		d.Negocio[clave] = configString(db, clave)
+	}
+	return d, estado, nil
+}
+
+var nombresMetodo = map[string]string{
+	"efectivo":       "Efectivo",
+	"debito":         "Débito",
+	"transferencia":  "Transferencia",
+	"mercado_pago":   "Mercado Pago",
+	"paquete":        "Paquete prepago",
+	"tarjeta_regalo": "Tarjeta de regalo",
+}
+
+func generarPDFComprobante(d datosComprobante) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // cp1252: tildes y ñ en las fuentes estándar
+	pdf.SetTitle("Comprobante "+d.Numero, true)
+	pdf.SetCreationDate(d.Emitido)
+	pdf.AddPage()
+
+	// Encabezado: negocio y número
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(120, 8, tr(d.Negocio["negocio_nombre"]), "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, tr("Comprobante N° "+d.Numero), "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, linea := range []string{
+		d.Negocio["negocio_direccion"],
+		"CUIT: " + d.Negocio["negocio_cuit"],
+		d.Negocio["negocio_telefono"] + "  " + d.Negocio["negocio_email"],
+	} {
+		pdf.CellFormat(120, 5, tr(linea), "", 0, "L", false, 0, "")
+		pdf.Ln(5)
+	}
+	pdf.CellFormat(0, 5, tr("Emitido: "+d.Emitido.Format("02/01/2006 15:04")), "", 1, "R", false, 0, "")
+	pdf.Line(10, pdf.GetY()+2, 200, pdf.GetY()+2)
+	pdf.Ln(6)
+
+	// Cliente y turno
+	pdf.SetFont("Helvetica", "", 10)
+	cliente := "Cliente: " + d.Cliente
+	if d.ClienteID > 0 { // los clientes anonimizados tienen id negativo, sin DNI
+		cliente += fmt.Sprintf(" (DNI %d)", d.ClienteID)
+	}
+	pdf.CellFormat(0, 6, tr(cliente), "", 1, "L", false, 0, "")
+	if d.Email != "" {
+		pdf.CellFormat(0, 6, tr("Email: "+d.Email), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 6, tr(fmt.Sprintf("Turno: %s %s hs con %s", d.Fecha, d.Hora, d.Empleado)), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	fila := func(detalle string, monto Dinero, negrita bool) {
+		estilo := ""
+		if negrita {
+			estilo = "B"
+		}
+		pdf.SetFont("Helvetica", estilo, 10)
+		pdf.CellFormat(140, 7, tr(detalle), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(50, 7, tr(monto.Formato()), "B", 1, "R", false, 0, "")
+	}
+
+	// Detalle del precio
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, "Detalle", "", 1, "L", false, 0, "")
+	base := d.PrecioLista
+	for _, a := range d.Ajustes {
+		base -= a.Monto
+	}
+	fila(d.Servicio, base, false)
+	for _, a := range d.Ajustes {
+		fila("  "+a.Nombre, a.Monto, false)
+	}
+	if d.DescuentoCupon > 0 {
+		fila("  Cupón "+d.Cupon, -d.DescuentoCupon, false)
+	}
+	if puntos := d.Descuento - d.DescuentoCupon; puntos > 0 {
+		fila("  Canje de puntos", -puntos, false)
+	}
+	fila("Total", d.PrecioFinal, true)
+	pdf.Ln(4)
+
+	// Pagos
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, "Pagos", "", 1, "L", false, 0, "")
+	for _, p := range d.Pagos {
+		detalle := p.CreadoEn.Format("02/01/2006") + "  " + nombresMetodo[p.Metodo]
+		if p.Tipo == "reintegro" {
+			detalle += " (reintegro)"
+		}
+		if p.Referencia != "" {
+			detalle += "  Ref. " + p.Referencia
+		}
+		fila(detalle, p.Monto, false)
+	}
+	fila("Pagado", d.Pagado, true)
+	if d.Saldo != 0 {
+		fila("Saldo pendiente", d.Saldo, true)
+	}
+
+	pdf.Ln(8)
+	pdf.SetFont("Helvetica", "I", 8)
+	pdf.CellFormat(0, 5, tr("Documento no válido como factura."), "", 1, "C", false, 0, "")
+
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	return buf.Bytes(), err
+}
+
+// GET /turnos/:id/comprobante
+func getComprobante(c *gin.Context, db *sql.DB) {
+	turnoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	d, estado, err := cargarDatosComprobante(db, tx, turnoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "turno no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Ya emitido: se devuelve el mismo archivo
+	var sucursal, numero int
+	var pdf []byte
+	err = tx.QueryRow("SELECT sucursal, numero, pdf FROM comprobantes WHERE turno_id=$1", turnoID).Scan(&sucursal, &numero, &pdf)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err == sql.ErrNoRows {
+		if estado != "completado" {
+			c.JSON(http.StatusConflict, gin.H{"error": "solo se emiten comprobantes de turnos completados"})
+			return
+		}
+
+		sucursal = configInt(db, "negocio_sucursal")
+		if numero, err = siguienteNumero(tx, sucursal, "comprobante"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		d.Numero = numeroComprobante(sucursal, numero)
+		d.Emitido = time.Now()
+
+		if pdf, err = generarPDFComprobante(d); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_, err = tx.Exec(`INSERT INTO comprobantes (turno_id, sucursal, numero, pdf, creado_en) VALUES ($1, $2, $3, $4, $5)`,
+			turnoID, sucursal, numero, pdf, d.Emitido)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=comprobante_%s.pdf", numeroComprobante(sucursal, numero)))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Confiabilidad de un cliente según su historial reciente
+type Confiabilidad struct {
+	ClienteID            int           `json:"cliente_id"`
+	Puntaje              int           `json:"puntaje"` // 0 a 100
+	VentanaDias          int           `json:"ventana_dias"`
+	Completados          int           `json:"completados"`
+	NoShows              int           `json:"no_shows"`
+	CancelacionesTardias int           `json:"cancelaciones_tardias"`
+	Restricciones        Restricciones `json:"restricciones"`
+}
+
+// Restricciones de reserva que se derivan de las ausencias del cliente
+type Restricciones struct {
+	RequiereSena      bool `json:"requiere_sena"`
+	UnSoloTurnoActivo bool `json:"un_solo_turno_activo"`
+	BloqueoOnline     bool `json:"bloqueo_online"`
+	Excepcion         bool `json:"excepcion"` // el personal levantó las restricciones
+}
+
+func calcularConfiabilidad(db *sql.DB, clienteID int) (Confiabilidad, error) {
+	conf := Confiabilidad{
+		ClienteID:   clienteID,
+		VentanaDias: configInt(db, "confiabilidad_ventana_dias"),
+	}
+
+	err := db.QueryRow(`SELECT excepcion_restricciones FROM clientes WHERE id=$1`, clienteID).
+		Scan(&conf.Restricciones.Excepcion)
+	if err != nil {
+		return conf, err
+	}
+
+	// Cancelación tardía: con menos de N horas de anticipación al inicio del turno,
+	// sin contar las que canceló el local o la seña vencida
+	err = db.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE estado = 'completado'),
+			COUNT(*) FILTER (WHERE estado = 'no_show'),
+			COUNT(*) FILTER (WHERE estado = 'cancelado' AND cancelado_en IS NOT NULL AND `+cancelacionDelCliente("motivo_cancelacion")+`
+			                 AND cancelado_en > (fecha + hora_inicio::time) - make_interval(hours => $3))
+		FROM turnos
+		WHERE cliente_id = $1 AND fecha >= CURRENT_DATE - $2::int AND fecha <= CURRENT_DATE`,
+		clienteID, conf.VentanaDias, configInt(db, "cancelacion_tardia_horas")).
+		Scan(&conf.Completados, &conf.NoShows, &conf.CancelacionesTardias)
+	if err != nil {
+		return conf, err
+	}
+
+	// Proporción de turnos cumplidos; una cancelación tardía pesa media ausencia
+	conf.Puntaje = 100
+	malos := float64(conf.NoShows) + 0.5*float64(conf.CancelacionesTardias)
+	if total := float64(conf.Completados) + malos; total > 0 {
+		conf.Puntaje = int(math.Round(100 * float64(conf.Completados) / total))
+	}
+
+	if !conf.Restricciones.Excepcion {
+		alcanza := func(clave string) bool {
+			limite := configInt(db, clave)
+			return limite > 0 && conf.NoShows >= limite
+		}
+		conf.Restricciones.RequiereSena = alcanza("noshow_requiere_sena")
+		conf.Restricciones.UnSoloTurnoActivo = alcanza("noshow_un_turno_activo")
+		conf.Restricciones.BloqueoOnline = alcanza("noshow_bloqueo_online")
+	}
+
+	return conf, nil
+}
+
+// Aplica las restricciones por ausencias a un turno nuevo.
+// El error explica por qué se rechaza la reserva.
+func validarRestriccionesCliente(db *sql.DB, t Turno) error {
+	conf, err := calcularConfiabilidad(db, t.ClienteID)
+	if err != nil {
+		return err
+	}
+	r := conf.Restricciones
+	motivo := fmt.Sprintf("el cliente registra %d ausencias en los últimos %d días", conf.NoShows, conf.VentanaDias)
+
+	if t.Origen == "online" && r.BloqueoOnline {
+		return fmt.Errorf("reserva online rechazada: %s; debe reservar en el local", motivo)
+	}
+
+	// RequiereSena no rechaza la reserva: el turno queda pendiente_pago (ver senaRequerida)
+
+	if r.UnSoloTurnoActivo {
+		var fecha string
+		err := db.QueryRow(`
+			SELECT TO_CHAR(fecha, 'DD/MM/YYYY') FROM turnos
+			WHERE cliente_id = $1 AND estado IN ('pendiente', 'pendiente_pago', 'confirmado')
+			AND (fecha + hora_inicio::time) >= NOW() AND id != $2
+			ORDER BY fecha LIMIT 1`, t.ClienteID, t.ID).Scan(&fecha)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			return fmt.Errorf("reserva rechazada: %s y solo puede tener un turno activo (ya tiene uno el %s)", motivo, fecha)
+		}
+	}
+
+	return nil
+}
+
+// GET /clientes/:id/confiabilidad
+func getConfiabilidadCliente(c *gin.Context, db *sql.DB) {
+	var id int
+	err := db.QueryRow("SELECT id FROM clientes WHERE id=$1", c.Param("id")).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	conf, err := calcularConfiabilidad(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, conf)
+}
+
+// PUT /clientes/:id/excepcion  { "excepcion": true }
+// Permite al personal levantar (o volver a aplicar) las restricciones de un cliente.
+func updateExcepcionCliente(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var body struct {
+		Excepcion bool `json:"excepcion"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec("UPDATE clientes SET excepcion_restricciones=$1 WHERE id=$2", body.Excepcion, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "excepción actualizada"})
+}
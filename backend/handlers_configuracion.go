@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de la configuración del negocio.
+// Solo se aceptan claves conocidas; lo guardado en la tabla configuracion pisa estos valores.
+var configDefaults = map[string]string{
+	// Confiabilidad de clientes (ausencias y cancelaciones tardías)
+	"confiabilidad_ventana_dias": "180", // historial considerado
+	"cancelacion_tardia_horas":   "24",  // cancelar con menos anticipación cuenta como tardía
+	"noshow_requiere_sena":       "2",   // ausencias para exigir seña (0 = desactivado)
+	"noshow_un_turno_activo":     "3",   // ausencias para limitar a un turno activo
+	"noshow_bloqueo_online":      "4",   // ausencias para bloquear la reserva online
+
+	// Programa de puntos
+	"puntos_por_cada":         "100", // pesos de precio por cada punto acreditado
+	"puntos_valor":            "10",  // pesos de descuento por punto canjeado
+	"puntos_vencimiento_dias": "365",
+
+	// Señas
+	"sena_porcentaje":          "30", // seña exigida por ausencias, sobre el precio del turno
+	"sena_vencimiento_minutos": "30", // plazo para pagar antes de liberar el turno
+
+	// Datos del negocio (comprobantes)
+	"negocio_nombre":    "",
+	"negocio_cuit":      "",
+	"negocio_direccion": "",
+	"negocio_telefono":  "",
+	"negocio_email":     "",
+	"negocio_sucursal":  "1", // numeración de comprobantes por sucursal
+
+	// Facturación electrónica
+	"negocio_condicion_iva": "monotributo", // responsable_inscripto, monotributo, exento
+	"negocio_punto_venta":   "1",           // punto de venta habilitado en ARCA
+
+	// Paquetes y tarjetas de regalo
+	"prepago_reintegro_cancelacion_tardia": "0",   // 1 = reintegrar créditos y saldo también en cancelaciones tardías
+	"tarjeta_regalo_vigencia_dias":         "365", // vigencia por defecto de una tarjeta nueva
+
+	// Membresías
+	"membresia_gracia_dias": "7", // días para pagar cada período antes de que la membresía venza
+
+	// Reservas online
+	"reserva_online_anticipacion_dias": "0", // máximo de días de anticipación (0 = sin límite); los miembros suman los de su plan
+}
+
+// Claves numéricas y su rango válido. Las demás se guardan como texto libre.
+var configEnteros = map[string]struct{ min, max int }{
+	"confiabilidad_ventana_dias":           {1, math.MaxInt32},
+	"cancelacion_tardia_horas":             {0, math.MaxInt32},
+	"noshow_requiere_sena":                 {0, math.MaxInt32},
+	"noshow_un_turno_activo":               {0, math.MaxInt32},
+	"noshow_bloqueo_online":                {0, math.MaxInt32},
+	"puntos_por_cada":                      {0, math.MaxInt32}, // 0 = sin acreditación por precio
+	"puntos_valor":                         {0, math.MaxInt32},
+	"puntos_vencimiento_dias":              {1, math.MaxInt32},
+	"sena_porcentaje":                      {0, 100},
+	"sena_vencimiento_minutos":             {1, math.MaxInt32},
+	"negocio_sucursal":                     {1, 9999},
+	"negocio_punto_venta":                  {1, 99999},
+	"prepago_reintegro_cancelacion_tardia": {0, 1},
+	"tarjeta_regalo_vigencia_dias":         {1, math.MaxInt32},
+	"membresia_gracia_dias":                {0, math.MaxInt32},
+	"reserva_online_anticipacion_dias":     {0, math.MaxInt32},
+}
+
+func validarConfig(clave, valor string) error {
+	if _, ok := configDefaults[clave]; !ok {
+		return fmt.Errorf("clave de configuración desconocida: %s", clave)
+	}
+	rango, ok := configEnteros[clave]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(valor)
+	if err != nil {
+		return fmt.Errorf("%s debe ser un número entero", clave)
+	}
+	if n < rango.min || n > rango.max {
+		if rango.max == math.MaxInt32 {
+			return fmt.Errorf("%s debe ser mayor o igual a %d", clave, rango.min)
+		}
+		return fmt.Errorf("%s debe estar entre %d y %d", clave, rango.min, rango.max)
+	}
+	return nil
+}
+
+func configString(db ejecutor, clave string) string {
+	var valor string
+	err := db.QueryRow("SELECT valor FROM configuracion WHERE clave=$1", clave).Scan(&valor)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error leyendo configuración:", clave, err)
+		}
+		return configDefaults[clave]
+	}
+	return valor
+}
+
+func configInt(db ejecutor, clave string) int {
+	n, err := strconv.Atoi(configString(db, clave))
+	if err != nil {
+		n, _ = strconv.Atoi(configDefaults[clave])
+	}
+	return n
+}
+
+// GET /configuracion
+func getConfiguracion(c *gin.Context, db *sql.DB) {
+	config := map[string]string{}
+	for clave, valor := range configDefaults {
+		config[clave] = valor
+	}
+
+	rows, err := db.Query("SELECT clave, valor FROM configuracion")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clave, valor string
+		if err := rows.Scan(&clave, &valor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		config[clave] = valor
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// PUT /configuracion  { "noshow_requiere_sena": "3", ... }
+func updateConfiguracion(c *gin.Context, db *sql.DB) {
+	var body map[string]string
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for clave, valor := range body {
+		if err := validarConfig(clave, valor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	for clave, valor := range body {
+		_, err := tx.Exec(`INSERT INTO configuracion (clave, valor) VALUES ($1, $2)
+		                   ON CONFLICT (clave) DO UPDATE SET valor = EXCLUDED.valor`, clave, valor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "configuración actualizada"})
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestValidarConfig(t *testing.T) {
+	casos := []struct {
+		clave, valor string
+		ok           bool
+	}{
+		{"noshow_requiere_sena", "3", true},
+		{"noshow_requiere_sena", "0", true},
+		{"noshow_requiere_sena", "-1", false},
+		{"noshow_requiere_sena", "dos", false},
+		{"noshow_requiere_sena", "", false},
+		{"noshow_requiere_sena", "2.5", false},
+		{"sena_porcentaje", "100", true},
+		{"sena_porcentaje", "101", false},
+		{"sena_vencimiento_minutos", "0", false},
+		{"prepago_reintegro_cancelacion_tardia", "1", true},
+		{"prepago_reintegro_cancelacion_tardia", "2", false},
+		{"negocio_punto_venta", "100000", false},
+		{"puntos_vencimiento_dias", "99999999999", false},
+		{"negocio_nombre", "Barbería Centro", true},
+		{"negocio_cuit", "", true},
+		{"clave_inventada", "1", false},
+	}
+	for _, c := range casos {
+		err := validarConfig(c.clave, c.valor)
+		if (err == nil) != c.ok {
+			t.Errorf("validarConfig(%q, %q): error = %v, se esperaba ok = %v", c.clave, c.valor, err, c.ok)
+		}
+	}
+	for clave := range configEnteros {
+		if err := validarConfig(clave, configDefaults[clave]); err != nil {
+			t.Errorf("el valor por defecto de %s no es válido: %v", clave, err)
+		}
+	}
+}
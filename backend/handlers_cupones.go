@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Cupones: códigos promocionales que se aplican al reservar (POST /turnos con codigo_cupon).
+// Cada uso queda en cupon_canjes; si el turno se cancela o se borra el uso se anula y se libera.
+
+const columnasCupon = `id, codigo, campania, descripcion, tipo, valor,
+	TO_CHAR(vigente_desde, 'YYYY-MM-DD'), TO_CHAR(vigente_hasta, 'YYYY-MM-DD'),
+	dias_semana, servicios, usos_max, usos_por_cliente, acumulable, activo,
+	(SELECT COUNT(*) FROM cupon_canjes cc WHERE cc.cupon_id = cupones.id AND cc.anulado_en IS NULL)`
+
+func scanCupon(sc scanner, cu *Cupon) error {
+	return sc.Scan(&cu.ID, &cu.Codigo, &cu.Campania, &cu.Descripcion, &cu.Tipo, &cu.Valor,
+		&cu.VigenteDesde, &cu.VigenteHasta, pq.Array(&cu.DiasSemana), pq.Array(&cu.Servicios),
+		&cu.UsosMax, &cu.UsosPorCliente, &cu.Acumulable, &cu.Activo, &cu.Usos)
+}
+
+var diasSemana = [...]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"}
+
+func contiene(lista []int64, v int64) bool {
+	for _, x := range lista {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Valida el cupón del turno y registra el canje. Devuelve el importe del descuento.
+// Debe llamarse dentro de la transacción que crea el turno (t.ID ya asignado).
+func canjearCupon(tx *sql.Tx, t *Turno) (Dinero, error) {
+	var cu Cupon
+	// FOR UPDATE: dos reservas simultáneas no pueden pasarse del límite de usos
+	err := scanCupon(tx.QueryRow("SELECT "+columnasCupon+" FROM cupones WHERE codigo = UPPER(TRIM($1)) FOR UPDATE", t.CodigoCupon), &cu)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("cupón %s inválido", t.CodigoCupon)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !cu.Activo {
+		return 0, fmt.Errorf("el cupón %s no está activo", cu.Codigo)
+	}
+	hoy := time.Now().Format("2006-01-02")
+	if cu.VigenteDesde != nil && t.Fecha < *cu.VigenteDesde {
+		return 0, fmt.Errorf("el cupón %s vale para turnos desde el %s", cu.Codigo, *cu.VigenteDesde)
+	}
+	if cu.VigenteHasta != nil && (t.Fecha > *cu.VigenteHasta || hoy > *cu.VigenteHasta) {
+		return 0, fmt.Errorf("el cupón %s venció el %s", cu.Codigo, *cu.VigenteHasta)
+	}
+	if len(cu.DiasSemana) > 0 {
+		fecha, err := time.Parse("2006-01-02", t.Fecha)
+		if err != nil {
+			return 0, err
+		}
+		dia := int64(fecha.Weekday())
+		if dia == 0 {
+			dia = 7
+		}
+		if !contiene(cu.DiasSemana, dia) {
+			return 0, fmt.Errorf("el cupón %s no vale para turnos del día %s", cu.Codigo, diasSemana[fecha.Weekday()])
+		}
+	}
+	if len(cu.Servicios) > 0 && !contiene(cu.Servicios, int64(t.ServicioID)) {
+		return 0, fmt.Errorf("el cupón %s no vale para este servicio", cu.Codigo)
+	}
+	if !cu.Acumulable && t.PuntosCanje > 0 {
+		return 0, fmt.Errorf("el cupón %s no es acumulable con el canje de puntos", cu.Codigo)
+	}
+
+	if cu.UsosMax != nil && cu.Usos >= *cu.UsosMax {
+		return 0, fmt.Errorf("el cupón %s alcanzó su límite de usos", cu.Codigo)
+	}
+	if cu.UsosPorCliente != nil {
+		var usosCliente int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM cupon_canjes WHERE cupon_id=$1 AND cliente_id=$2 AND anulado_en IS NULL`,
+			cu.ID, t.ClienteID).Scan(&usosCliente)
+		if err != nil {
+			return 0, err
+		}
+		if usosCliente >= *cu.UsosPorCliente {
+			return 0, fmt.Errorf("el cliente ya usó el cupón %s el máximo de veces permitido", cu.Codigo)
+		}
+	}
+
+	descuento := cu.Valor
+	if cu.Tipo == "porcentaje" {
+		descuento = t.PrecioLista.Porcentaje(cu.Valor.Float64())
+	}
+	if descuento > t.PrecioFinal {
+		descuento = t.PrecioFinal
+	}
+
+	_, err = tx.Exec(`INSERT INTO cupon_canjes (cupon_id, turno_id, cliente_id, descuento) VALUES ($1, $2, $3, $4)`,
+		cu.ID, t.ID, t.ClienteID, descuento)
+	if err != nil {
+		return 0, err
+	}
+	t.CodigoCupon = cu.Codigo
+	return descuento, nil
+}
+
+// Anula el canje de cupón de un turno cancelado o borrado, liberando el uso
+func anularCanjeCupon(q ejecutor, turnoID int) error {
+	_, err := q.Exec(`UPDATE cupon_canjes SET anulado_en = NOW() WHERE turno_id = $1 AND anulado_en IS NULL`, turnoID)
+	return err
+}
+
+func validarCupon(cu *Cupon) error {
+	cu.Codigo = strings.ToUpper(strings.TrimSpace(cu.Codigo))
+	if cu.Codigo == "" || strings.ContainsAny(cu.Codigo, " \t") {
+		return errors.New("codigo es requerido y no puede tener espacios")
+	}
+	if cu.Tipo != "porcentaje" && cu.Tipo != "monto" {
+		return errors.New("tipo inválido: usar porcentaje o monto")
+	}
+	if cu.Valor <= 0 {
+		return errors.New("valor debe ser mayor a 0")
+	}
+	if cu.Tipo == "porcentaje" && cu.Valor > pesos(100) {
+		return errors.New("el porcentaje no puede superar 100")
+	}
+	if cu.VigenteDesde != nil && cu.VigenteHasta != nil && *cu.VigenteHasta < *cu.VigenteDesde {
+		return errors.New("vigente_hasta es anterior a vigente_desde")
+	}
+	for _, d := range cu.DiasSemana {
+		if d < 1 || d > 7 {
+			return errors.New("dias_semana: usar 1 (lunes) a 7 (domingo)")
+		}
+	}
+	if (cu.UsosMax != nil && *cu.UsosMax < 1) || (cu.UsosPorCliente != nil && *cu.UsosPorCliente < 1) {
+		return errors.New("los límites de usos deben ser mayores a 0")
+	}
+	if cu.DiasSemana == nil {
+		cu.DiasSemana = []int64{}
+	}
+	if cu.Servicios == nil {
+		cu.Servicios = []int64{}
+	}
+	return nil
+}
+
+// GET /cupones?campania=verano
+func getCupones(c *gin.Context, db *sql.DB) {
+	query := "SELECT " + columnasCupon + " FROM cupones"
+	var args []interface{}
+	if campania := c.Query("campania"); campania != "" {
+		query += " WHERE campania = $1"
+		args = append(args, campania)
+	}
+
+	rows, err := db.Query(query+" ORDER BY creado_en DESC, id DESC", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	cupones := []Cupon{}
+	for rows.Next() {
+		var cu Cupon
+		if err := scanCupon(rows, &cu); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cupones = append(cupones, cu)
+	}
+
+	c.JSON(http.StatusOK, cupones)
+}
+
+// Obtener cupón por ID
+func getCupon(c *gin.Context, db *sql.DB) {
+	var cu Cupon
+	err := scanCupon(db.QueryRow("SELECT "+columnasCupon+" FROM cupones WHERE id=$1", c.Param("id")), &cu)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cupón no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, cu)
+}
+
+// Crear cupón
+func createCupon(c *gin.Context, db *sql.DB) {
+	cu := Cupon{Activo: true}
+	if err := c.ShouldBindJSON(&cu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarCupon(&cu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `INSERT INTO cupones (codigo, campania, descripcion, tipo, valor, vigente_desde, vigente_hasta,
+	              dias_semana, servicios, usos_max, usos_por_cliente, acumulable, activo)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`
+	err := db.QueryRow(query, cu.Codigo, cu.Campania, cu.Descripcion, cu.Tipo, cu.Valor, cu.VigenteDesde, cu.VigenteHasta,
+		pq.Array(cu.DiasSemana), pq.Array(cu.Servicios), cu.UsosMax, cu.UsosPorCliente, cu.Acumulable, cu.Activo).Scan(&cu.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "ya existe un cupón con ese código"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cu)
+}
+
+// Actualizar cupón
+func updateCupon(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	cu := Cupon{Activo: true}
+	if err := c.ShouldBindJSON(&cu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarCupon(&cu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `UPDATE cupones SET codigo=$1, campania=$2, descripcion=$3, tipo=$4, valor=$5, vigente_desde=$6, vigente_hasta=$7,
+	              dias_semana=$8, servicios=$9, usos_max=$10, usos_por_cliente=$11, acumulable=$12, activo=$13
+	          WHERE id=$14`
+	res, err := db.Exec(query, cu.Codigo, cu.Campania, cu.Descripcion, cu.Tipo, cu.Valor, cu.VigenteDesde, cu.VigenteHasta,
+		pq.Array(cu.DiasSemana), pq.Array(cu.Servicios), cu.UsosMax, cu.UsosPorCliente, cu.Acumulable, cu.Activo, id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "ya existe un cupón con ese código"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cupón no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "cupón actualizado"})
+}
+
+// Borrar cupón: si ya se usó se desactiva para conservar los canjes
+func deleteCupon(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var usado bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM cupon_canjes WHERE cupon_id=$1)", id).Scan(&usado); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, status := "DELETE FROM cupones WHERE id=$1", "cupón eliminado"
+	if usado {
+		query, status = "UPDATE cupones SET activo=false WHERE id=$1", "cupón desactivado: tiene canjes registrados"
+	}
+
+	res, err := db.Exec(query, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cupón no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// GET /reportes/cupones?desde=2025-09-01&hasta=2025-09-30&campania=verano
+// Canjes por campaña y cupón. Los anulados (turno cancelado o borrado) se informan aparte.
+func getReporteCupones(c *gin.Context, db *sql.DB) {
+	conds := []string{"TRUE"}
+	var args []interface{}
+	if desde := c.Query("desde"); desde != "" {
+		args = append(args, desde)
+		conds = append(conds, fmt.Sprintf("cc.creado_en >= $%d::date", len(args)))
+	}
+	if hasta := c.Query("hasta"); hasta != "" {
+		args = append(args, hasta)
+		conds = append(conds, fmt.Sprintf("cc.creado_en < $%d::date + 1", len(args)))
+	}
+	if campania := c.Query("campania"); campania != "" {
+		args = append(args, campania)
+		conds = append(conds, fmt.Sprintf("cu.campania = $%d", len(args)))
+	}
+
+	rows, err := db.Query(`
+		SELECT cu.campania, cu.id, cu.codigo,
+		       COUNT(*) FILTER (WHERE cc.anulado_en IS NULL),
+		       COUNT(*) FILTER (WHERE cc.anulado_en IS NOT NULL),
+		       COUNT(DISTINCT cc.cliente_id) FILTER (WHERE cc.anulado_en IS NULL),
+		       COALESCE(SUM(cc.descuento) FILTER (WHERE cc.anulado_en IS NULL), 0)
+		FROM cupon_canjes cc
+		JOIN cupones cu ON cu.id = cc.cupon_id
+		WHERE `+strings.Join(conds, " AND ")+`
+		GROUP BY cu.campania, cu.id, cu.codigo
+		ORDER BY cu.campania, cu.codigo`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type cuponReporte struct {
+		CuponID   int    `json:"cupon_id"`
+		Codigo    string `json:"codigo"`
+		Canjes    int    `json:"canjes"`
+		Anulados  int    `json:"anulados"`
+		Clientes  int    `json:"clientes"`
+		Descuento Dinero `json:"descuento"`
+	}
+	type campaniaReporte struct {
+		Campania  string         `json:"campania"`
+		Canjes    int            `json:"canjes"`
+		Anulados  int            `json:"anulados"`
+		Descuento Dinero         `json:"descuento"`
+		Cupones   []cuponReporte `json:"cupones"`
+	}
+
+	campanias := []*campaniaReporte{}
+	for rows.Next() {
+		var campania string
+		var cr cuponReporte
+		if err := rows.Scan(&campania, &cr.CuponID, &cr.Codigo, &cr.Canjes, &cr.Anulados, &cr.Clientes, &cr.Descuento); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(campanias) == 0 || campanias[len(campanias)-1].Campania != campania {
+			campanias = append(campanias, &campaniaReporte{Campania: campania, Cupones: []cuponReporte{}})
+		}
+		cp := campanias[len(campanias)-1]
+		cp.Canjes += cr.Canjes
+		cp.Anulados += cr.Anulados
+		cp.Descuento += cr.Descuento
+		cp.Cupones = append(cp.Cupones, cr)
+	}
+
+	c.JSON(http.StatusOK, campanias)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Tablero del dueño: indicadores del día y de la semana. El resultado se guarda
+// en memoria y se descarta cuando la base avisa (NOTIFY cambios_dashboard, ver
+// query.sql) que cambiaron turnos, pagos, clientes, horarios, paquetes, tarjetas de
+// regalo o períodos de membresía. El vencimiento por tiempo cubre lo que cambia solo
+// con el reloj (turnos que pasan, huecos); mientras no llegan los avisos (sin conexión
+// de escucha) se usa uno más corto.
+
+const (
+	vencimientoDashboard          = 2 * time.Minute
+	vencimientoDashboardSinAvisos = 15 * time.Second
+)
+
+type TurnosHoy struct {
+	Total     int            `json:"total"`
+	PorEstado map[string]int `json:"por_estado"`
+	Proximos  []TurnoListado `json:"proximos"` // los siguientes a partir de ahora
+}
+
+type IngresosSemana struct {
+	Desde string `json:"desde"`
+	Hasta string `json:"hasta"`
+	MontosIngresos
+	SemanaAnterior *ComparacionIngresos `json:"semana_anterior"` // mismos días de la semana pasada
+}
+
+type ClientesNuevos struct {
+	Hoy    int `json:"hoy"`
+	Semana int `json:"semana"`
+	Mes    int `json:"mes"`
+}
+
+type HuecoLibre struct {
+	EmpleadoID  int    `json:"empleado_id"`
+	Empleado    string `json:"empleado"`
+	Fecha       string `json:"fecha"`
+	HoraInicio  string `json:"hora_inicio"`
+	HoraFin     string `json:"hora_fin"`
+	DuracionMin int    `json:"duracion_min"`
+}
+
+type Dashboard struct {
+	Fecha               string              `json:"fecha"`
+	Hoy                 TurnosHoy           `json:"hoy"`
+	IngresosSemana      IngresosSemana      `json:"ingresos_semana"`
+	OcupacionHoy        MinutosOcupacion    `json:"ocupacion_hoy"`
+	OcupacionSemana     MinutosOcupacion    `json:"ocupacion_semana"`
+	ClientesNuevos      ClientesNuevos      `json:"clientes_nuevos"`
+	CancelacionesSemana MetricasCancelacion `json:"cancelaciones_semana"`
+	HuecosLibres        []HuecoLibre        `json:"huecos_libres"`
+	CalculadoEn         time.Time           `json:"calculado_en"`
+}
+
+// Caché del tablero. version cambia con cada invalidación: un cálculo que
+// empezó antes de un cambio no se guarda.
+var cacheDashboard struct {
+	mu         sync.Mutex
+	calculo    sync.Mutex // un solo cálculo a la vez; los demás esperan y usan su resultado
+	datos      *Dashboard
+	version    uint64
+	expiracion time.Time
+	avisos     bool // escuchando cambios_dashboard
+}
+
+func avisosDashboard(activos bool) {
+	cacheDashboard.mu.Lock()
+	cacheDashboard.avisos = activos
+	cacheDashboard.mu.Unlock()
+}
+
+func invalidarDashboard() {
+	cacheDashboard.mu.Lock()
+	cacheDashboard.datos = nil
+	cacheDashboard.version++
+	cacheDashboard.mu.Unlock()
+}
+
+func dashboardEnCache() (*Dashboard, uint64) {
+	cacheDashboard.mu.Lock()
+	defer cacheDashboard.mu.Unlock()
+	if cacheDashboard.datos != nil && time.Now().Before(cacheDashboard.expiracion) {
+		return cacheDashboard.datos, cacheDashboard.version
+	}
+	return nil, cacheDashboard.version
+}
+
+func obtenerDashboard(db *sql.DB) (*Dashboard, bool, error) {
+	if d, _ := dashboardEnCache(); d != nil {
+		return d, true, nil
+	}
+
+	cacheDashboard.calculo.Lock()
+	defer cacheDashboard.calculo.Unlock()
+	d, version := dashboardEnCache() // otro pedido pudo haberlo calculado mientras esperábamos
+	if d != nil {
+		return d, true, nil
+	}
+
+	d, err := calcularDashboard(db, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	cacheDashboard.mu.Lock()
+	if cacheDashboard.version == version {
+		cacheDashboard.datos = d
+		if cacheDashboard.avisos {
+			cacheDashboard.expiracion = time.Now().Add(vencimientoDashboard)
+		} else {
+			cacheDashboard.expiracion = time.Now().Add(vencimientoDashboardSinAvisos)
+		}
+	}
+	cacheDashboard.mu.Unlock()
+	return d, false, nil
+}
+
+// Escucha los avisos de la base y descarta el caché del tablero. Si no se puede
+// escuchar (base caída al arrancar, conexión perdida) se reintenta y mientras tanto
+// el caché vence rápido.
+func iniciarInvalidacionDashboard() {
+	escuchando := false
+	var mu sync.Mutex
+	listener := pq.NewListener(dsnBarberia, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Error escuchando cambios del tablero:", err)
+		}
+		switch ev {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			avisosDashboard(false)
+		case pq.ListenerEventReconnected:
+			// Tras una reconexión pudieron perderse avisos
+			invalidarDashboard()
+			mu.Lock()
+			avisosDashboard(escuchando)
+			mu.Unlock()
+		}
+	})
+
+	go func() {
+		for {
+			err := listener.Listen("cambios_dashboard")
+			if err == nil || err == pq.ErrChannelAlreadyOpen {
+				mu.Lock()
+				escuchando = true
+				avisosDashboard(true)
+				mu.Unlock()
+				invalidarDashboard()
+				return
+			}
+			log.Println("Error escuchando cambios del tablero, se reintenta en 30s:", err)
+			time.Sleep(30 * time.Second)
+		}
+	}()
+
+	go func() {
+		ping := time.NewTicker(5 * time.Minute)
+		for {
+			select {
+			case <-listener.Notify:
+				invalidarDashboard()
+			case <-ping.C:
+				listener.Ping() // detecta conexiones caídas; el listener reconecta solo
+			}
+		}
+	}()
+}
+
+func calcularDashboard(db *sql.DB, ahora time.Time) (*Dashboard, error) {
+	hoy, _ := time.Parse("2006-01-02", ahora.Format("2006-01-02"))
+	lunes := hoy.AddDate(0, 0, 1-diaISO(hoy))
+	d := &Dashboard{Fecha: hoy.Format("2006-01-02"), CalculadoEn: ahora}
+
+	// Turnos de hoy
+	d.Hoy.PorEstado = map[string]int{}
+	rows, err := db.Query(`SELECT estado, COUNT(*) FROM turnos WHERE fecha = $1 GROUP BY estado`, d.Fecha)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var estado string
+		var n int
+		if err := rows.Scan(&estado, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Hoy.PorEstado[estado] = n
+		d.Hoy.Total += n
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT "+columnasTurnoListado+fromTurnosListado+`
+		WHERE t.fecha = $1 AND t.hora_inicio >= $2::time AND t.estado IN ('pendiente', 'pendiente_pago', 'confirmado')
+		ORDER BY t.hora_inicio, t.id LIMIT 10`, d.Fecha, ahora.Format("15:04"))
+	if err != nil {
+		return nil, err
+	}
+	d.Hoy.Proximos = []TurnoListado{}
+	for rows.Next() {
+		var t TurnoListado
+		if err := scanTurnoListado(rows, &t); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Hoy.Proximos = append(d.Hoy.Proximos, t)
+	}
+	rows.Close()
+
+	// Ingresos de la semana contra los mismos días de la anterior
+	total := agrupacionesIngresos["total"]
+	montos := func(desde, hasta time.Time) (MontosIngresos, error) {
+		filas, err := agregarIngresos(db, total, desde, hasta, 0, 0)
+		if err != nil || len(filas) == 0 {
+			return MontosIngresos{}, err
+		}
+		return filas[0].MontosIngresos, nil
+	}
+	actual, err := montos(lunes, hoy)
+	if err != nil {
+		return nil, err
+	}
+	anterior, err := montos(lunes.AddDate(0, 0, -7), hoy.AddDate(0, 0, -7))
+	if err != nil {
+		return nil, err
+	}
+	d.IngresosSemana = IngresosSemana{
+		Desde:          lunes.Format("2006-01-02"),
+		Hasta:          d.Fecha,
+		MontosIngresos: actual,
+		SemanaAnterior: comparacion(actual, anterior, lunes.AddDate(0, 0, -7), hoy.AddDate(0, 0, -7)),
+	}
+
+	// Ocupación de hoy y de la semana completa (incluye lo ya reservado a futuro)
+	if _, d.OcupacionHoy, err = calcularOcupacion(db, hoy, hoy, 0); err != nil {
+		return nil, err
+	}
+	if _, d.OcupacionSemana, err = calcularOcupacion(db, lunes, lunes.AddDate(0, 0, 6), 0); err != nil {
+		return nil, err
+	}
+
+	// Clientes nuevos
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE creado_en >= $1::date),
+		       COUNT(*) FILTER (WHERE creado_en >= $2::date),
+		       COUNT(*) FILTER (WHERE creado_en >= $3::date)
+		FROM clientes WHERE creado_en >= LEAST($2::date, $3::date)`,
+		d.Fecha, lunes.Format("2006-01-02"), hoy.Format("2006-01")+"-01").
+		Scan(&d.ClientesNuevos.Hoy, &d.ClientesNuevos.Semana, &d.ClientesNuevos.Mes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelaciones y ausencias de la semana
+	filas, err := agregarCancelaciones(db, dimensionesCancelaciones["total"], lunes, hoy, 0, 0, configInt(db, "cancelacion_tardia_horas"))
+	if err != nil {
+		return nil, err
+	}
+	if len(filas) > 0 {
+		d.CancelacionesSemana = filas[0].MetricasCancelacion
+	}
+
+	if d.HuecosLibres, err = proximosHuecos(db, ahora, 10); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Huecos libres de hoy (desde ahora) y mañana donde entra al menos el servicio más corto
+func proximosHuecos(db *sql.DB, ahora time.Time, limite int) ([]HuecoLibre, error) {
+	var minimo int
+	if err := db.QueryRow(`SELECT COALESCE(MIN(duracion_min), 0) FROM servicios WHERE activo`).Scan(&minimo); err != nil {
+		return nil, err
+	}
+
+	hoy, _ := time.Parse("2006-01-02", ahora.Format("2006-01-02"))
+	dias := []time.Time{hoy, hoy.AddDate(0, 0, 1)}
+	minutoActual := ahora.Hour()*60 + ahora.Minute()
+
+	rows, err := db.Query(`
+		SELECT e.id, e.nombre || ' ' || e.apellido, TO_CHAR(t.fecha, 'YYYY-MM-DD'),
+		       TO_CHAR(t.hora_inicio, 'HH24:MI'), TO_CHAR(t.hora_fin, 'HH24:MI')
+		FROM empleados e
+		LEFT JOIN turnos t ON t.empleado_id = e.id AND t.fecha BETWEEN $1 AND $2 AND t.estado != 'cancelado'
+		ORDER BY e.id, t.fecha, t.hora_inicio`,
+		dias[0].Format("2006-01-02"), dias[1].Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type empleadoHuecos struct {
+		nombre string
+		turnos map[string][]BloqueAgenda // por fecha
+	}
+	empleados := map[int]*empleadoHuecos{}
+	var orden []int
+	for rows.Next() {
+		var id int
+		var nombre string
+		var fecha, inicio, fin sql.NullString
+		if err := rows.Scan(&id, &nombre, &fecha, &inicio, &fin); err != nil {
+			return nil, err
+		}
+		e, ok := empleados[id]
+		if !ok {
+			e = &empleadoHuecos{nombre: nombre, turnos: map[string][]BloqueAgenda{}}
+			empleados[id] = e
+			orden = append(orden, id)
+		}
+		if fecha.Valid {
+			e.turnos[fecha.String] = append(e.turnos[fecha.String], BloqueAgenda{Tipo: "turno", HoraInicio: inicio.String, HoraFin: fin.String})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	huecos := []HuecoLibre{}
+	for _, id := range orden {
+		e := empleados[id]
+		franjas, err := franjasEmpleado(db, id)
+		if err != nil {
+			return nil, err
+		}
+		for n, dia := range dias {
+			fecha := dia.Format("2006-01-02")
+			for _, b := range armarBloques(e.turnos[fecha], franjas[diaISO(dia)]) {
+				if b.Tipo != "libre" {
+					continue
+				}
+				ini, _ := minutosDelDia(b.HoraInicio)
+				fin, _ := minutosDelDia(b.HoraFin)
+				if n == 0 {
+					ini = max(ini, minutoActual) // hoy, solo lo que queda por delante
+				}
+				if fin-ini < max(minimo, 1) {
+					continue
+				}
+				huecos = append(huecos, HuecoLibre{EmpleadoID: id, Empleado: e.nombre, Fecha: fecha,
+					HoraInicio: horaDelDia(ini), HoraFin: horaDelDia(fin), DuracionMin: fin - ini})
+			}
+		}
+	}
+
+	sort.SliceStable(huecos, func(i, j int) bool {
+		if huecos[i].Fecha != huecos[j].Fecha {
+			return huecos[i].Fecha < huecos[j].Fecha
+		}
+		return huecos[i].HoraInicio < huecos[j].HoraInicio
+	})
+	if len(huecos) > limite {
+		huecos = huecos[:limite]
+	}
+	return huecos, nil
+}
+
+// GET /dashboard  (?actualizar=true fuerza el recálculo)
+func getDashboard(c *gin.Context, db *sql.DB) {
+	if c.Query("actualizar") == "true" {
+		invalidarDashboard()
+	}
+
+	d, enCache, err := obtenerDashboard(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if enCache {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.JSON(http.StatusOK, d)
+}
@@ -113,7 +113,16 @@ func deleteEmpleado(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Si no tiene turnos, borrar
+	// Si no tiene turnos, borrar (con sus reglas de comisión y su horario)
+	for _, q := range []string{
+		"DELETE FROM reglas_comision WHERE empleado_id=$1",
+		"DELETE FROM horarios_empleado WHERE empleado_id=$1",
+	} {
+		if _, err := db.Exec(q, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	res, err := db.Exec("DELETE FROM empleados WHERE id=$1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nombres de las etiquetas de un cliente, ordenadas alfabéticamente
+func etiquetasDeCliente(db *sql.DB, clienteID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT e.nombre
+		FROM cliente_etiquetas ce
+		JOIN etiquetas e ON ce.etiqueta_id = e.id
+		WHERE ce.cliente_id = $1
+		ORDER BY e.nombre`, clienteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var etiquetas []string
+	for rows.Next() {
+		var nombre string
+		if err := rows.Scan(&nombre); err != nil {
+			return nil, err
+		}
+		etiquetas = append(etiquetas, nombre)
+	}
+	return etiquetas, rows.Err()
+}
+
+// Listar todas las etiquetas
+func getEtiquetas(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT id, nombre, color FROM etiquetas ORDER BY nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	etiquetas := []Etiqueta{}
+	for rows.Next() {
+		var e Etiqueta
+		if err := rows.Scan(&e.ID, &e.Nombre, &e.Color); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		etiquetas = append(etiquetas, e)
+	}
+
+	c.JSON(http.StatusOK, etiquetas)
+}
+
+// Crear etiqueta
+func createEtiqueta(c *gin.Context, db *sql.DB) {
+	var e Etiqueta
+	if err := c.ShouldBindJSON(&e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	e.Nombre = strings.TrimSpace(e.Nombre)
+	if e.Nombre == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nombre es requerido"})
+		return
+	}
+
+	err := db.QueryRow(`INSERT INTO etiquetas (nombre, color) VALUES ($1, $2) RETURNING id`, e.Nombre, e.Color).Scan(&e.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, e)
+}
+
+// Actualizar etiqueta
+func updateEtiqueta(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	var e Etiqueta
+	if err := c.ShouldBindJSON(&e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	e.Nombre = strings.TrimSpace(e.Nombre)
+	if e.Nombre == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nombre es requerido"})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE etiquetas SET nombre=$1, color=$2 WHERE id=$3`, e.Nombre, e.Color, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "etiqueta no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "etiqueta actualizada"})
+}
+
+// Borrar etiqueta (se quita de todos los clientes)
+func deleteEtiqueta(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	res, err := db.Exec("DELETE FROM etiquetas WHERE id=$1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "etiqueta no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "etiqueta eliminada"})
+}
+
+// GET /clientes/:id/etiquetas
+func getEtiquetasCliente(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	etiquetas, err := etiquetasDeCliente(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if etiquetas == nil {
+		etiquetas = []string{}
+	}
+
+	c.JSON(http.StatusOK, etiquetas)
+}
+
+// POST /clientes/:id/etiquetas  { "nombre": "VIP" }
+// Si la etiqueta no existe se crea.
+func addEtiquetaCliente(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var body struct {
+		Nombre string `json:"nombre"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body.Nombre = strings.TrimSpace(body.Nombre)
+	if body.Nombre == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nombre es requerido"})
+		return
+	}
+
+	var tmp int
+	err := db.QueryRow("SELECT id FROM clientes WHERE id=$1", id).Scan(&tmp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var etiquetaID int
+	err = db.QueryRow(`
+		INSERT INTO etiquetas (nombre) VALUES ($1)
+		ON CONFLICT (nombre) DO UPDATE SET nombre = EXCLUDED.nombre
+		RETURNING id`, body.Nombre).Scan(&etiquetaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO cliente_etiquetas (cliente_id, etiqueta_id) VALUES ($1, $2)
+	                  ON CONFLICT DO NOTHING`, id, etiquetaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": "etiqueta asignada", "etiqueta_id": etiquetaID})
+}
+
+// DELETE /clientes/:id/etiquetas/:etiqueta_id
+func removeEtiquetaCliente(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	etiquetaID := c.Param("etiqueta_id")
+
+	res, err := db.Exec("DELETE FROM cliente_etiquetas WHERE cliente_id=$1 AND etiqueta_id=$2", id, etiquetaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "el cliente no tiene esa etiqueta"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "etiqueta quitada"})
+}
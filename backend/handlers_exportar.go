@@ -0,0 +1,450 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// Exportación de listados a CSV, XLSX o NDJSON. Las filas se escriben a medida
+// que llegan de la base (XLSX con el stream writer de excelize), sin juntar todo
+// el resultado en memoria.
+//
+//	?formato=csv|xlsx|ndjson   (por defecto csv)
+//	?columnas=id,fecha,...     (por defecto las columnas por defecto del recurso)
+//	?regional=es-AR|iso        (por defecto es-AR: fechas DD/MM/AAAA, coma decimal y ';' en CSV)
+//
+// NDJSON siempre usa valores tipados y fechas ISO.
+
+// Tipos de columna: definen el formato de salida
+const (
+	tipoTexto     = "texto"
+	tipoEntero    = "entero"
+	tipoDecimal   = "decimal"    // NUMERIC como texto "1234.50"
+	tipoFecha     = "fecha"      // "2006-01-02"
+	tipoHora      = "hora"       // "15:04"
+	tipoFechaHora = "fecha_hora" // "2006-01-02 15:04"
+	tipoBool      = "bool"
+)
+
+type columnaExport struct {
+	nombre string // encabezado y nombre en ?columnas=
+	expr   string // expresión SQL (se lee como texto)
+	tipo   string
+}
+
+type exportable struct {
+	archivo    string // nombre del archivo sin extensión
+	columnas   []columnaExport
+	porDefecto []string
+}
+
+// Columnas pedidas en ?columnas= (o las por defecto), en el orden pedido
+func (e exportable) seleccionar(pedido string) ([]columnaExport, error) {
+	nombres := e.porDefecto
+	if strings.TrimSpace(pedido) != "" {
+		nombres = strings.Split(pedido, ",")
+	}
+
+	porNombre := map[string]columnaExport{}
+	for _, col := range e.columnas {
+		porNombre[col.nombre] = col
+	}
+
+	var seleccion []columnaExport
+	for _, n := range nombres {
+		col, ok := porNombre[strings.TrimSpace(n)]
+		if !ok {
+			disponibles := make([]string, len(e.columnas))
+			for i, c := range e.columnas {
+				disponibles[i] = c.nombre
+			}
+			return nil, fmt.Errorf("columna inválida: %s (disponibles: %s)", n, strings.Join(disponibles, ", "))
+		}
+		seleccion = append(seleccion, col)
+	}
+	return seleccion, nil
+}
+
+// Valor de una celda para CSV según la configuración regional
+func formatearCelda(v sql.NullString, tipo string, regional bool) string {
+	if !v.Valid {
+		return ""
+	}
+	if !regional {
+		return v.String
+	}
+	switch tipo {
+	case tipoDecimal:
+		return strings.Replace(v.String, ".", ",", 1)
+	case tipoFecha:
+		if t, err := time.Parse("2006-01-02", v.String); err == nil {
+			return t.Format("02/01/2006")
+		}
+	case tipoFechaHora:
+		if t, err := time.Parse("2006-01-02 15:04", v.String); err == nil {
+			return t.Format("02/01/2006 15:04")
+		}
+	case tipoBool:
+		if v.String == "true" {
+			return "sí"
+		}
+		return "no"
+	}
+	return v.String
+}
+
+// Excel y LibreOffice interpretan como fórmula una celda que empieza con = + - @,
+// tabulación o retorno de carro. Los textos cargados por usuarios (nombres, notas) se
+// exportan con un apóstrofo adelante para que se muestren tal cual.
+func escaparFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Valor tipado para NDJSON y XLSX
+func valorCelda(v sql.NullString, tipo string) interface{} {
+	if !v.Valid {
+		return nil
+	}
+	switch tipo {
+	case tipoEntero:
+		if n, err := strconv.ParseInt(v.String, 10, 64); err == nil {
+			return n
+		}
+	case tipoDecimal:
+		if f, err := strconv.ParseFloat(v.String, 64); err == nil {
+			return f
+		}
+	case tipoBool:
+		return v.String == "true"
+	}
+	return v.String
+}
+
+// Ejecuta la consulta con las columnas elegidas y escribe el archivo en el formato pedido
+func exportar(c *gin.Context, db *sql.DB, e exportable, from string, conds []string, args []interface{}, orden string) {
+	formato := c.DefaultQuery("formato", "csv")
+	if formato != "csv" && formato != "xlsx" && formato != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "formato inválido: usar csv, xlsx o ndjson"})
+		return
+	}
+	regional := true
+	switch c.DefaultQuery("regional", "es-AR") {
+	case "es-AR":
+	case "iso":
+		regional = false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "regional inválido: usar es-AR o iso"})
+		return
+	}
+
+	columnas, err := e.seleccionar(c.Query("columnas"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exprs := make([]string, len(columnas))
+	for i, col := range columnas {
+		exprs[i] = "(" + col.expr + ")::text"
+	}
+	query := "SELECT " + strings.Join(exprs, ", ") + from
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY " + orden
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	valores := make([]sql.NullString, len(columnas))
+	destinos := make([]interface{}, len(columnas))
+	for i := range valores {
+		destinos[i] = &valores[i]
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+e.archivo+"."+formato)
+	switch formato {
+	case "csv":
+		err = exportarCSV(c, rows, columnas, valores, destinos, regional)
+	case "ndjson":
+		err = exportarNDJSON(c, rows, columnas, valores, destinos)
+	case "xlsx":
+		err = exportarXLSX(c, rows, columnas, valores, destinos)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// La respuesta ya empezó a enviarse: el error solo queda registrado
+		c.Error(err)
+	}
+}
+
+func exportarCSV(c *gin.Context, rows *sql.Rows, columnas []columnaExport, valores []sql.NullString, destinos []interface{}, regional bool) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if regional {
+		w.Comma = ';' // Excel en español separa con ';' porque la coma es el decimal
+	}
+
+	fila := make([]string, len(columnas))
+	for i, col := range columnas {
+		fila[i] = col.nombre
+	}
+	if err := w.Write(fila); err != nil {
+		return err
+	}
+
+	for n := 1; rows.Next(); n++ {
+		if err := rows.Scan(destinos...); err != nil {
+			return err
+		}
+		for i, col := range columnas {
+			fila[i] = formatearCelda(valores[i], col.tipo, regional)
+			if col.tipo == tipoTexto {
+				fila[i] = escaparFormula(fila[i])
+			}
+		}
+		if err := w.Write(fila); err != nil {
+			return err
+		}
+		if n%500 == 0 {
+			w.Flush()
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func exportarNDJSON(c *gin.Context, rows *sql.Rows, columnas []columnaExport, valores []sql.NullString, destinos []interface{}) error {
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	for rows.Next() {
+		if err := rows.Scan(destinos...); err != nil {
+			return err
+		}
+		// Un objeto por línea, con las columnas en el orden pedido
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, col := range columnas {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			k, _ := json.Marshal(col.nombre)
+			v, err := json.Marshal(valorCelda(valores[i], col.tipo))
+			if err != nil {
+				return err
+			}
+			b.Write(k)
+			b.WriteByte(':')
+			b.Write(v)
+		}
+		b.WriteByte('}')
+		if err := enc.Encode(json.RawMessage(b.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportarXLSX(c *gin.Context, rows *sql.Rows, columnas []columnaExport, valores []sql.NullString, destinos []interface{}) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sw, err := f.NewStreamWriter(f.GetSheetName(0))
+	if err != nil {
+		return err
+	}
+
+	// Estilos por tipo: Excel muestra fechas y decimales según la configuración regional del equipo
+	formatos := map[string]string{
+		tipoFecha:     "dd/mm/yyyy",
+		tipoFechaHora: "dd/mm/yyyy hh:mm",
+		tipoDecimal:   "#,##0.00",
+	}
+	estilos := map[string]int{}
+	for tipo, formato := range formatos {
+		formato := formato
+		id, err := f.NewStyle(&excelize.Style{CustomNumFmt: &formato})
+		if err != nil {
+			return err
+		}
+		estilos[tipo] = id
+	}
+
+	encabezado := make([]interface{}, len(columnas))
+	for i, col := range columnas {
+		encabezado[i] = col.nombre
+	}
+	if err := sw.SetRow("A1", encabezado); err != nil {
+		return err
+	}
+
+	fila := make([]interface{}, len(columnas))
+	for n := 2; rows.Next(); n++ {
+		if err := rows.Scan(destinos...); err != nil {
+			return err
+		}
+		for i, col := range columnas {
+			v := valorCelda(valores[i], col.tipo)
+			if s, ok := v.(string); ok {
+				switch col.tipo {
+				case tipoTexto:
+					v = escaparFormula(s)
+				case tipoFecha:
+					if t, err := time.Parse("2006-01-02", s); err == nil {
+						v = t
+					}
+				case tipoFechaHora:
+					if t, err := time.Parse("2006-01-02 15:04", s); err == nil {
+						v = t
+					}
+				}
+			}
+			if b, ok := v.(bool); ok {
+				v = formatearCelda(sql.NullString{String: strconv.FormatBool(b), Valid: true}, tipoBool, true)
+			}
+			if estilo, ok := estilos[col.tipo]; ok && v != nil {
+				v = excelize.Cell{StyleID: estilo, Value: v}
+			}
+			fila[i] = v
+		}
+		celda, _ := excelize.CoordinatesToCellName(1, n)
+		if err := sw.SetRow(celda, fila); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	return f.Write(c.Writer)
+}
+
+// Columnas exportables de cada recurso
+
+var exportableTurnos = exportable{
+	archivo: "turnos",
+	columnas: []columnaExport{
+		{"id", "t.id", tipoEntero},
+		{"fecha", "t.fecha", tipoFecha},
+		{"hora_inicio", "TO_CHAR(t.hora_inicio, 'HH24:MI')", tipoHora},
+		{"hora_fin", "TO_CHAR(t.hora_fin, 'HH24:MI')", tipoHora},
+		{"estado", "t.estado", tipoTexto},
+		{"cliente_id", "t.cliente_id", tipoEntero},
+		{"cliente", "c.nombre || ' ' || c.apellido", tipoTexto},
+		{"empleado_id", "t.empleado_id", tipoEntero},
+		{"empleado", "e.nombre || ' ' || e.apellido", tipoTexto},
+		{"servicio_id", "t.servicio_id", tipoEntero},
+		{"servicio", "s.nombre", tipoTexto},
+		{"duracion_min", "t.duracion_min", tipoEntero},
+		{"origen", "t.origen", tipoTexto},
+		{"precio_lista", "COALESCE(t.precio_lista, 0)", tipoDecimal},
+		{"descuento", "t.descuento", tipoDecimal},
+		{"precio_final", "COALESCE(t.precio_final, 0)", tipoDecimal},
+		{"pagado", "COALESCE((SELECT SUM(p.monto) FROM pagos p WHERE p.turno_id = t.id), 0)", tipoDecimal},
+		{"moneda", "t.moneda", tipoTexto},
+		{"motivo_cancelacion", "t.motivo_cancelacion", tipoTexto},
+		{"notas", "t.notas", tipoTexto},
+	},
+	porDefecto: []string{"id", "fecha", "hora_inicio", "hora_fin", "estado", "cliente", "empleado", "servicio",
+		"precio_final", "pagado", "moneda"},
+}
+
+var exportableClientes = exportable{
+	archivo: "clientes",
+	columnas: []columnaExport{
+		{"dni", "cl.id", tipoEntero},
+		{"nombre", "cl.nombre", tipoTexto},
+		{"apellido", "cl.apellido", tipoTexto},
+		{"telefono", "cl.telefono", tipoTexto},
+		{"email", "cl.email", tipoTexto},
+		{"condicion_iva", "cl.condicion_iva", tipoTexto},
+		{"cuit", "cl.cuit", tipoTexto},
+		{"consentimiento_datos", "cl.consentimiento_datos", tipoBool},
+		{"consentimiento_marketing", "cl.consentimiento_marketing", tipoBool},
+		{"etiquetas", `(SELECT STRING_AGG(et.nombre, ', ' ORDER BY et.nombre) FROM cliente_etiquetas ce
+		               JOIN etiquetas et ON et.id = ce.etiqueta_id WHERE ce.cliente_id = cl.id)`, tipoTexto},
+		{"turnos", "(SELECT COUNT(*) FROM turnos t WHERE t.cliente_id = cl.id)", tipoEntero},
+		{"ultimo_turno", "(SELECT MAX(t.fecha) FROM turnos t WHERE t.cliente_id = cl.id AND t.estado = 'completado')", tipoFecha},
+	},
+	porDefecto: columnasImportCliente, // el mismo formato que acepta /clientes/import
+}
+
+var exportableServicios = exportable{
+	archivo: "servicios",
+	columnas: []columnaExport{
+		{"id", "s.id", tipoEntero},
+		{"nombre", "s.nombre", tipoTexto},
+		{"categoria", "cs.nombre", tipoTexto},
+		{"descripcion", "s.descripcion", tipoTexto},
+		{"duracion_min", "s.duracion_min", tipoEntero},
+		{"precio", `(SELECT sp.precio FROM servicio_precios sp WHERE sp.servicio_id = s.id AND sp.vigente_desde <= NOW()
+		             ORDER BY sp.vigente_desde DESC LIMIT 1)`, tipoDecimal},
+		{"moneda", "s.moneda", tipoTexto},
+		{"sena", "s.sena", tipoDecimal},
+		{"puntos", "s.puntos", tipoEntero},
+		{"activo", "s.activo", tipoBool},
+		{"reservable_online", "s.reservable_online", tipoBool},
+	},
+	porDefecto: []string{"id", "nombre", "categoria", "duracion_min", "precio", "moneda", "activo"},
+}
+
+// GET /turnos/export?formato=&columnas=&regional=  (más los filtros de GET /turnos)
+func exportTurnos(c *gin.Context, db *sql.DB) {
+	conds, args, err := filtrosTurnos(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exportar(c, db, exportableTurnos, fromTurnosListado, conds, args, "t.fecha, t.hora_inicio, t.id")
+}
+
+// GET /clientes/export?formato=&columnas=&regional=&q=
+// Sin columnas, el mismo formato que acepta /clientes/import. No incluye clientes anonimizados.
+func exportClientes(c *gin.Context, db *sql.DB) {
+	conds := []string{"cl.anonimizado_en IS NULL"}
+	var args []interface{}
+	if v := strings.TrimSpace(c.Query("q")); v != "" {
+		args = append(args, "%"+v+"%")
+		conds = append(conds, "(cl.nombre || ' ' || cl.apellido ILIKE $1 OR cl.telefono ILIKE $1 OR cl.email ILIKE $1)")
+	}
+	exportar(c, db, exportableClientes, " FROM clientes cl", conds, args, "cl.id")
+}
+
+// GET /servicios/export?formato=&columnas=&regional=  (más los filtros de GET /servicios)
+func exportServicios(c *gin.Context, db *sql.DB) {
+	conds, args, err := filtrosServicios(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exportar(c, db, exportableServicios, fromServicios, conds, args, "cs.orden NULLS LAST, s.orden, s.nombre")
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestEscaparFormula(t *testing.T) {
+	casos := []struct {
+		s, want string
+	}{
+		{"", ""},
+		{"Juan Pérez", "Juan Pérez"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+54 11 5555-0000", "'+54 11 5555-0000"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{"'ya escapado", "'ya escapado"},
+	}
+	for _, c := range casos {
+		if got := escaparFormula(c.s); got != c.want {
+			t.Errorf("escaparFormula(%q) = %q, se esperaba %q", c.s, got, c.want)
+		}
+	}
+}
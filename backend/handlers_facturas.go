@@ -0,0 +1,447 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Facturas electrónicas de turnos completados, por el total cobrado (libro de pagos).
+// Si el facturador falla la factura queda en estado error y se reintenta con espera creciente;
+// si ARCA la rechaza queda rechazada hasta que se corrijan los datos y se reintente a mano.
+
+const maxIntentosFactura = 10
+
+const columnasFactura = `id, turno_id, estado, letra, tipo_comprobante, punto_venta, numero, TO_CHAR(fecha, 'YYYY-MM-DD'),
+	doc_tipo, doc_nro, condicion_iva_receptor, neto, iva, total, cae, TO_CHAR(cae_vencimiento, 'YYYY-MM-DD'),
+	intentos, ultimo_error, proximo_intento, creado_en, autorizada_en`
+
+func scanFactura(sc scanner, f *Factura) error {
+	return sc.Scan(&f.ID, &f.TurnoID, &f.Estado, &f.Letra, &f.TipoComprobante, &f.PuntoVenta, &f.Numero, &f.Fecha,
+		&f.DocTipo, &f.DocNro, &f.CondicionIVAReceptor, &f.Neto, &f.IVA, &f.Total, &f.CAE, &f.CAEVencimiento,
+		&f.Intentos, &f.UltimoError, &f.ProximoIntento, &f.CreadoEn, &f.AutorizadaEn)
+}
+
+// Arma el comprobante con los datos actuales del cliente y de los pagos del turno
+func armarSolicitudFactura(db *sql.DB, q ejecutor, turnoID int) (SolicitudFactura, string, string, error) {
+	s := SolicitudFactura{Fecha: time.Now(), PuntoVenta: configInt(db, "negocio_punto_venta")}
+
+	var clienteID int
+	var condicion, cuit string
+	err := q.QueryRow(`SELECT c.id, c.condicion_iva, COALESCE(c.cuit, '') FROM turnos t JOIN clientes c ON c.id = t.cliente_id
+	                   WHERE t.id = $1`, turnoID).Scan(&clienteID, &condicion, &cuit)
+	if err != nil {
+		return s, "", "", err
+	}
+
+	_, pagado, _, err := saldoTurno(q, turnoID)
+	if err != nil {
+		return s, "", "", err
+	}
+	if pagado <= 0 {
+		return s, "", "", &RechazoFactura{Motivo: "el turno no tiene pagos para facturar"}
+	}
+
+	letra, tipo := letraFactura(configString(db, "negocio_condicion_iva"), condicion)
+	s.TipoComprobante = tipo
+	s.CondicionIVAReceptor = condicionesIVA[condicion]
+	s.Total = pagado
+	s.Neto = pagado
+	if letra != "C" {
+		s.Neto, s.IVA = discriminarIVA(pagado)
+	}
+
+	switch {
+	case cuit != "":
+		s.DocTipo, s.DocNro = docCUIT, cuit
+	case clienteID < 0: // anonimizado: ya no hay DNI
+		s.DocTipo, s.DocNro = docSinIdentificar, "0"
+	default:
+		s.DocTipo, s.DocNro = docDNI, strconv.Itoa(clienteID)
+	}
+	return s, letra, condicion, nil
+}
+
+// Los precios incluyen IVA 21%: neto redondeado al centavo (total / 1,21) e IVA por
+// diferencia, así neto + IVA da siempre el total. En centavos enteros, sin float.
+func discriminarIVA(total Dinero) (neto, iva Dinero) {
+	neto = (total*100 + 60) / 121
+	return neto, total - neto
+}
+
+// Intenta autorizar una factura. El número se reserva y se guarda (estado en_proceso)
+// antes de llamar a ARCA: si la respuesta se pierde o falla la escritura posterior, el
+// reintento consulta ese número en ARCA antes de pedir uno nuevo, así un turno nunca
+// tiene dos CAE. Mientras un número no se confirma no se reservan otros del mismo
+// punto de venta y tipo, porque ARCA exige numeración correlativa.
+// La factura se toma con un UPDATE condicional: si otro proceso (el reintento manual, el
+// alta o la cola) ya la está emitiendo, no se hace nada. Una en_proceso se retoma solo
+// cuando venció su próximo intento, para reconciliar una llamada que quedó sin respuesta.
+func emitirFactura(db *sql.DB, facturaID int) error {
+	var puntoVenta, tipo, numero sql.NullInt64
+	err := db.QueryRow(`
+		UPDATE facturas SET estado='en_proceso', proximo_intento = NOW() + INTERVAL '5 minutes'
+		WHERE id=$1 AND (estado IN ('pendiente', 'error', 'rechazada') OR (estado = 'en_proceso' AND proximo_intento <= NOW()))
+		RETURNING punto_venta, tipo_comprobante, numero`, facturaID).
+		Scan(&puntoVenta, &tipo, &numero)
+	if err == sql.ErrNoRows {
+		return nil // autorizada o en curso en otro proceso
+	}
+	if err != nil {
+		return err
+	}
+
+	// Número reservado en un intento anterior: ver si ARCA llegó a autorizarlo
+	if numero.Valid {
+		comp, err := facturador.Consultar(int(puntoVenta.Int64), int(tipo.Int64), int(numero.Int64))
+		if err != nil {
+			return registrarFalloFactura(db, facturaID, err)
+		}
+		if comp != nil {
+			return confirmarFactura(db, facturaID, int(puntoVenta.Int64), int(tipo.Int64), int(numero.Int64), *comp)
+		}
+	}
+
+	s, err := reservarNumeroFactura(db, facturaID)
+	if err != nil || s.Numero == 0 {
+		return err
+	}
+
+	res, err := facturador.Autorizar(s)
+	if err != nil {
+		return registrarFalloFactura(db, facturaID, err)
+	}
+	return confirmarFactura(db, facturaID, s.PuntoVenta, s.TipoComprobante, s.Numero, res)
+}
+
+// Arma el comprobante y reserva su número. Devuelve Numero 0 si la factura ya no
+// necesita emitirse o si el fallo ya quedó registrado.
+func reservarNumeroFactura(db *sql.DB, facturaID int) (SolicitudFactura, error) {
+	var s SolicitudFactura
+	tx, err := db.Begin()
+	if err != nil {
+		return s, err
+	}
+	defer tx.Rollback()
+
+	// emitirFactura ya la tomó (en_proceso); el FOR UPDATE la protege hasta guardar el número
+	var turnoID int
+	err = tx.QueryRow("SELECT turno_id FROM facturas WHERE id=$1 AND estado='en_proceso' FOR UPDATE", facturaID).Scan(&turnoID)
+	if err == sql.ErrNoRows {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	s, letra, condicion, err := armarSolicitudFactura(db, tx, turnoID)
+	if err != nil {
+		tx.Rollback()
+		return SolicitudFactura{}, registrarFalloFactura(db, facturaID, err)
+	}
+
+	// La fila del numerador serializa las reservas del punto de venta y tipo
+	var ultimoLocal int
+	err = tx.QueryRow(`INSERT INTO numeradores (sucursal, tipo, ultimo) VALUES ($1, $2, 0)
+	                   ON CONFLICT (sucursal, tipo) DO UPDATE SET ultimo = numeradores.ultimo
+	                   RETURNING ultimo`, s.PuntoVenta, "factura_"+letra).Scan(&ultimoLocal)
+	if err != nil {
+		return SolicitudFactura{}, err
+	}
+
+	var otraEnCurso bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM facturas WHERE punto_venta=$1 AND tipo_comprobante=$2 AND id != $3
+	                   AND numero IS NOT NULL AND estado IN ('en_proceso', 'error'))`,
+		s.PuntoVenta, s.TipoComprobante, facturaID).Scan(&otraEnCurso)
+	if err != nil {
+		return SolicitudFactura{}, err
+	}
+	if otraEnCurso {
+		tx.Rollback()
+		return SolicitudFactura{}, registrarFalloFactura(db, facturaID,
+			errors.New("hay otro comprobante del mismo tipo pendiente de confirmar en ARCA"))
+	}
+
+	// ARCA es la fuente de verdad; el numerador local cubre al facturador fake
+	ultimoRemoto, err := facturador.UltimoAutorizado(s.PuntoVenta, s.TipoComprobante)
+	if err != nil {
+		tx.Rollback()
+		return SolicitudFactura{}, registrarFalloFactura(db, facturaID, err)
+	}
+	s.Numero = ultimoLocal + 1
+	if ultimoRemoto >= ultimoLocal {
+		s.Numero = ultimoRemoto + 1
+	}
+
+	// El próximo intento da tiempo a que termine la llamada en curso antes de reconciliar
+	_, err = tx.Exec(`
+		UPDATE facturas SET estado='en_proceso', letra=$1, tipo_comprobante=$2, punto_venta=$3, numero=$4, fecha=$5,
+		       doc_tipo=$6, doc_nro=$7, condicion_iva_receptor=$8, neto=$9, iva=$10, total=$11,
+		       proximo_intento = NOW() + INTERVAL '5 minutes'
+		WHERE id=$12`,
+		letra, s.TipoComprobante, s.PuntoVenta, s.Numero, s.Fecha.Format("2006-01-02"),
+		s.DocTipo, s.DocNro, condicion, s.Neto, s.IVA, s.Total, facturaID)
+	if err != nil {
+		return SolicitudFactura{}, err
+	}
+	return s, tx.Commit()
+}
+
+// Marca la factura como autorizada con el CAE de ARCA y avanza el numerador local
+func confirmarFactura(db *sql.DB, facturaID, puntoVenta, tipo, numero int, res ResultadoFactura) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var letra string
+	err = tx.QueryRow(`
+		UPDATE facturas SET estado='autorizada', cae=$1, cae_vencimiento=$2, intentos=intentos+1,
+		       ultimo_error='', autorizada_en=NOW()
+		WHERE id=$3 AND punto_venta=$4 AND tipo_comprobante=$5 AND numero=$6
+		RETURNING letra`,
+		res.CAE, res.CAEVencimiento.Format("2006-01-02"), facturaID, puntoVenta, tipo, numero).Scan(&letra)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE numeradores SET ultimo = GREATEST(ultimo, $1) WHERE sucursal=$2 AND tipo=$3`,
+		numero, puntoVenta, "factura_"+letra)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Deja constancia del fallo. Los rechazos no se reintentan solos; el resto, con espera creciente (hasta 6 horas).
+// Un rechazo libera el número reservado (ARCA no lo consumió); ante otros errores se
+// conserva para consultarlo en el próximo intento.
+func registrarFalloFactura(db *sql.DB, facturaID int, causa error) error {
+	estado := "error"
+	var rechazo *RechazoFactura
+	if errors.As(causa, &rechazo) {
+		estado = "rechazada"
+	}
+	_, err := db.Exec(`
+		UPDATE facturas SET estado=$1, intentos=intentos+1, ultimo_error=$2,
+		       numero = CASE WHEN $1 = 'rechazada' THEN NULL ELSE numero END,
+		       proximo_intento = NOW() + LEAST(POWER(2, intentos), 360) * INTERVAL '1 minute'
+		WHERE id=$3`, estado, causa.Error(), facturaID)
+	if err != nil {
+		return err
+	}
+	return causa
+}
+
+// Reintenta las facturas en error, y las que quedaron en proceso, cuyo próximo intento ya llegó
+func reintentarFacturas(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id FROM facturas WHERE estado IN ('pendiente', 'error', 'en_proceso')
+	                       AND proximo_intento <= NOW() AND intentos < $1 ORDER BY id`, maxIntentosFactura)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := emitirFactura(db, id); err != nil {
+			log.Printf("Factura %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Procesa la cola de reintentos cada minuto
+func iniciarReintentosFacturas(db *sql.DB) {
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := reintentarFacturas(db); err != nil {
+				log.Println("Error reintentando facturas:", err)
+			}
+		}
+	}()
+}
+
+func obtenerFactura(db *sql.DB, where string, arg interface{}) (Factura, error) {
+	var f Factura
+	err := scanFactura(db.QueryRow("SELECT "+columnasFactura+" FROM facturas WHERE "+where, arg), &f)
+	return f, err
+}
+
+// Responde con la factura y el estado HTTP según haya quedado autorizada o en cola
+func responderFactura(c *gin.Context, db *sql.DB, facturaID int, errEmision error) {
+	f, err := obtenerFactura(db, "id=$1", facturaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if f.Estado == "autorizada" {
+		c.JSON(http.StatusCreated, f)
+		return
+	}
+
+	msg := "no se pudo autorizar: queda en cola para reintentar"
+	switch f.Estado {
+	case "rechazada":
+		msg = "factura rechazada: corregir los datos y reintentar"
+	case "en_proceso":
+		msg = "la factura se está autorizando en ARCA"
+	}
+	if errEmision != nil {
+		msg += fmt.Sprintf(" (%v)", errEmision)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"factura": f, "advertencia": msg})
+}
+
+// POST /turnos/:id/factura
+func createFactura(c *gin.Context, db *sql.DB) {
+	turnoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	var estado string
+	if err := db.QueryRow("SELECT estado FROM turnos WHERE id=$1", turnoID).Scan(&estado); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "turno no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if estado != "completado" {
+		c.JSON(http.StatusConflict, gin.H{"error": "solo se facturan turnos completados"})
+		return
+	}
+	if _, pagado, _, err := saldoTurno(db, turnoID); err != nil || pagado <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "el turno no tiene pagos para facturar"})
+		return
+	}
+
+	var facturaID int
+	err = db.QueryRow(`INSERT INTO facturas (turno_id) VALUES ($1) ON CONFLICT (turno_id) DO NOTHING RETURNING id`, turnoID).Scan(&facturaID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "el turno ya tiene una factura"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	responderFactura(c, db, facturaID, emitirFactura(db, facturaID))
+}
+
+// GET /turnos/:id/factura
+func getFacturaTurno(c *gin.Context, db *sql.DB) {
+	f, err := obtenerFactura(db, "turno_id=$1", c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "el turno no tiene factura"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// GET /facturas?estado=error
+func getFacturas(c *gin.Context, db *sql.DB) {
+	query := "SELECT " + columnasFactura + " FROM facturas"
+	var args []interface{}
+	if estado := c.Query("estado"); estado != "" {
+		query += " WHERE estado = $1"
+		args = append(args, estado)
+	}
+
+	rows, err := db.Query(query+" ORDER BY id DESC", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	facturas := []Factura{}
+	for rows.Next() {
+		var f Factura
+		if err := scanFactura(rows, &f); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		facturas = append(facturas, f)
+	}
+
+	c.JSON(http.StatusOK, facturas)
+}
+
+// POST /facturas/:id/reintentar
+func reintentarFactura(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	f, err := obtenerFactura(db, "id=$1", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "factura no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if f.Estado == "autorizada" {
+		c.JSON(http.StatusConflict, gin.H{"error": "la factura ya está autorizada"})
+		return
+	}
+
+	responderFactura(c, db, id, emitirFactura(db, id))
+}
+
+// PUT /clientes/:id/fiscal  { "condicion_iva": "responsable_inscripto", "cuit": "20-12345678-6" }
+func updateDatosFiscales(c *gin.Context, db *sql.DB) {
+	var body struct {
+		CondicionIVA string `json:"condicion_iva"`
+		CUIT         string `json:"cuit"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarDatosFiscales(&body.CondicionIVA, &body.CUIT); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE clientes SET condicion_iva=$1, cuit=$2 WHERE id=$3 AND anonimizado_en IS NULL`,
+		body.CondicionIVA, nullSiVacio(body.CUIT), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "datos fiscales actualizados"})
+}
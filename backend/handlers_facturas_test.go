@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestDiscriminarIVA(t *testing.T) {
+	casos := []struct {
+		total, neto, iva Dinero
+	}{
+		{pesos(121), pesos(100), pesos(21)},
+		{pesos(100), 8264, 1736}, // 82,6446...
+		{pesos(1000), 82645, 17355},
+		{1, 1, 0},
+		{2, 2, 0}, // 1,65 centavos -> 2
+		{pesos(15000), 1239669, 260331},
+		{999999, 826445, 173554},
+	}
+	for _, c := range casos {
+		neto, iva := discriminarIVA(c.total)
+		if neto != c.neto || iva != c.iva {
+			t.Errorf("discriminarIVA(%s) = %s + %s, se esperaba %s + %s", c.total, neto, iva, c.neto, c.iva)
+		}
+		if neto+iva != c.total {
+			t.Errorf("discriminarIVA(%s): neto + iva = %s", c.total, neto+iva)
+		}
+		// ARCA valida el IVA contra la base imponible por la alícuota, con tolerancia de un centavo
+		if d := iva - neto.Porcentaje(21); d > 1 || d < -1 {
+			t.Errorf("discriminarIVA(%s): iva %s difiere de 21%% de %s", c.total, iva, neto)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Horario semanal de los empleados. Un empleado sin franjas cargadas trabaja la
+// jornada general (jornadaInicio a jornadaFin) todos los días.
+
+// Intervalo en minutos desde la medianoche
+type franja struct {
+	Inicio, Fin int
+}
+
+func minutosDelDia(hora string) (int, error) {
+	t, err := time.Parse("15:04", hora)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func horaDelDia(minutos int) string {
+	return fmt.Sprintf("%02d:%02d", minutos/60, minutos%60)
+}
+
+// Franjas de trabajo por día de la semana ISO (1 lunes ... 7 domingo)
+func franjasEmpleado(q ejecutor, empleadoID int) (map[int][]franja, error) {
+	rows, err := q.Query(`SELECT dia_semana, TO_CHAR(hora_inicio, 'HH24:MI'), TO_CHAR(hora_fin, 'HH24:MI')
+	                      FROM horarios_empleado WHERE empleado_id=$1 ORDER BY dia_semana, hora_inicio`, empleadoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	franjas := map[int][]franja{}
+	cargado := false
+	for rows.Next() {
+		var h HorarioEmpleado
+		if err := rows.Scan(&h.DiaSemana, &h.HoraInicio, &h.HoraFin); err != nil {
+			return nil, err
+		}
+		ini, _ := minutosDelDia(h.HoraInicio)
+		fin, _ := minutosDelDia(h.HoraFin)
+		franjas[h.DiaSemana] = append(franjas[h.DiaSemana], franja{ini, fin})
+		cargado = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !cargado {
+		ini, _ := minutosDelDia(jornadaInicio)
+		fin, _ := minutosDelDia(jornadaFin)
+		for dia := 1; dia <= 7; dia++ {
+			franjas[dia] = []franja{{ini, fin}}
+		}
+	}
+	return franjas, nil
+}
+
+// Día de la semana ISO de una fecha
+func diaISO(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// GET /empleados/:id/horarios
+func getHorariosEmpleado(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query(`SELECT dia_semana, TO_CHAR(hora_inicio, 'HH24:MI'), TO_CHAR(hora_fin, 'HH24:MI')
+	                       FROM horarios_empleado WHERE empleado_id=$1 ORDER BY dia_semana, hora_inicio`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	horarios := []HorarioEmpleado{}
+	for rows.Next() {
+		var h HorarioEmpleado
+		if err := rows.Scan(&h.DiaSemana, &h.HoraInicio, &h.HoraFin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		horarios = append(horarios, h)
+	}
+
+	c.JSON(http.StatusOK, horarios)
+}
+
+// PUT /empleados/:id/horarios  [{ "dia_semana": 1, "hora_inicio": "09:00", "hora_fin": "13:00" }, ...]
+// Reemplaza el horario completo; una lista vacía vuelve a la jornada general.
+func updateHorariosEmpleado(c *gin.Context, db *sql.DB) {
+	empleadoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	var horarios []HorarioEmpleado
+	if err := c.ShouldBindJSON(&horarios); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validar y detectar franjas superpuestas en el mismo día
+	porDia := map[int][]franja{}
+	for _, h := range horarios {
+		if h.DiaSemana < 1 || h.DiaSemana > 7 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dia_semana: usar 1 (lunes) a 7 (domingo)"})
+			return
+		}
+		ini, err1 := minutosDelDia(h.HoraInicio)
+		fin, err2 := minutosDelDia(h.HoraFin)
+		if err1 != nil || err2 != nil || fin <= ini {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("franja inválida: %s a %s", h.HoraInicio, h.HoraFin)})
+			return
+		}
+		porDia[h.DiaSemana] = append(porDia[h.DiaSemana], franja{ini, fin})
+	}
+	for dia, fs := range porDia {
+		sort.Slice(fs, func(i, j int) bool { return fs[i].Inicio < fs[j].Inicio })
+		for i := 1; i < len(fs); i++ {
+			if fs[i].Inicio < fs[i-1].Fin {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("franjas superpuestas el %s", diasSemana[dia%7])})
+				return
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var tmp int
+	if err := tx.QueryRow("SELECT id FROM empleados WHERE id=$1", empleadoID).Scan(&tmp); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "empleado no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM horarios_empleado WHERE empleado_id=$1", empleadoID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, h := range horarios {
+		_, err := tx.Exec(`INSERT INTO horarios_empleado (empleado_id, dia_semana, hora_inicio, hora_fin) VALUES ($1, $2, $3, $4)`,
+			empleadoID, h.DiaSemana, h.HoraInicio, h.HoraFin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "horario actualizado"})
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Membresías: el cliente paga un plan mensual que incluye N turnos de ciertos servicios
+// por período, descuento en el resto y días extra para reservar online.
+// Los períodos se anclan al día de inicio; renovarSuscripciones los genera y vence
+// las suscripciones sin renovación automática.
+
+const columnasPlan = `p.id, p.nombre, p.precio, p.servicios, p.incluidos_por_periodo, p.descuento_porcentaje, p.anticipacion_extra_dias, p.activo`
+
+func scanPlan(sc scanner, p *PlanMembresia) error {
+	return sc.Scan(&p.ID, &p.Nombre, &p.Precio, pq.Array(&p.Servicios), &p.IncluidosPorPeriodo,
+		&p.DescuentoPorcentaje, &p.AnticipacionExtraDias, &p.Activo)
+}
+
+const columnasSuscripcion = `s.id, s.plan_id, p.nombre, s.cliente_id, s.estado, TO_CHAR(s.inicio, 'YYYY-MM-DD'),
+	TO_CHAR(s.periodo_hasta, 'YYYY-MM-DD'), s.renovacion_automatica, s.creado_en, s.cancelada_en`
+
+const fromSuscripciones = ` FROM suscripciones s JOIN planes_membresia p ON p.id = s.plan_id`
+
+func scanSuscripcion(sc scanner, s *Suscripcion) error {
+	return sc.Scan(&s.ID, &s.PlanID, &s.Plan, &s.ClienteID, &s.Estado, &s.Inicio, &s.PeriodoHasta,
+		&s.RenovacionAutomatica, &s.CreadoEn, &s.CanceladaEn)
+}
+
+// Suma meses sin desbordar al mes siguiente (31/01 + 1 mes = 28/02)
+func sumarMeses(t time.Time, n int) time.Time {
+	d := t.AddDate(0, n, 0)
+	if d.Day() != t.Day() {
+		d = d.AddDate(0, 0, -d.Day())
+	}
+	return d
+}
+
+// Período mensual (anclado a inicio) que contiene la fecha
+func periodoSuscripcion(inicio, fecha time.Time) (desde, hasta time.Time) {
+	n := (fecha.Year()-inicio.Year())*12 + int(fecha.Month()-inicio.Month())
+	if sumarMeses(inicio, n).After(fecha) {
+		n--
+	}
+	return sumarMeses(inicio, n), sumarMeses(inicio, n+1).AddDate(0, 0, -1)
+}
+
+// Membresía que cubre a un cliente en una fecha
+type membresiaCliente struct {
+	SuscripcionID int
+	Plan          PlanMembresia
+	Desde         string // período de la fecha
+	Usados        int    // turnos incluidos ya usados en el período
+}
+
+func (m membresiaCliente) incluye(servicioID int) bool {
+	return contiene(m.Plan.Servicios, int64(servicioID)) && m.Usados < m.Plan.IncluidosPorPeriodo
+}
+
+// Período impago cuyo plazo de pago (membresia_gracia_dias desde el inicio del período,
+// o desde el alta si la suscripción se creó con inicio retroactivo) ya venció.
+// Usa los alias s (suscripciones) y sp (suscripcion_periodos); $1 = días de gracia.
+const periodoAtrasado = `sp.suscripcion_id = s.id AND sp.pagado_en IS NULL
+	AND GREATEST(sp.desde, s.creado_en::date) + $1::int < CURRENT_DATE`
+
+// Devuelve nil si el cliente no tiene una membresía vigente para la fecha ("2006-01-02").
+// Sin renovación automática solo cubre hasta el final del período ya generado, y con un
+// período impago fuera del plazo de gracia no cubre nada hasta que se pague.
+func membresiaVigente(q ejecutor, clienteID int, fecha string) (*membresiaCliente, error) {
+	var m membresiaCliente
+	var inicio, periodoHasta time.Time
+	var renovacion, atrasada bool
+	err := q.QueryRow(`
+		SELECT s.id, s.inicio, s.periodo_hasta, s.renovacion_automatica,
+		       EXISTS (SELECT 1 FROM suscripcion_periodos sp WHERE `+periodoAtrasado+`), `+columnasPlan+fromSuscripciones+`
+		WHERE s.cliente_id = $2 AND s.estado = 'activa'`, configInt(q, "membresia_gracia_dias"), clienteID).
+		Scan(&m.SuscripcionID, &inicio, &periodoHasta, &renovacion, &atrasada, &m.Plan.ID, &m.Plan.Nombre, &m.Plan.Precio,
+			pq.Array(&m.Plan.Servicios), &m.Plan.IncluidosPorPeriodo, &m.Plan.DescuentoPorcentaje,
+			&m.Plan.AnticipacionExtraDias, &m.Plan.Activo)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if atrasada {
+		return nil, nil
+	}
+
+	if len(fecha) > 10 {
+		fecha = fecha[:10] // "2025-08-20T00:00:00Z"
+	}
+	f, err := time.Parse("2006-01-02", fecha)
+	if err != nil {
+		return nil, errors.New("fecha inválida")
+	}
+	inicio, periodoHasta = inicio.UTC(), periodoHasta.UTC()
+	if f.Before(inicio) || (!renovacion && f.After(periodoHasta)) {
+		return nil, nil
+	}
+
+	desde, _ := periodoSuscripcion(inicio, f)
+	m.Desde = desde.Format("2006-01-02")
+	err = q.QueryRow(`SELECT COUNT(*) FROM membresia_usos WHERE suscripcion_id=$1 AND periodo_desde=$2`,
+		m.SuscripcionID, m.Desde).Scan(&m.Usados)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Ajuste de la cotización para un miembro (m de membresiaVigente, nil si no tiene):
+// sin cargo si el servicio está incluido y quedan turnos en el período; si no, el
+// descuento del plan sobre el precio ya ajustado.
+func ajusteMembresia(cot *Cotizacion, m *membresiaCliente) {
+	if m == nil {
+		return
+	}
+
+	if m.incluye(cot.ServicioID) {
+		cot.Ajustes = append(cot.Ajustes, AjustePrecio{Nombre: "Incluido en " + m.Plan.Nombre, Monto: -cot.Precio})
+		cot.Precio = 0
+		cot.SuscripcionID = m.SuscripcionID
+		cot.IncluidoMembresia = true
+		return
+	}
+	if m.Plan.DescuentoPorcentaje > 0 && cot.Precio > 0 {
+		monto := -cot.Precio.Porcentaje(m.Plan.DescuentoPorcentaje)
+		cot.Ajustes = append(cot.Ajustes, AjustePrecio{Nombre: "Descuento " + m.Plan.Nombre, Monto: monto})
+		cot.Precio += monto
+		cot.SuscripcionID = m.SuscripcionID
+	}
+}
+
+// Registra el turno como uno de los incluidos del período. Se vuelve a contar con la
+// suscripción bloqueada para que dos reservas simultáneas no superen el cupo.
+func registrarUsoMembresia(tx *sql.Tx, suscripcionID int, t Turno) error {
+	if _, err := tx.Exec("SELECT id FROM suscripciones WHERE id=$1 FOR UPDATE", suscripcionID); err != nil {
+		return err
+	}
+	m, err := membresiaVigente(tx, t.ClienteID, t.Fecha)
+	if err != nil {
+		return err
+	}
+	if m == nil || m.SuscripcionID != suscripcionID || !m.incluye(t.ServicioID) {
+		return errors.New("la membresía ya no tiene turnos incluidos disponibles en el período")
+	}
+	_, err = tx.Exec(`INSERT INTO membresia_usos (suscripcion_id, turno_id, periodo_desde) VALUES ($1, $2, $3)`,
+		suscripcionID, t.ID, m.Desde)
+	return err
+}
+
+// Devuelve el turno incluido al cupo del período (turno cancelado o cambio de servicio)
+func liberarUsoMembresia(q ejecutor, turnoID int) error {
+	_, err := q.Exec("DELETE FROM membresia_usos WHERE turno_id=$1", turnoID)
+	return err
+}
+
+// Da por vencidas las suscripciones con un período impago fuera del plazo de gracia,
+// genera los períodos vencidos de las que tienen renovación automática y da por
+// vencidas las demás
+func renovarSuscripciones(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE suscripciones s SET estado='vencida'
+	                   WHERE s.estado='activa' AND EXISTS (SELECT 1 FROM suscripcion_periodos sp WHERE `+periodoAtrasado+`)`,
+		configInt(db, "membresia_gracia_dias"))
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT id FROM suscripciones WHERE estado='activa' AND periodo_hasta < CURRENT_DATE`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := renovarSuscripcion(tx, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renovarSuscripcion(tx *sql.Tx, id int) error {
+	var inicio, periodoHasta, hoy time.Time
+	var renovacion bool
+	var precio Dinero
+	err := tx.QueryRow(`
+		SELECT s.inicio, s.periodo_hasta, s.renovacion_automatica, p.precio, CURRENT_DATE`+fromSuscripciones+`
+		WHERE s.id=$1 AND s.estado='activa' AND s.periodo_hasta < CURRENT_DATE
+		FOR UPDATE OF s`, id).Scan(&inicio, &periodoHasta, &renovacion, &precio, &hoy)
+	if err == sql.ErrNoRows {
+		return nil // ya procesada
+	}
+	if err != nil {
+		return err
+	}
+
+	if !renovacion {
+		_, err := tx.Exec(`UPDATE suscripciones SET estado='vencida' WHERE id=$1`, id)
+		return err
+	}
+
+	inicio, periodoHasta, hoy = inicio.UTC(), periodoHasta.UTC(), hoy.UTC()
+	for periodoHasta.Before(hoy) {
+		desde, hasta := periodoSuscripcion(inicio, periodoHasta.AddDate(0, 0, 1))
+		_, err := tx.Exec(`INSERT INTO suscripcion_periodos (suscripcion_id, desde, hasta, precio) VALUES ($1, $2, $3, $4)
+		                   ON CONFLICT (suscripcion_id, desde) DO NOTHING`,
+			id, desde.Format("2006-01-02"), hasta.Format("2006-01-02"), precio)
+		if err != nil {
+			return err
+		}
+		periodoHasta = hasta
+	}
+	_, err = tx.Exec(`UPDATE suscripciones SET periodo_hasta=$1 WHERE id=$2`, periodoHasta.Format("2006-01-02"), id)
+	return err
+}
+
+// Revisa las renovaciones cada hora
+func iniciarRenovacionMembresias(db *sql.DB) {
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := renovarSuscripciones(db); err != nil {
+				log.Println("Error renovando membresías:", err)
+			}
+		}
+	}()
+}
+
+// Listar planes (?activo=todos incluye los dados de baja)
+func getPlanesMembresia(c *gin.Context, db *sql.DB) {
+	query := "SELECT " + columnasPlan + " FROM planes_membresia p"
+	if c.Query("activo") != "todos" {
+		query += " WHERE p.activo"
+	}
+
+	rows, err := db.Query(query + " ORDER BY p.nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	planes := []PlanMembresia{}
+	for rows.Next() {
+		var p PlanMembresia
+		if err := scanPlan(rows, &p); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		planes = append(planes, p)
+	}
+
+	c.JSON(http.StatusOK, planes)
+}
+
+func validarPlan(p *PlanMembresia) error {
+	p.Nombre = strings.TrimSpace(p.Nombre)
+	if p.Nombre == "" {
+		return errors.New("nombre es requerido")
+	}
+	if p.Precio < 0 {
+		return errors.New("precio inválido")
+	}
+	if p.Servicios == nil {
+		p.Servicios = []int64{}
+	}
+	if p.IncluidosPorPeriodo < 0 || (p.IncluidosPorPeriodo > 0 && len(p.Servicios) == 0) {
+		return errors.New("incluidos_por_periodo requiere indicar los servicios incluidos")
+	}
+	if p.DescuentoPorcentaje < 0 || p.DescuentoPorcentaje > 100 {
+		return errors.New("descuento_porcentaje debe estar entre 0 y 100")
+	}
+	if p.AnticipacionExtraDias < 0 {
+		return errors.New("anticipacion_extra_dias inválido")
+	}
+	return nil
+}
+
+// Crear plan
+func createPlanMembresia(c *gin.Context, db *sql.DB) {
+	p := PlanMembresia{Activo: true}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarPlan(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := db.QueryRow(`INSERT INTO planes_membresia (nombre, precio, servicios, incluidos_por_periodo, descuento_porcentaje, anticipacion_extra_dias, activo)
+	                    VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		p.Nombre, p.Precio, pq.Array(p.Servicios), p.IncluidosPorPeriodo, p.DescuentoPorcentaje, p.AnticipacionExtraDias, p.Activo).
+		Scan(&p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// Actualizar plan (el precio nuevo rige desde la próxima renovación)
+func updatePlanMembresia(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	p := PlanMembresia{Activo: true}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarPlan(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE planes_membresia SET nombre=$1, precio=$2, servicios=$3, incluidos_por_periodo=$4,
+	                     descuento_porcentaje=$5, anticipacion_extra_dias=$6, activo=$7 WHERE id=$8`,
+		p.Nombre, p.Precio, pq.Array(p.Servicios), p.IncluidosPorPeriodo, p.DescuentoPorcentaje, p.AnticipacionExtraDias, p.Activo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "plan actualizado"})
+}
+
+// Borrar plan: si tiene suscripciones se da de baja
+func deletePlanMembresia(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var usado bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM suscripciones WHERE plan_id=$1)", id).Scan(&usado); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, status := "DELETE FROM planes_membresia WHERE id=$1", "plan eliminado"
+	if usado {
+		query, status = "UPDATE planes_membresia SET activo=false WHERE id=$1", "plan dado de baja: tiene suscripciones"
+	}
+
+	res, err := db.Exec(query, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// Carga los períodos (con el uso de cada uno) de las suscripciones
+func cargarPeriodos(db *sql.DB, suscripciones []Suscripcion) error {
+	for i := range suscripciones {
+		rows, err := db.Query(`
+			SELECT sp.id, TO_CHAR(sp.desde, 'YYYY-MM-DD'), TO_CHAR(sp.hasta, 'YYYY-MM-DD'), sp.precio, sp.metodo, sp.pagado_en,
+			       (SELECT COUNT(*) FROM membresia_usos u WHERE u.suscripcion_id = sp.suscripcion_id AND u.periodo_desde = sp.desde)
+			FROM suscripcion_periodos sp WHERE sp.suscripcion_id = $1 ORDER BY sp.desde`, suscripciones[i].ID)
+		if err != nil {
+			return err
+		}
+		suscripciones[i].Periodos = []PeriodoSuscripcion{}
+		for rows.Next() {
+			var p PeriodoSuscripcion
+			if err := rows.Scan(&p.ID, &p.Desde, &p.Hasta, &p.Precio, &p.Metodo, &p.PagadoEn, &p.Usados); err != nil {
+				rows.Close()
+				return err
+			}
+			suscripciones[i].Periodos = append(suscripciones[i].Periodos, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listarSuscripciones(db *sql.DB, where string, args ...interface{}) ([]Suscripcion, error) {
+	rows, err := db.Query("SELECT "+columnasSuscripcion+fromSuscripciones+" WHERE "+where+" ORDER BY s.creado_en DESC, s.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suscripciones := []Suscripcion{}
+	for rows.Next() {
+		var s Suscripcion
+		if err := scanSuscripcion(rows, &s); err != nil {
+			return nil, err
+		}
+		suscripciones = append(suscripciones, s)
+	}
+	return suscripciones, rows.Err()
+}
+
+// GET /suscripciones?estado=activa
+func getSuscripciones(c *gin.Context, db *sql.DB) {
+	where, args := "TRUE", []interface{}{}
+	if estado := c.Query("estado"); estado != "" {
+		where, args = "s.estado = $1", append(args, estado)
+	}
+
+	suscripciones, err := listarSuscripciones(db, where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, suscripciones)
+}
+
+// GET /clientes/:id/suscripciones  (con períodos y turnos usados)
+func getSuscripcionesCliente(c *gin.Context, db *sql.DB) {
+	clienteID, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	suscripciones, err := listarSuscripciones(db, "s.cliente_id = $1", clienteID)
+	if err == nil {
+		err = cargarPeriodos(db, suscripciones)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, suscripciones)
+}
+
+// POST /clientes/:id/suscripciones  { "plan_id": 1, "inicio": "2025-09-01", "renovacion_automatica": true }
+func createSuscripcion(c *gin.Context, db *sql.DB) {
+	clienteID, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	body := struct {
+		PlanID               int    `json:"plan_id"`
+		Inicio               string `json:"inicio"`
+		RenovacionAutomatica *bool  `json:"renovacion_automatica"`
+	}{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hoy := time.Now()
+	inicio := time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, time.UTC)
+	if body.Inicio != "" {
+		var err error
+		if inicio, err = time.Parse("2006-01-02", body.Inicio); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "inicio inválido: usar YYYY-MM-DD"})
+			return
+		}
+	}
+	renovacion := body.RenovacionAutomatica == nil || *body.RenovacionAutomatica
+	_, hasta := periodoSuscripcion(inicio, inicio)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var precio Dinero
+	err = tx.QueryRow("SELECT precio FROM planes_membresia WHERE id=$1 AND activo", body.PlanID).Scan(&precio)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "plan inexistente o dado de baja"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO suscripciones (plan_id, cliente_id, inicio, periodo_hasta, renovacion_automatica)
+	                   VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		body.PlanID, clienteID, inicio.Format("2006-01-02"), hasta.Format("2006-01-02"), renovacion).Scan(&id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "el cliente ya tiene una membresía activa"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = tx.Exec(`INSERT INTO suscripcion_periodos (suscripcion_id, desde, hasta, precio) VALUES ($1, $2, $3, $4)`,
+		id, inicio.Format("2006-01-02"), hasta.Format("2006-01-02"), precio)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Si el inicio es retroactivo, generar los períodos hasta hoy
+	if err := renovarSuscripcion(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var s Suscripcion
+	if err := scanSuscripcion(tx.QueryRow("SELECT "+columnasSuscripcion+fromSuscripciones+" WHERE s.id=$1", id), &s); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// POST /suscripciones/:id/cancelar?inmediata=true
+// Por defecto deja de renovarse y sigue vigente hasta el fin del período pagado.
+func cancelarSuscripcion(c *gin.Context, db *sql.DB) {
+	query := `UPDATE suscripciones SET renovacion_automatica=false, cancelada_en=NOW() WHERE id=$1 AND estado='activa'`
+	status := "la membresía no se renovará: sigue vigente hasta el fin del período"
+	if c.Query("inmediata") == "true" {
+		query = `UPDATE suscripciones SET estado='cancelada', renovacion_automatica=false, cancelada_en=NOW() WHERE id=$1 AND estado='activa'`
+		status = "membresía cancelada"
+	}
+
+	res, err := db.Exec(query, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "suscripción activa no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// POST /suscripciones/:id/pagos  { "metodo": "efectivo" }  (paga el período impago más antiguo)
+func pagarPeriodoSuscripcion(c *gin.Context, db *sql.DB) {
+	var body struct {
+		Metodo string `json:"metodo"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body.Metodo = normalizarMetodoPago(body.Metodo)
+	if !metodoPagoManual(body.Metodo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("metodo inválido: %q", body.Metodo)})
+		return
+	}
+
+	var p PeriodoSuscripcion
+	err := db.QueryRow(`
+		UPDATE suscripcion_periodos SET metodo=$2, pagado_en=NOW()
+		WHERE id = (SELECT id FROM suscripcion_periodos WHERE suscripcion_id=$1 AND pagado_en IS NULL
+		            ORDER BY desde LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, TO_CHAR(desde, 'YYYY-MM-DD'), TO_CHAR(hasta, 'YYYY-MM-DD'), precio, metodo, pagado_en`,
+		c.Param("id"), body.Metodo).Scan(&p.ID, &p.Desde, &p.Hasta, &p.Precio, &p.Metodo, &p.PagadoEn)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "la suscripción no tiene períodos impagos"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func fecha(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestSumarMeses(t *testing.T) {
+	casos := []struct {
+		desde string
+		n     int
+		want  string
+	}{
+		{"2024-01-15", 1, "2024-02-15"},
+		{"2024-01-31", 1, "2024-02-29"}, // bisiesto
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-03-31", 1, "2024-04-30"},
+		{"2024-01-31", 2, "2024-03-31"},
+		{"2024-11-30", 3, "2025-02-28"},
+		{"2024-05-10", 0, "2024-05-10"},
+		{"2024-03-31", -1, "2024-02-29"},
+	}
+	for _, c := range casos {
+		if got := sumarMeses(fecha(c.desde), c.n).Format("2006-01-02"); got != c.want {
+			t.Errorf("sumarMeses(%s, %d) = %s, se esperaba %s", c.desde, c.n, got, c.want)
+		}
+	}
+}
+
+func TestPeriodoSuscripcion(t *testing.T) {
+	casos := []struct {
+		inicio, fecha, desde, hasta string
+	}{
+		{"2024-01-10", "2024-01-10", "2024-01-10", "2024-02-09"},
+		{"2024-01-10", "2024-02-09", "2024-01-10", "2024-02-09"},
+		{"2024-01-10", "2024-02-10", "2024-02-10", "2024-03-09"},
+		{"2024-01-10", "2025-01-05", "2024-12-10", "2025-01-09"},
+		{"2024-01-31", "2024-02-28", "2024-01-31", "2024-02-28"},
+		{"2024-01-31", "2024-02-29", "2024-02-29", "2024-03-30"},
+		{"2024-01-31", "2024-03-31", "2024-03-31", "2024-04-29"},
+	}
+	for _, c := range casos {
+		desde, hasta := periodoSuscripcion(fecha(c.inicio), fecha(c.fecha))
+		if d, h := desde.Format("2006-01-02"), hasta.Format("2006-01-02"); d != c.desde || h != c.hasta {
+			t.Errorf("periodoSuscripcion(%s, %s) = %s..%s, se esperaba %s..%s", c.inicio, c.fecha, d, h, c.desde, c.hasta)
+		}
+	}
+}
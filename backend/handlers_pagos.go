@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagos: libro de movimientos por turno. Solo se agregan filas (un trigger impide modificarlas);
+// las devoluciones se registran como reintegro con monto negativo.
+
+var metodosPago = map[string]bool{
+	"efectivo":      true,
+	"debito":        true,
+	"transferencia": true,
+	"mercado_pago":  true,
+
+	// Prepagos: los registra el sistema al consumir un paquete o una tarjeta de regalo
+	"paquete":        true,
+	"tarjeta_regalo": true,
+}
+
+// Métodos que se pueden informar a mano: los prepagos solo entran consumiendo
+// un crédito o saldo (consumirCreditoPaquete, consumirTarjetaRegalo)
+func metodoPagoManual(metodo string) bool {
+	return metodosPago[metodo] && metodo != "paquete" && metodo != "tarjeta_regalo"
+}
+
+func normalizarMetodoPago(metodo string) string {
+	metodo = strings.ToLower(strings.TrimSpace(metodo))
+	if metodo == "débito" {
+		metodo = "debito"
+	}
+	return metodo
+}
+
+const columnasPago = `p.id, p.turno_id, t.cliente_id, p.tipo, p.metodo, p.monto, p.propina, p.moneda, p.referencia, p.nota, p.creado_en`
+
+const fromPagos = ` FROM pagos p JOIN turnos t ON t.id = p.turno_id`
+
+func scanPago(sc scanner, p *Pago) error {
+	return sc.Scan(&p.ID, &p.TurnoID, &p.ClienteID, &p.Tipo, &p.Metodo, &p.Monto, &p.Propina, &p.Moneda, &p.Referencia, &p.Nota, &p.CreadoEn)
+}
+
+func listarPagos(q ejecutor, where string, args ...interface{}) ([]Pago, error) {
+	rows, err := q.Query("SELECT "+columnasPago+fromPagos+" WHERE "+where+" ORDER BY p.creado_en, p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pagos := []Pago{}
+	for rows.Next() {
+		var p Pago
+		if err := scanPago(rows, &p); err != nil {
+			return nil, err
+		}
+		pagos = append(pagos, p)
+	}
+	return pagos, rows.Err()
+}
+
+// Precio final, total cobrado y saldo pendiente de un turno
+func saldoTurno(q ejecutor, turnoID int) (precioFinal, pagado, saldo Dinero, err error) {
+	err = q.QueryRow(`SELECT precio_final, pagado, saldo FROM turno_saldos WHERE turno_id=$1`, turnoID).
+		Scan(&precioFinal, &pagado, &saldo)
+	return
+}
+
+// Registra un pago o reintegro. p.Monto llega siempre positivo; en los reintegros se guarda negativo.
+// Bloquea el turno para que dos cobros simultáneos no superen el saldo.
+func registrarPago(tx *sql.Tx, p *Pago) error {
+	if p.Tipo == "" {
+		p.Tipo = "pago"
+	}
+	p.Metodo = normalizarMetodoPago(p.Metodo)
+	if p.Tipo != "pago" && p.Tipo != "reintegro" {
+		return errors.New("tipo inválido: usar pago o reintegro")
+	}
+	if !metodosPago[p.Metodo] {
+		return fmt.Errorf("metodo inválido: %q", p.Metodo)
+	}
+	if p.Propina < 0 || (p.Propina > 0 && p.Tipo != "pago") {
+		return errors.New("propina inválida: solo se registra en pagos")
+	}
+	// Un pago puede ser solo propina (turno ya saldado)
+	if p.Monto < 0 || (p.Monto == 0 && p.Propina == 0) {
+		return errors.New("monto debe ser mayor a 0")
+	}
+
+	var estado string
+	err := tx.QueryRow("SELECT cliente_id, estado, moneda FROM turnos WHERE id=$1 FOR UPDATE", p.TurnoID).
+		Scan(&p.ClienteID, &estado, &p.Moneda)
+	if err != nil {
+		return err
+	}
+
+	_, pagado, saldo, err := saldoTurno(tx, p.TurnoID)
+	if err != nil {
+		return err
+	}
+
+	// Las propinas de un turno ya liquidado no entrarían en ninguna liquidación
+	if p.Propina > 0 {
+		liquidado, err := turnoLiquidado(tx, p.TurnoID)
+		if err != nil {
+			return err
+		}
+		if liquidado {
+			return errors.New("el turno ya está en una liquidación cerrada: no admite propinas")
+		}
+	}
+
+	if p.Tipo == "pago" {
+		if estado == "cancelado" {
+			return errors.New("no se pueden registrar pagos en un turno cancelado")
+		}
+		if p.Monto > saldo {
+			return fmt.Errorf("el pago (%s) supera el saldo del turno (%s)", p.Monto.String(), saldo.String())
+		}
+	} else {
+		if p.Monto > pagado {
+			return fmt.Errorf("el reintegro (%s) supera lo cobrado (%s)", p.Monto.String(), pagado.String())
+		}
+		p.Monto = -p.Monto
+	}
+
+	return tx.QueryRow(`INSERT INTO pagos (turno_id, tipo, metodo, monto, propina, moneda, referencia, nota)
+	                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, creado_en`,
+		p.TurnoID, p.Tipo, p.Metodo, p.Monto, p.Propina, p.Moneda, p.Referencia, p.Nota).Scan(&p.ID, &p.CreadoEn)
+}
+
+// POST /turnos/:id/pagos  { "metodo": "efectivo", "monto": 5000, "propina": 500 }  (tipo "reintegro" para devolver)
+func createPago(c *gin.Context, db *sql.DB) {
+	turnoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	var p Pago
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.TurnoID = turnoID
+	p.Metodo = normalizarMetodoPago(p.Metodo)
+	if !metodoPagoManual(p.Metodo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("metodo inválido: %q (los pagos con paquete o tarjeta de regalo se registran al usarlos en el turno)", p.Metodo)})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := registrarPago(tx, &p); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "turno no encontrado"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	_, _, saldo, err := saldoTurno(tx, turnoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"pago": p, "saldo": saldo})
+}
+
+// GET /turnos/:id/pagos
+func getPagosTurno(c *gin.Context, db *sql.DB) {
+	turnoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	precioFinal, pagado, saldo, err := saldoTurno(db, turnoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "turno no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	pagos, err := listarPagos(db, "p.turno_id = $1", turnoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"turno_id":     turnoID,
+		"precio_final": precioFinal,
+		"pagado":       pagado,
+		"saldo":        saldo,
+		"pagos":        pagos,
+	})
+}
+
+// GET /pagos?desde=2025-09-01&hasta=2025-09-30&metodo=efectivo
+func getPagos(c *gin.Context, db *sql.DB) {
+	desde, hasta := c.Query("desde"), c.Query("hasta")
+	if desde == "" || hasta == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "desde y hasta son requeridos"})
+		return
+	}
+
+	where := "p.creado_en >= $1::date AND p.creado_en < $2::date + 1"
+	args := []interface{}{desde, hasta}
+	if metodo := c.Query("metodo"); metodo != "" {
+		where += " AND p.metodo = $3"
+		args = append(args, metodo)
+	}
+
+	pagos, err := listarPagos(db, where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total, propinas Dinero
+	porMetodo := map[string]Dinero{}
+	for _, p := range pagos {
+		total += p.Monto
+		propinas += p.Propina
+		porMetodo[p.Metodo] += p.Monto
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pagos":      pagos,
+		"por_metodo": porMetodo,
+		"total":      total,
+		"propinas":   propinas,
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMetodoPagoManual(t *testing.T) {
+	casos := []struct {
+		metodo string
+		ok     bool
+	}{
+		{"efectivo", true},
+		{" Efectivo ", true},
+		{"Débito", true},
+		{"transferencia", true},
+		{"mercado_pago", true},
+		{"paquete", false},
+		{"tarjeta_regalo", false},
+		{"TARJETA_REGALO", false},
+		{"cheque", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if got := metodoPagoManual(normalizarMetodoPago(c.metodo)); got != c.ok {
+			t.Errorf("metodoPagoManual(%q) = %v, se esperaba %v", c.metodo, got, c.ok)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Paquetes prepagos: el cliente compra N créditos de un servicio con vencimiento.
+// Cada crédito usado en un turno queda en paquete_movimientos y como pago (metodo "paquete").
+
+const columnasPaqueteCliente = `pc.id, pc.paquete_id, p.nombre, pc.cliente_id, pc.servicio_id, pc.precio,
+	TO_CHAR(pc.vence_en, 'YYYY-MM-DD'), pc.comprado_en,
+	(SELECT COALESCE(SUM(m.creditos), 0) FROM paquete_movimientos m WHERE m.paquete_cliente_id = pc.id),
+	pc.vence_en < CURRENT_DATE`
+
+const fromPaquetesCliente = ` FROM paquetes_cliente pc JOIN paquetes p ON p.id = pc.paquete_id`
+
+func scanPaqueteCliente(sc scanner, pc *PaqueteCliente) error {
+	return sc.Scan(&pc.ID, &pc.PaqueteID, &pc.Nombre, &pc.ClienteID, &pc.ServicioID, &pc.Precio,
+		&pc.VenceEn, &pc.CompradoEn, &pc.Saldo, &pc.Vencido)
+}
+
+// Usa un crédito de un paquete del cliente para el servicio del turno (el que vence primero).
+// Si el turno no tiene nada que cobrar (p. ej. incluido en la membresía) no se usa el crédito.
+func consumirCreditoPaquete(tx *sql.Tx, t *Turno) error {
+	if t.PrecioFinal == 0 {
+		return nil
+	}
+
+	var paqueteClienteID int
+	err := tx.QueryRow(`
+		SELECT pc.id FROM paquetes_cliente pc
+		WHERE pc.cliente_id = $1 AND pc.servicio_id = $2 AND pc.vence_en >= $3::date
+		  AND (SELECT COALESCE(SUM(m.creditos), 0) FROM paquete_movimientos m WHERE m.paquete_cliente_id = pc.id) > 0
+		ORDER BY pc.vence_en, pc.id
+		LIMIT 1
+		FOR UPDATE`, t.ClienteID, t.ServicioID, t.Fecha).Scan(&paqueteClienteID)
+	if err == sql.ErrNoRows {
+		return errors.New("el cliente no tiene paquetes vigentes con créditos para este servicio")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO paquete_movimientos (paquete_cliente_id, turno_id, tipo, creditos) VALUES ($1, $2, 'consumo', -1)`,
+		paqueteClienteID, t.ID)
+	if err != nil {
+		return err
+	}
+
+	p := Pago{TurnoID: t.ID, Tipo: "pago", Metodo: "paquete", Monto: t.PrecioFinal,
+		Referencia: fmt.Sprintf("paquete #%d", paqueteClienteID)}
+	return registrarPago(tx, &p)
+}
+
+// Valida que un turno no combine el paquete con otros beneficios
+func validarPrepagosTurno(t Turno) error {
+	if t.UsarPaquete && (t.CodigoCupon != "" || t.PuntosCanje > 0 || t.CodigoTarjeta != "") {
+		return errors.New("el crédito de paquete no se combina con cupones, puntos ni tarjetas de regalo")
+	}
+	return nil
+}
+
+// Devuelve el crédito de paquete y el saldo de tarjeta de regalo usados en un turno cancelado.
+// Con politica=true una cancelación tardía no se reintegra, salvo que la configuración lo permita.
+func reintegrarPrepagos(db *sql.DB, tx *sql.Tx, turnoID int, politica bool) error {
+	if politica && configInt(db, "prepago_reintegro_cancelacion_tardia") == 0 {
+		var tardia bool
+		err := tx.QueryRow(`
+			SELECT COALESCE(cancelado_en > (fecha + hora_inicio::time) - make_interval(hours => $2), FALSE)
+			FROM turnos WHERE id = $1`, turnoID, configInt(db, "cancelacion_tardia_horas")).Scan(&tardia)
+		if err != nil {
+			return err
+		}
+		if tardia {
+			return nil
+		}
+	}
+
+	// Crédito de paquete (una sola vez por turno)
+	var paqueteClienteID int
+	err := tx.QueryRow(`
+		INSERT INTO paquete_movimientos (paquete_cliente_id, turno_id, tipo, creditos)
+		SELECT paquete_cliente_id, turno_id, 'reintegro', 1 FROM paquete_movimientos
+		WHERE turno_id = $1 AND tipo = 'consumo'
+		ON CONFLICT DO NOTHING
+		RETURNING paquete_cliente_id`, turnoID).Scan(&paqueteClienteID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		if err := reintegrarPagosMetodo(tx, turnoID, "paquete", fmt.Sprintf("paquete #%d", paqueteClienteID)); err != nil {
+			return err
+		}
+	}
+
+	// Saldo de tarjeta de regalo
+	var codigo string
+	err = tx.QueryRow(`
+		INSERT INTO tarjeta_movimientos (tarjeta_id, turno_id, tipo, monto)
+		SELECT m.tarjeta_id, m.turno_id, 'reintegro', -m.monto FROM tarjeta_movimientos m
+		WHERE m.turno_id = $1 AND m.tipo = 'consumo'
+		ON CONFLICT DO NOTHING
+		RETURNING (SELECT codigo FROM tarjetas_regalo WHERE id = tarjeta_id)`, turnoID).Scan(&codigo)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		return reintegrarPagosMetodo(tx, turnoID, "tarjeta_regalo", codigo)
+	}
+	return nil
+}
+
+// Registra en el libro de pagos el reintegro de todo lo cobrado con un método
+func reintegrarPagosMetodo(tx *sql.Tx, turnoID int, metodo, referencia string) error {
+	var neto Dinero
+	err := tx.QueryRow(`SELECT COALESCE(SUM(monto), 0) FROM pagos WHERE turno_id=$1 AND metodo=$2`, turnoID, metodo).Scan(&neto)
+	if err != nil || neto <= 0 {
+		return err
+	}
+	p := Pago{TurnoID: turnoID, Tipo: "reintegro", Metodo: metodo, Monto: neto, Referencia: referencia, Nota: "Reintegro por cancelación"}
+	return registrarPago(tx, &p)
+}
+
+// Listar paquetes a la venta (?activo=todos incluye los dados de baja)
+func getPaquetes(c *gin.Context, db *sql.DB) {
+	query := "SELECT id, nombre, servicio_id, cantidad, precio, vigencia_dias, activo FROM paquetes"
+	if c.Query("activo") != "todos" {
+		query += " WHERE activo"
+	}
+
+	rows, err := db.Query(query + " ORDER BY nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	paquetes := []Paquete{}
+	for rows.Next() {
+		var p Paquete
+		if err := rows.Scan(&p.ID, &p.Nombre, &p.ServicioID, &p.Cantidad, &p.Precio, &p.VigenciaDias, &p.Activo); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		paquetes = append(paquetes, p)
+	}
+
+	c.JSON(http.StatusOK, paquetes)
+}
+
+func validarPaquete(p *Paquete) error {
+	p.Nombre = strings.TrimSpace(p.Nombre)
+	if p.Nombre == "" {
+		return errors.New("nombre es requerido")
+	}
+	if p.ServicioID <= 0 {
+		return errors.New("servicio_id es requerido")
+	}
+	if p.Cantidad <= 0 {
+		return errors.New("cantidad debe ser mayor a 0")
+	}
+	if p.Precio < 0 {
+		return errors.New("precio inválido")
+	}
+	if p.VigenciaDias <= 0 {
+		return errors.New("vigencia_dias debe ser mayor a 0")
+	}
+	return nil
+}
+
+// Crear paquete
+func createPaquete(c *gin.Context, db *sql.DB) {
+	p := Paquete{Activo: true, VigenciaDias: 180}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarPaquete(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := db.QueryRow(`INSERT INTO paquetes (nombre, servicio_id, cantidad, precio, vigencia_dias, activo)
+	                    VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		p.Nombre, p.ServicioID, p.Cantidad, p.Precio, p.VigenciaDias, p.Activo).Scan(&p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// Actualizar paquete (no cambia los ya vendidos)
+func updatePaquete(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	p := Paquete{Activo: true, VigenciaDias: 180}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarPaquete(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE paquetes SET nombre=$1, servicio_id=$2, cantidad=$3, precio=$4, vigencia_dias=$5, activo=$6 WHERE id=$7`,
+		p.Nombre, p.ServicioID, p.Cantidad, p.Precio, p.VigenciaDias, p.Activo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "paquete no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "paquete actualizado"})
+}
+
+// Borrar paquete: si ya se vendió se da de baja
+func deletePaquete(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+
+	var vendido bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM paquetes_cliente WHERE paquete_id=$1)", id).Scan(&vendido); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, status := "DELETE FROM paquetes WHERE id=$1", "paquete eliminado"
+	if vendido {
+		query, status = "UPDATE paquetes SET activo=false WHERE id=$1", "paquete dado de baja: tiene ventas registradas"
+	}
+
+	res, err := db.Exec(query, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "paquete no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// POST /clientes/:id/paquetes  { "paquete_id": 2 }
+func venderPaquete(c *gin.Context, db *sql.DB) {
+	clienteID, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		PaqueteID int `json:"paquete_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var cantidad int
+	var pcID int
+	err = tx.QueryRow(`
+		INSERT INTO paquetes_cliente (paquete_id, cliente_id, servicio_id, precio, vence_en)
+		SELECT id, $2, servicio_id, precio, CURRENT_DATE + vigencia_dias FROM paquetes WHERE id = $1 AND activo
+		RETURNING id, (SELECT cantidad FROM paquetes WHERE id = $1)`, body.PaqueteID, clienteID).Scan(&pcID, &cantidad)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paquete inexistente o dado de baja"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = tx.Exec(`INSERT INTO paquete_movimientos (paquete_cliente_id, tipo, creditos) VALUES ($1, 'compra', $2)`, pcID, cantidad)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pc PaqueteCliente
+	if err := scanPaqueteCliente(tx.QueryRow("SELECT "+columnasPaqueteCliente+fromPaquetesCliente+" WHERE pc.id=$1", pcID), &pc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, pc)
+}
+
+// GET /clientes/:id/paquetes  (saldo de créditos y movimientos de cada paquete)
+func getPaquetesCliente(c *gin.Context, db *sql.DB) {
+	clienteID, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT "+columnasPaqueteCliente+fromPaquetesCliente+" WHERE pc.cliente_id=$1 ORDER BY pc.vence_en", clienteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	paquetes := []PaqueteCliente{}
+	indice := map[int]int{}
+	for rows.Next() {
+		var pc PaqueteCliente
+		if err := scanPaqueteCliente(rows, &pc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pc.Movimientos = []MovimientoPaquete{}
+		indice[pc.ID] = len(paquetes)
+		paquetes = append(paquetes, pc)
+	}
+	rows.Close()
+
+	movRows, err := db.Query(`
+		SELECT m.paquete_cliente_id, m.id, m.turno_id, m.tipo, m.creditos, m.creado_en
+		FROM paquete_movimientos m JOIN paquetes_cliente pc ON pc.id = m.paquete_cliente_id
+		WHERE pc.cliente_id = $1 ORDER BY m.creado_en, m.id`, clienteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer movRows.Close()
+
+	for movRows.Next() {
+		var pcID int
+		var m MovimientoPaquete
+		if err := movRows.Scan(&pcID, &m.ID, &m.TurnoID, &m.Tipo, &m.Creditos, &m.CreadoEn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		i := indice[pcID]
+		paquetes[i].Movimientos = append(paquetes[i].Movimientos, m)
+	}
+
+	c.JSON(http.StatusOK, paquetes)
+}
+
+// Paquetes de un cliente, para la exportación de datos personales
+func paquetesDeCliente(db *sql.DB, clienteID int) ([]PaqueteCliente, error) {
+	rows, err := db.Query("SELECT "+columnasPaqueteCliente+fromPaquetesCliente+" WHERE pc.cliente_id=$1 ORDER BY pc.id", clienteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paquetes := []PaqueteCliente{}
+	for rows.Next() {
+		var pc PaqueteCliente
+		if err := scanPaqueteCliente(rows, &pc); err != nil {
+			return nil, err
+		}
+		paquetes = append(paquetes, pc)
+	}
+	return paquetes, rows.Err()
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Precios dinámicos: reglas de recargo/descuento por servicio, día, franja horaria,
+// empleado y segmento de cliente. Los porcentajes se aplican siempre sobre el precio base.
+
+// Resultado de cotizar un servicio, con el detalle de las reglas aplicadas
+type Cotizacion struct {
+	ServicioID int            `json:"servicio_id"`
+	PrecioBase Dinero         `json:"precio_base"`
+	Ajustes    []AjustePrecio `json:"ajustes"`
+	Precio     Dinero         `json:"precio"`
+	Moneda     string         `json:"moneda"`
+
+	// Membresía aplicada (descuento o servicio incluido en el período)
+	SuscripcionID     int  `json:"suscripcion_id,omitempty"`
+	IncluidoMembresia bool `json:"incluido_membresia,omitempty"`
+}
+
+type AjustePrecio struct {
+	ReglaID int    `json:"regla_id,omitempty"` // 0 en los ajustes de membresía
+	Nombre  string `json:"nombre"`
+	Monto   Dinero `json:"monto"` // positivo recargo, negativo descuento
+}
+
+const columnasReglaPrecio = `id, nombre, servicio_id, empleado_id, segmento_id, dias_semana,
+	TO_CHAR(hora_desde, 'HH24:MI'), TO_CHAR(hora_hasta, 'HH24:MI'),
+	TO_CHAR(vigente_desde, 'YYYY-MM-DD'), TO_CHAR(vigente_hasta, 'YYYY-MM-DD'),
+	tipo, valor, prioridad, activo`
+
+func scanReglaPrecio(sc scanner, r *ReglaPrecio) error {
+	return sc.Scan(&r.ID, &r.Nombre, &r.ServicioID, &r.EmpleadoID, &r.SegmentoID, pq.Array(&r.DiasSemana),
+		&r.HoraDesde, &r.HoraHasta, &r.VigenteDesde, &r.VigenteHasta, &r.Tipo, &r.Valor, &r.Prioridad, &r.Activo)
+}
+
+// Indica si el cliente cumple las reglas del segmento
+func clienteEnSegmento(q ejecutor, segmentoID, clienteID int) (bool, error) {
+	s, err := obtenerSegmento(q, segmentoID)
+	if err != nil {
+		return false, err
+	}
+
+	conds, args, err := condicionesSegmento(s.Reglas, []interface{}{clienteID})
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	err = q.QueryRow("SELECT EXISTS (SELECT 1 FROM clientes c WHERE c.id = $1 AND "+strings.Join(conds, " AND ")+")", args...).Scan(&ok)
+	return ok, err
+}
+
+// Cotizador de un servicio para un cliente en un día: carga una sola vez los precios del
+// día, las reglas candidatas y la membresía, y después cotiza cada empleado y horario en
+// memoria (la pertenencia a un segmento se consulta una vez por segmento).
+// clienteID en 0 significa "sin especificar": no aplican las reglas que lo requieren.
+type cotizador struct {
+	q          ejecutor
+	servicioID int
+	clienteID  int
+	precios    []precioDesde
+	reglas     []ReglaPrecio
+	membresia  *membresiaCliente
+	segmentos  map[int]bool
+}
+
+func nuevoCotizador(q ejecutor, servicioID, clienteID int, fecha string) (*cotizador, error) {
+	cz := &cotizador{q: q, servicioID: servicioID, clienteID: clienteID, segmentos: map[int]bool{}}
+
+	var err error
+	if cz.precios, err = preciosDelDia(q, servicioID, fecha); err != nil {
+		return nil, err
+	}
+
+	// Reglas candidatas del día; empleado, franja y segmento se resuelven al cotizar
+	rows, err := q.Query(`
+		SELECT `+columnasReglaPrecio+`
+		FROM reglas_precio
+		WHERE activo
+		  AND (servicio_id IS NULL OR servicio_id = $1)
+		  AND (cardinality(dias_semana) = 0 OR EXTRACT(ISODOW FROM $2::date)::int = ANY (dias_semana))
+		  AND (vigente_desde IS NULL OR $2::date >= vigente_desde)
+		  AND (vigente_hasta IS NULL OR $2::date <= vigente_hasta)
+		ORDER BY prioridad, id`, servicioID, fecha)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r ReglaPrecio
+		if err := scanReglaPrecio(rows, &r); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cz.reglas = append(cz.reglas, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if clienteID != 0 {
+		if cz.membresia, err = membresiaVigente(q, clienteID, fecha); err != nil {
+			return nil, err
+		}
+	}
+	return cz, nil
+}
+
+// Indica si una regla aplica al empleado y a la hora de inicio ("15:04:05").
+// empleadoID en 0 significa "sin especificar": no aplican las reglas de un empleado.
+func reglaAplica(r ReglaPrecio, empleadoID int, hora string) bool {
+	if r.EmpleadoID != nil && *r.EmpleadoID != empleadoID {
+		return false
+	}
+	hm := hora[:5] // las franjas son "15:04"
+	if r.HoraDesde != nil && hm < *r.HoraDesde {
+		return false
+	}
+	if r.HoraHasta != nil && hm >= *r.HoraHasta {
+		return false
+	}
+	return true
+}
+
+// Cotiza el servicio con un empleado y una hora de inicio ("15:04" o "15:04:05")
+func (cz *cotizador) cotizar(empleadoID int, hora string) (Cotizacion, error) {
+	cot := Cotizacion{ServicioID: cz.servicioID, Ajustes: []AjustePrecio{}}
+
+	hora, err := normalizarHora(hora)
+	if err != nil {
+		return cot, err
+	}
+
+	p := precioALaHora(cz.precios, hora)
+	base := p.Precio
+	cot.PrecioBase, cot.Moneda, cot.Precio = base, p.Moneda, base
+
+	for _, r := range cz.reglas {
+		if !reglaAplica(r, empleadoID, hora) {
+			continue
+		}
+		if r.SegmentoID != nil {
+			if cz.clienteID == 0 {
+				continue
+			}
+			ok, cargado := cz.segmentos[*r.SegmentoID]
+			if !cargado {
+				if ok, err = clienteEnSegmento(cz.q, *r.SegmentoID, cz.clienteID); err != nil {
+					return cot, err
+				}
+				cz.segmentos[*r.SegmentoID] = ok
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		monto := r.Valor
+		if r.Tipo == "porcentaje" {
+			monto = base.Porcentaje(r.Valor.Float64())
+		}
+		cot.Ajustes = append(cot.Ajustes, AjustePrecio{ReglaID: r.ID, Nombre: r.Nombre, Monto: monto})
+		cot.Precio += monto
+	}
+
+	if cot.Precio < 0 {
+		cot.Precio = 0
+	}
+
+	// Beneficios de la membresía, sobre el precio ya ajustado por las reglas
+	ajusteMembresia(&cot, cz.membresia)
+	return cot, nil
+}
+
+// Cotiza un servicio para una fecha ("2006-01-02") y hora de inicio ("15:04").
+// empleadoID y clienteID en 0 significan "sin especificar": no aplican las reglas que los requieren.
+func cotizar(q ejecutor, servicioID, empleadoID, clienteID int, fecha, hora string) (Cotizacion, error) {
+	cz, err := nuevoCotizador(q, servicioID, clienteID, fecha)
+	if err != nil {
+		return Cotizacion{ServicioID: servicioID, Ajustes: []AjustePrecio{}}, err
+	}
+	return cz.cotizar(empleadoID, hora)
+}
+
+// Normaliza una hora de inicio "15:04" o "15:04:05" a "15:04:05"
+func normalizarHora(hora string) (string, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, hora); err == nil {
+			return t.Format("15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("hora inválida: %s", hora)
+}
+
+// GET /cotizacion?servicio_id=1&fecha=2025-09-16&hora=18:30&empleado_id=2&cliente_id=3
+func getCotizacion(c *gin.Context, db *sql.DB) {
+	servicioID, err := strconv.Atoi(c.Query("servicio_id"))
+	fecha, hora := c.Query("fecha"), c.Query("hora")
+	if err != nil || fecha == "" || hora == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "servicio_id, fecha y hora son requeridos"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", fecha); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fecha inválida: usar AAAA-MM-DD"})
+		return
+	}
+	if _, err := normalizarHora(hora); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	empleadoID, _ := strconv.Atoi(c.Query("empleado_id"))
+	clienteID, _ := strconv.Atoi(c.Query("cliente_id"))
+
+	cot, err := cotizar(db, servicioID, empleadoID, clienteID, fecha, hora)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, cot)
+}
+
+func validarReglaPrecio(r *ReglaPrecio) error {
+	r.Nombre = strings.TrimSpace(r.Nombre)
+	if r.Nombre == "" {
+		return errors.New("nombre es requerido")
+	}
+	if r.Tipo != "porcentaje" && r.Tipo != "monto" {
+		return errors.New("tipo inválido: usar porcentaje o monto")
+	}
+	if r.Valor == 0 {
+		return errors.New("valor debe ser distinto de 0")
+	}
+	for _, d := range r.DiasSemana {
+		if d < 1 || d > 7 {
+			return errors.New("dias_semana: usar 1 (lunes) a 7 (domingo)")
+		}
+	}
+	if r.DiasSemana == nil {
+		r.DiasSemana = []int64{}
+	}
+
+	// Franja horaria "15:04" (vacío = sin límite); desde tiene que ser anterior a hasta
+	var err error
+	if r.HoraDesde, err = horaRegla(r.HoraDesde); err != nil {
+		return err
+	}
+	if r.HoraHasta, err = horaRegla(r.HoraHasta); err != nil {
+		return err
+	}
+	if r.HoraDesde != nil && r.HoraHasta != nil && *r.HoraDesde >= *r.HoraHasta {
+		return errors.New("hora_desde debe ser anterior a hora_hasta")
+	}
+	return nil
+}
+
+// Normaliza una hora de la franja de una regla a "15:04"; nil si viene vacía
+func horaRegla(h *string) (*string, error) {
+	if h == nil || strings.TrimSpace(*h) == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(*h))
+	if err != nil {
+		return nil, fmt.Errorf("hora inválida: %s (usar HH:MM)", *h)
+	}
+	hora := t.Format("15:04")
+	return &hora, nil
+}
+
+// Listar reglas de precio
+func getReglasPrecio(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT " + columnasReglaPrecio + " FROM reglas_precio ORDER BY prioridad, id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reglas := []ReglaPrecio{}
+	for rows.Next() {
+		var r ReglaPrecio
+		if err := scanReglaPrecio(rows, &r); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reglas = append(reglas, r)
+	}
+
+	c.JSON(http.StatusOK, reglas)
+}
+
+// Obtener regla de precio por ID
+func getReglaPrecio(c *gin.Context, db *sql.DB) {
+	var r ReglaPrecio
+	err := scanReglaPrecio(db.QueryRow("SELECT "+columnasReglaPrecio+" FROM reglas_precio WHERE id=$1", c.Param("id")), &r)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "regla no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// Crear regla de precio
+func createReglaPrecio(c *gin.Context, db *sql.DB) {
+	r := ReglaPrecio{Activo: true}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarReglaPrecio(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `INSERT INTO reglas_precio (nombre, servicio_id, empleado_id, segmento_id, dias_semana, hora_desde, hora_hasta,
+	              vigente_desde, vigente_hasta, tipo, valor, prioridad, activo)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`
+	err := db.QueryRow(query, r.Nombre, r.ServicioID, r.EmpleadoID, r.SegmentoID, pq.Array(r.DiasSemana), r.HoraDesde, r.HoraHasta,
+		r.VigenteDesde, r.VigenteHasta, r.Tipo, r.Valor, r.Prioridad, r.Activo).Scan(&r.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// Actualizar regla de precio
+func updateReglaPrecio(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	r := ReglaPrecio{Activo: true}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validarReglaPrecio(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `UPDATE reglas_precio SET nombre=$1, servicio_id=$2, empleado_id=$3, segmento_id=$4, dias_semana=$5,
+	              hora_desde=$6, hora_hasta=$7, vigente_desde=$8, vigente_hasta=$9, tipo=$10, valor=$11, prioridad=$12, activo=$13
+	          WHERE id=$14`
+	res, err := db.Exec(query, r.Nombre, r.ServicioID, r.EmpleadoID, r.SegmentoID, pq.Array(r.DiasSemana), r.HoraDesde, r.HoraHasta,
+		r.VigenteDesde, r.VigenteHasta, r.Tipo, r.Valor, r.Prioridad, r.Activo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "regla no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "regla actualizada"})
+}
+
+// Borrar regla de precio
+func deleteReglaPrecio(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	res, err := db.Exec("DELETE FROM reglas_precio WHERE id=$1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "regla no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "regla eliminada"})
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestValidarReglaPrecioFranja(t *testing.T) {
+	hora := func(h string) *string { return &h }
+	casos := []struct {
+		desde, hasta *string
+		ok           bool
+	}{
+		{nil, nil, true},
+		{hora("18:00"), nil, true},
+		{nil, hora("09:30"), true},
+		{hora("9:00"), hora("13:00"), true},
+		{hora(""), hora("13:00"), true},
+		{hora("13:00"), hora("13:00"), false},
+		{hora("20:00"), hora("08:00"), false},
+		{hora("25:00"), nil, false},
+		{hora("18hs"), nil, false},
+	}
+	for _, c := range casos {
+		r := ReglaPrecio{Nombre: "Regla", Tipo: "porcentaje", Valor: 1000, HoraDesde: c.desde, HoraHasta: c.hasta}
+		if err := validarReglaPrecio(&r); (err == nil) != c.ok {
+			t.Errorf("franja %v-%v: error %v, se esperaba ok=%v", c.desde, c.hasta, err, c.ok)
+		}
+	}
+}
+
+func TestReglaAplica(t *testing.T) {
+	emp, desde, hasta := 2, "18:00", "21:00"
+	r := ReglaPrecio{EmpleadoID: &emp, HoraDesde: &desde, HoraHasta: &hasta}
+	casos := []struct {
+		empleadoID int
+		hora       string
+		ok         bool
+	}{
+		{2, "18:00:00", true},
+		{2, "20:59:00", true},
+		{2, "21:00:00", false},
+		{2, "17:30:00", false},
+		{3, "19:00:00", false},
+		{0, "19:00:00", false},
+	}
+	for _, c := range casos {
+		if got := reglaAplica(r, c.empleadoID, c.hora); got != c.ok {
+			t.Errorf("reglaAplica(empleado %d, %s) = %v, se esperaba %v", c.empleadoID, c.hora, got, c.ok)
+		}
+	}
+}
+
+func TestPrecioALaHora(t *testing.T) {
+	precios := []precioDesde{
+		{Desde: "14:00:00", Precio: 300000},
+		{Desde: "", Precio: 250000},
+	}
+	casos := []struct {
+		hora   string
+		precio Dinero
+	}{
+		{"09:00:00", 250000},
+		{"13:59:00", 250000},
+		{"14:00:00", 300000},
+		{"18:30:00", 300000},
+	}
+	for _, c := range casos {
+		if got := precioALaHora(precios, c.hora).Precio; got != c.precio {
+			t.Errorf("precioALaHora(%s) = %d, se esperaba %d", c.hora, got, c.precio)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Programa de puntos: se acreditan al completar un turno y se canjean
+// como descuento en un turno futuro. Cada movimiento queda en puntos_movimientos.
+// Los movimientos de un cliente se escriben con su fila de clientes bloqueada
+// (bloquearClientePuntos), así dos operaciones simultáneas no usan el mismo saldo
+// ni registran dos veces el mismo vencimiento.
+
+// Total de movimientos y puntos vencidos que todavía no se registraron como vencimiento.
+// Los débitos (canjes, vencimientos, ajustes negativos) consumen primero los puntos más viejos.
+func puntosPendientesVencer(q ejecutor, clienteID int) (total, pendiente int, err error) {
+	var vencidos, debitos int
+	err = q.QueryRow(`
+		SELECT COALESCE(SUM(puntos), 0),
+		       COALESCE(SUM(puntos) FILTER (WHERE puntos > 0 AND vence_en < CURRENT_DATE), 0),
+		       COALESCE(-SUM(puntos) FILTER (WHERE puntos < 0), 0)
+		FROM puntos_movimientos WHERE cliente_id = $1`, clienteID).Scan(&total, &vencidos, &debitos)
+	if pendiente = vencidos - debitos; pendiente < 0 {
+		pendiente = 0
+	}
+	return total, pendiente, err
+}
+
+func bloquearClientePuntos(tx *sql.Tx, clienteID int) error {
+	var tmp int
+	return tx.QueryRow("SELECT id FROM clientes WHERE id=$1 FOR UPDATE", clienteID).Scan(&tmp)
+}
+
+// Registra como vencidos los puntos acreditados que ya vencieron y no se consumieron.
+// Requiere la fila del cliente bloqueada.
+func vencerPuntos(tx *sql.Tx, clienteID int) error {
+	_, pendiente, err := puntosPendientesVencer(tx, clienteID)
+	if err != nil || pendiente == 0 {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO puntos_movimientos (cliente_id, tipo, puntos, descripcion)
+	                  VALUES ($1, 'vencimiento', $2, 'Vencimiento de puntos')`, clienteID, -pendiente)
+	return err
+}
+
+// Saldo al día: descuenta los puntos vencidos aunque el vencimiento todavía no se haya
+// registrado. Solo lee, así que se puede usar sin bloquear al cliente.
+func saldoPuntos(q ejecutor, clienteID int) (int, error) {
+	total, pendiente, err := puntosPendientesVencer(q, clienteID)
+	return total - pendiente, err
+}
+
+// Registra los vencimientos pendientes de todos los clientes, cada uno en su transacción
+func vencerPuntosPendientes(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT cliente_id FROM puntos_movimientos GROUP BY cliente_id
+		HAVING COALESCE(SUM(puntos) FILTER (WHERE puntos > 0 AND vence_en < CURRENT_DATE), 0)
+		     + COALESCE(SUM(puntos) FILTER (WHERE puntos < 0), 0) > 0`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		err = bloquearClientePuntos(tx, id)
+		if err == nil {
+			err = vencerPuntos(tx, id)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// Registra los vencimientos de puntos al arrancar y cada hora
+func iniciarVencimientoPuntos(db *sql.DB) {
+	go func() {
+		for {
+			if err := vencerPuntosPendientes(db); err != nil {
+				log.Println("Error venciendo puntos:", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// Acredita los puntos de un turno completado. Es idempotente: un turno acredita una sola vez.
+func acreditarPuntosTurno(db *sql.DB, q ejecutor, turnoID int) error {
+	porCada := configInt(db, "puntos_por_cada")
+	if porCada <= 0 {
+		porCada = 0 // sin acreditación por precio, solo la regla fija del servicio
+	}
+
+	_, err := q.Exec(`
+		INSERT INTO puntos_movimientos (cliente_id, turno_id, tipo, puntos, vence_en, descripcion)
+		SELECT t.cliente_id, t.id, 'acreditacion', p.puntos, CURRENT_DATE + $3::int, 'Turno completado: ' || s.nombre
+		FROM turnos t
+		JOIN servicios s ON s.id = t.servicio_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(s.puntos, CASE WHEN $2::int > 0 THEN FLOOR(t.precio_final / $2::int)::int ELSE 0 END) AS puntos
+		) p
+		WHERE t.id = $1 AND t.estado = 'completado' AND p.puntos > 0
+		ON CONFLICT DO NOTHING`,
+		turnoID, porCada, configInt(db, "puntos_vencimiento_dias"))
+	return err
+}
+
+// Canjea puntos como descuento en un turno. Devuelve el importe del descuento.
+func canjearPuntos(db *sql.DB, tx *sql.Tx, clienteID, turnoID, puntos int) (Dinero, error) {
+	if puntos < 0 {
+		return 0, errors.New("puntos_canje inválido")
+	}
+
+	// Bloquear al cliente para que dos canjes simultáneos no usen el mismo saldo
+	if err := bloquearClientePuntos(tx, clienteID); err != nil {
+		return 0, err
+	}
+	if err := vencerPuntos(tx, clienteID); err != nil {
+		return 0, err
+	}
+
+	saldo, err := saldoPuntos(tx, clienteID)
+	if err != nil {
+		return 0, err
+	}
+	if puntos > saldo {
+		return 0, fmt.Errorf("puntos insuficientes: saldo %d, canje %d", saldo, puntos)
+	}
+
+	_, err = tx.Exec(`INSERT INTO puntos_movimientos (cliente_id, turno_id, tipo, puntos, descripcion)
+	                  VALUES ($1, $2, 'canje', $3, 'Canje en turno')`, clienteID, turnoID, -puntos)
+	if err != nil {
+		return 0, err
+	}
+
+	return pesos(puntos * configInt(db, "puntos_valor")), nil
+}
+
+// Devuelve los puntos canjeados en un turno cancelado (una sola vez)
+func reintegrarCanjePuntos(db *sql.DB, q ejecutor, turnoID int) error {
+	_, err := q.Exec(`
+		INSERT INTO puntos_movimientos (cliente_id, turno_id, tipo, puntos, vence_en, descripcion)
+		SELECT cliente_id, turno_id, 'reintegro', -puntos, CURRENT_DATE + $2::int, 'Reintegro por turno cancelado'
+		FROM puntos_movimientos
+		WHERE turno_id = $1 AND tipo = 'canje'
+		ON CONFLICT DO NOTHING`, turnoID, configInt(db, "puntos_vencimiento_dias"))
+	return err
+}
+
+// Descuenta los puntos acreditados por un turno completado que después se cancela.
+// Se descuenta como máximo el saldo actual (lo ya canjeado o vencido no se recupera)
+// y, como la acreditación, una sola vez por turno.
+func anularAcreditacionPuntos(tx *sql.Tx, turnoID int) error {
+	var clienteID, puntos int
+	err := tx.QueryRow(`SELECT cliente_id, puntos FROM puntos_movimientos WHERE turno_id = $1 AND tipo = 'acreditacion'`,
+		turnoID).Scan(&clienteID, &puntos)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := bloquearClientePuntos(tx, clienteID); err != nil {
+		return err
+	}
+	if err := vencerPuntos(tx, clienteID); err != nil {
+		return err
+	}
+	saldo, err := saldoPuntos(tx, clienteID)
+	if err != nil {
+		return err
+	}
+	if puntos > saldo {
+		puntos = saldo
+	}
+	if puntos <= 0 {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO puntos_movimientos (cliente_id, turno_id, tipo, puntos, descripcion)
+	                  VALUES ($1, $2, 'anulacion', $3, 'Anulación por turno cancelado')
+	                  ON CONFLICT DO NOTHING`, clienteID, turnoID, -puntos)
+	return err
+}
+
+func movimientosPuntos(q ejecutor, clienteID int) ([]MovimientoPuntos, error) {
+	rows, err := q.Query(`
+		SELECT id, cliente_id, turno_id, tipo, puntos, vence_en, descripcion, creado_en,
+		       SUM(puntos) OVER (ORDER BY creado_en, id)
+		FROM puntos_movimientos
+		WHERE cliente_id = $1
+		ORDER BY creado_en, id`, clienteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movimientos := []MovimientoPuntos{}
+	for rows.Next() {
+		var m MovimientoPuntos
+		if err := rows.Scan(&m.ID, &m.ClienteID, &m.TurnoID, &m.Tipo, &m.Puntos, &m.VenceEn,
+			&m.Descripcion, &m.CreadoEn, &m.Saldo); err != nil {
+			return nil, err
+		}
+		movimientos = append(movimientos, m)
+	}
+	return movimientos, rows.Err()
+}
+
+// Valida el :id de la ruta y que el cliente exista
+func clienteIDParam(c *gin.Context, db *sql.DB) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return 0, false
+	}
+	var tmp int
+	if err := db.QueryRow("SELECT id FROM clientes WHERE id=$1", id).Scan(&tmp); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cliente no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /clientes/:id/puntos
+func getPuntosCliente(c *gin.Context, db *sql.DB) {
+	id, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	saldo, err := saldoPuntos(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cliente_id":  id,
+		"saldo":       saldo,
+		"valor_pesos": saldo * configInt(db, "puntos_valor"),
+	})
+}
+
+// GET /clientes/:id/puntos/movimientos
+func getMovimientosPuntos(c *gin.Context, db *sql.DB) {
+	id, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	movimientos, err := movimientosPuntos(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, movimientos)
+}
+
+// POST /clientes/:id/puntos/ajustes  { "puntos": -50, "descripcion": "corrección" }
+func createAjustePuntos(c *gin.Context, db *sql.DB) {
+	id, ok := clienteIDParam(c, db)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Puntos      int    `json:"puntos"`
+		Descripcion string `json:"descripcion"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Puntos == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "puntos debe ser distinto de 0"})
+		return
+	}
+	if body.Descripcion == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "descripcion es requerida"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	err = bloquearClientePuntos(tx, id)
+	if err == nil {
+		err = vencerPuntos(tx, id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if body.Puntos < 0 {
+		saldo, err := saldoPuntos(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if saldo+body.Puntos < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("el ajuste deja el saldo en negativo (saldo %d)", saldo)})
+			return
+		}
+	}
+
+	var vence interface{}
+	if body.Puntos > 0 {
+		vence = time.Now().AddDate(0, 0, configInt(db, "puntos_vencimiento_dias")).Format("2006-01-02")
+	}
+
+	var m MovimientoPuntos
+	err = tx.QueryRow(`INSERT INTO puntos_movimientos (cliente_id, tipo, puntos, vence_en, descripcion)
+	                   VALUES ($1, 'ajuste', $2, $3, $4)
+	                   RETURNING id, cliente_id, turno_id, tipo, puntos, vence_en, descripcion, creado_en`,
+		id, body.Puntos, vence, body.Descripcion).
+		Scan(&m.ID, &m.ClienteID, &m.TurnoID, &m.Tipo, &m.Puntos, &m.VenceEn, &m.Descripcion, &m.CreadoEn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Utilidades comunes de los reportes
+
+const maxDiasReporte = 366
+
+// Rango desde/hasta de la query (inclusive). Por defecto, el mes en curso hasta hoy.
+func rangoReporte(c *gin.Context) (time.Time, time.Time, error) {
+	hoy := time.Now().Format("2006-01-02")
+	desde, err1 := time.Parse("2006-01-02", c.DefaultQuery("desde", hoy[:8]+"01"))
+	hasta, err2 := time.Parse("2006-01-02", c.DefaultQuery("hasta", hoy))
+	if err1 != nil || err2 != nil {
+		return time.Time{}, time.Time{}, errors.New("fechas inválidas: usar YYYY-MM-DD")
+	}
+	if hasta.Before(desde) {
+		return time.Time{}, time.Time{}, errors.New("hasta debe ser posterior a desde")
+	}
+	if diasEntre(desde, hasta) > maxDiasReporte {
+		return time.Time{}, time.Time{}, fmt.Errorf("el rango no puede superar %d días", maxDiasReporte)
+	}
+	return desde, hasta, nil
+}
+
+// Filtros opcionales empleado_id y servicio_id (0 = todos)
+func filtrosReporte(c *gin.Context) ([2]int, error) {
+	var filtros [2]int
+	for i, nombre := range []string{"empleado_id", "servicio_id"} {
+		if v := c.Query(nombre); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return filtros, fmt.Errorf("%s inválido", nombre)
+			}
+			filtros[i] = id
+		}
+	}
+	return filtros, nil
+}
+
+// Cantidad de días del rango, contando ambos extremos
+func diasEntre(desde, hasta time.Time) int {
+	return int(math.Round(hasta.Sub(desde).Hours()/24)) + 1
+}
+
+// Variación porcentual respecto de un valor anterior (nil si no hay base de comparación)
+func variacion(actual, anterior float64) *float64 {
+	if anterior == 0 {
+		return nil
+	}
+	v := math.Round((actual-anterior)/anterior*1000) / 10
+	return &v
+}
+
+// Porcentaje de parte sobre total, con un decimal (nil si el total es cero)
+func porcentaje(parte, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	v := math.Round(float64(parte)/float64(total)*1000) / 10
+	return &v
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cancelaciones y ausencias: tasas por día, hora, servicio, cliente y motivo,
+// anticipación de las cancelaciones e ingreso perdido.
+//   - tasa_cancelacion: cancelados sobre el total de turnos
+//   - tasa_no_show: no_show sobre los turnos que llegaron a su hora (completados + no_show)
+//   - ingreso_perdido: precio no cobrado de ausencias y cancelaciones tardías
+//     (con menos de cancelacion_tardia_horas); lo ya cobrado (señas) se informa como retenido
+//   - cancelaciones_ajenas: las que canceló el local, el clima o la seña (motivosAjenosCliente);
+//     cuentan en cancelados pero no como tardías ni como ingreso perdido
+
+type MetricasCancelacion struct {
+	Turnos               int      `json:"turnos"`
+	Completados          int      `json:"completados"`
+	Cancelados           int      `json:"cancelados"`
+	CancelacionesTardias int      `json:"cancelaciones_tardias"`
+	CancelacionesAjenas  int      `json:"cancelaciones_ajenas"`
+	NoShows              int      `json:"no_shows"`
+	TasaCancelacion      *float64 `json:"tasa_cancelacion"` // porcentaje
+	TasaNoShow           *float64 `json:"tasa_no_show"`     // porcentaje
+	IngresoPerdido       Dinero   `json:"ingreso_perdido"`
+	Retenido             Dinero   `json:"retenido"`
+}
+
+type FilaCancelaciones struct {
+	Clave    string `json:"clave"`
+	Etiqueta string `json:"etiqueta"`
+	MetricasCancelacion
+}
+
+// Dimensiones: clave, etiqueta y un filtro adicional sobre la base
+type dimensionCancelaciones struct {
+	clave, etiqueta, donde string
+}
+
+var dimensionesCancelaciones = map[string]dimensionCancelaciones{
+	"total":      {"'total'", "'Total'", "TRUE"},
+	"dia_semana": {"EXTRACT(ISODOW FROM b.fecha)::text", "''", "TRUE"},
+	"hora":       {"LPAD(EXTRACT(HOUR FROM b.hora_inicio)::text, 2, '0')", "''", "TRUE"},
+	"servicio":   {"b.servicio_id::text", "s.nombre", "TRUE"},
+	"cliente":    {"b.cliente_id::text", "c.nombre || ' ' || c.apellido", "TRUE"},
+	"motivo":     {"COALESCE(b.motivo_cancelacion, 'sin_motivo')", "''", "b.estado = 'cancelado'"},
+}
+
+// Turnos del rango con lo cobrado, la anticipación de la cancelación en horas y si
+// la cancelación fue ajena al cliente
+var baseCancelaciones = `
+	WITH base AS (
+		SELECT t.id, t.cliente_id, t.servicio_id, t.fecha, t.hora_inicio, t.estado, t.motivo_cancelacion,
+		       COALESCE(t.precio_final, 0) AS precio_final,
+		       COALESCE((SELECT SUM(p.monto) FROM pagos p WHERE p.turno_id = t.id), 0) AS cobrado,
+		       EXTRACT(EPOCH FROM (t.fecha + t.hora_inicio::time) - t.cancelado_en) / 3600 AS anticipacion_horas,
+		       (t.estado = 'cancelado' AND NOT ` + cancelacionDelCliente("t.motivo_cancelacion") + `) AS ajena
+		FROM turnos t
+		WHERE t.fecha BETWEEN $1 AND $2 AND ($3 = 0 OR t.empleado_id = $3) AND ($4 = 0 OR t.servicio_id = $4)
+	),
+	perdidos AS (
+		SELECT b.*, (b.estado = 'no_show' OR (b.estado = 'cancelado' AND NOT b.ajena AND b.anticipacion_horas < $5)) AS perdido
+		FROM base b
+	)`
+
+func agregarCancelaciones(db *sql.DB, d dimensionCancelaciones, desde, hasta time.Time, empleadoID, servicioID, horasTardia int) ([]FilaCancelaciones, error) {
+	rows, err := db.Query(baseCancelaciones+`
+		SELECT `+d.clave+`, `+d.etiqueta+`,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE b.estado = 'completado'),
+		       COUNT(*) FILTER (WHERE b.estado = 'cancelado'),
+		       COUNT(*) FILTER (WHERE b.estado = 'cancelado' AND NOT b.ajena AND b.anticipacion_horas < $5),
+		       COUNT(*) FILTER (WHERE b.ajena),
+		       COUNT(*) FILTER (WHERE b.estado = 'no_show'),
+		       COALESCE(SUM(GREATEST(b.precio_final - b.cobrado, 0)) FILTER (WHERE b.perdido), 0),
+		       COALESCE(SUM(b.cobrado) FILTER (WHERE b.estado IN ('cancelado', 'no_show')), 0)
+		FROM perdidos b
+		JOIN servicios s ON s.id = b.servicio_id
+		JOIN clientes c ON c.id = b.cliente_id
+		WHERE `+d.donde+`
+		GROUP BY 1, 2
+		ORDER BY 1`,
+		desde.Format("2006-01-02"), hasta.Format("2006-01-02"), empleadoID, servicioID, horasTardia)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filas := []FilaCancelaciones{}
+	for rows.Next() {
+		var f FilaCancelaciones
+		m := &f.MetricasCancelacion
+		err := rows.Scan(&f.Clave, &f.Etiqueta, &m.Turnos, &m.Completados, &m.Cancelados, &m.CancelacionesTardias,
+			&m.CancelacionesAjenas, &m.NoShows, &m.IngresoPerdido, &m.Retenido)
+		if err != nil {
+			return nil, err
+		}
+		m.TasaCancelacion = porcentaje(m.Cancelados, m.Turnos)
+		m.TasaNoShow = porcentaje(m.NoShows, m.Completados+m.NoShows)
+		filas = append(filas, f)
+	}
+	return filas, rows.Err()
+}
+
+// Tramos de anticipación de las cancelaciones, en horas antes del inicio del turno
+type TramoAnticipacion struct {
+	Tramo      string `json:"tramo"`
+	Cancelados int    `json:"cancelados"`
+}
+
+type AnticipacionCancelaciones struct {
+	PromedioHoras *float64            `json:"promedio_horas"`
+	MedianaHoras  *float64            `json:"mediana_horas"`
+	Tramos        []TramoAnticipacion `json:"tramos"`
+}
+
+var tramosAnticipacion = []struct {
+	nombre string
+	hasta  float64 // horas (excluido)
+}{
+	{"después del inicio", 0},
+	{"menos de 2 h", 2},
+	{"2 a 12 h", 12},
+	{"12 a 24 h", 24},
+	{"24 a 48 h", 48},
+	{"2 a 7 días", 168},
+	{"más de 7 días", math.Inf(1)},
+}
+
+func anticipacionCancelaciones(db *sql.DB, desde, hasta time.Time, empleadoID, servicioID, horasTardia int) (AnticipacionCancelaciones, error) {
+	a := AnticipacionCancelaciones{Tramos: []TramoAnticipacion{}}
+	args := []interface{}{desde.Format("2006-01-02"), hasta.Format("2006-01-02"), empleadoID, servicioID, horasTardia}
+	err := db.QueryRow(baseCancelaciones+`
+		SELECT ROUND(AVG(anticipacion_horas)::numeric, 1)::float8,
+		       ROUND((PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY anticipacion_horas))::numeric, 1)::float8
+		FROM perdidos WHERE estado = 'cancelado' AND anticipacion_horas IS NOT NULL`, args...).
+		Scan(&a.PromedioHoras, &a.MedianaHoras)
+	if err != nil {
+		return a, err
+	}
+
+	// El tramo se calcula en SQL con un CASE armado desde tramosAnticipacion
+	caso := "CASE"
+	for i, t := range tramosAnticipacion {
+		if math.IsInf(t.hasta, 1) {
+			caso += " ELSE " + strconv.Itoa(i)
+			break
+		}
+		caso += " WHEN anticipacion_horas < " + strconv.FormatFloat(t.hasta, 'f', -1, 64) + " THEN " + strconv.Itoa(i)
+	}
+	caso += " END"
+
+	rows, err := db.Query(baseCancelaciones+`
+		SELECT `+caso+`, COUNT(*)
+		FROM perdidos WHERE estado = 'cancelado' AND anticipacion_horas IS NOT NULL
+		GROUP BY 1`, args...)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	cantidades := make([]int, len(tramosAnticipacion))
+	for rows.Next() {
+		var i, n int
+		if err := rows.Scan(&i, &n); err != nil {
+			return a, err
+		}
+		cantidades[i] = n
+	}
+	for i, t := range tramosAnticipacion {
+		a.Tramos = append(a.Tramos, TramoAnticipacion{Tramo: t.nombre, Cancelados: cantidades[i]})
+	}
+	return a, rows.Err()
+}
+
+// GET /reportes/cancelaciones?desde=2025-09-01&hasta=2025-09-30&empleado_id=&servicio_id=&min_turnos=3
+// min_turnos: turnos mínimos de un cliente para figurar en el ranking (por defecto 3)
+func getReporteCancelaciones(c *gin.Context, db *sql.DB) {
+	desde, hasta, err := rangoReporte(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filtros, err := filtrosReporte(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	minTurnos, err := strconv.Atoi(c.DefaultQuery("min_turnos", "3"))
+	if err != nil || minTurnos < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_turnos inválido"})
+		return
+	}
+
+	horasTardia := configInt(db, "cancelacion_tardia_horas")
+	agregar := func(dimension string) ([]FilaCancelaciones, error) {
+		return agregarCancelaciones(db, dimensionesCancelaciones[dimension], desde, hasta, filtros[0], filtros[1], horasTardia)
+	}
+
+	res := gin.H{
+		"desde":                    desde.Format("2006-01-02"),
+		"hasta":                    hasta.Format("2006-01-02"),
+		"cancelacion_tardia_horas": horasTardia,
+	}
+	for _, dimension := range []string{"total", "dia_semana", "hora", "servicio", "cliente", "motivo"} {
+		filas, err := agregar(dimension)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch dimension {
+		case "total":
+			total := MetricasCancelacion{}
+			if len(filas) > 0 {
+				total = filas[0].MetricasCancelacion
+			}
+			res["total"] = total
+			continue
+		case "dia_semana":
+			for i := range filas {
+				dia, _ := strconv.Atoi(filas[i].Clave)
+				filas[i].Etiqueta = diasSemana[dia%7]
+			}
+		case "hora":
+			for i := range filas {
+				filas[i].Etiqueta = filas[i].Clave + ":00"
+			}
+		case "motivo":
+			for i := range filas {
+				filas[i].Etiqueta = motivosCancelacion[filas[i].Clave]
+				if filas[i].Etiqueta == "" {
+					filas[i].Etiqueta = "Sin motivo"
+				}
+			}
+		case "cliente":
+			// Ranking: clientes con ausencias o cancelaciones y un mínimo de turnos, peor tasa primero
+			clientes := []FilaCancelaciones{}
+			for _, f := range filas {
+				if f.Turnos >= minTurnos && f.NoShows+f.Cancelados > 0 {
+					clientes = append(clientes, f)
+				}
+			}
+			ordenarPorTasaNoShow(clientes)
+			if len(clientes) > 20 {
+				clientes = clientes[:20]
+			}
+			filas = clientes
+		}
+		if dimension == "servicio" {
+			ordenarPorTasaNoShow(filas)
+		}
+		res["por_"+dimension] = filas
+	}
+
+	anticipacion, err := anticipacionCancelaciones(db, desde, hasta, filtros[0], filtros[1], horasTardia)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res["anticipacion"] = anticipacion
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Mayor tasa de no_show primero; a igual tasa, más ausencias
+func ordenarPorTasaNoShow(filas []FilaCancelaciones) {
+	tasa := func(f FilaCancelaciones) float64 {
+		if f.TasaNoShow == nil {
+			return -1
+		}
+		return *f.TasaNoShow
+	}
+	sort.SliceStable(filas, func(i, j int) bool {
+		if tasa(filas[i]) != tasa(filas[j]) {
+			return tasa(filas[i]) > tasa(filas[j])
+		}
+		return filas[i].NoShows > filas[j].NoShows
+	})
+}
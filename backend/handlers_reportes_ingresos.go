@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ingresos del negocio. Se distinguen dos montos:
+//   - reservado: precio final de los turnos del período (por fecha del turno, sin cancelados)
+//   - cobrado: pagos menos reintegros registrados en el período (por fecha del pago) más
+//     las ventas de paquetes, tarjetas de regalo y períodos de membresía (por fecha de venta o pago)
+// Pagar un turno con un paquete o una tarjeta de regalo no es un ingreso nuevo (se cobró al
+// venderlos): esos consumos se informan aparte, en consumo_prepagos.
+// Todo se agrega en SQL; Go solo combina los períodos.
+
+// Agrupación del reporte: expresiones de clave y etiqueta para turnos, pagos y ventas.
+// Las consultas de turnos y pagos tienen disponibles los alias t, e y s; la de pagos además p.
+// La de ventas tiene v (ver ventasIngresos) y s (servicio del paquete); una clave NULL
+// deja la venta fuera de la agrupación.
+type agrupacionIngresos struct {
+	claveTurno, etiquetaTurno string // vacías: la dimensión no aplica a lo reservado
+	clavePago, etiquetaPago   string
+	claveVenta, etiquetaVenta string
+	temporal                  bool
+}
+
+var agrupacionesIngresos = map[string]agrupacionIngresos{
+	"total": {"'total'", "'Total'", "'total'", "'Total'", "'total'", "'Total'", false},
+	"dia": {"TO_CHAR(t.fecha, 'YYYY-MM-DD')", "TO_CHAR(t.fecha, 'YYYY-MM-DD')",
+		"TO_CHAR(p.creado_en, 'YYYY-MM-DD')", "TO_CHAR(p.creado_en, 'YYYY-MM-DD')",
+		"TO_CHAR(v.fecha, 'YYYY-MM-DD')", "TO_CHAR(v.fecha, 'YYYY-MM-DD')", true},
+	"semana": {"TO_CHAR(DATE_TRUNC('week', t.fecha), 'YYYY-MM-DD')", "TO_CHAR(t.fecha, 'IYYY-\"S\"IW')",
+		"TO_CHAR(DATE_TRUNC('week', p.creado_en), 'YYYY-MM-DD')", "TO_CHAR(p.creado_en, 'IYYY-\"S\"IW')",
+		"TO_CHAR(DATE_TRUNC('week', v.fecha), 'YYYY-MM-DD')", "TO_CHAR(v.fecha, 'IYYY-\"S\"IW')", true},
+	"mes": {"TO_CHAR(t.fecha, 'YYYY-MM')", "TO_CHAR(t.fecha, 'YYYY-MM')",
+		"TO_CHAR(p.creado_en, 'YYYY-MM')", "TO_CHAR(p.creado_en, 'YYYY-MM')",
+		"TO_CHAR(v.fecha, 'YYYY-MM')", "TO_CHAR(v.fecha, 'YYYY-MM')", true},
+	// Las ventas no tienen empleado; de los servicios, solo los paquetes
+	"empleado": {"t.empleado_id::text", "e.nombre || ' ' || e.apellido",
+		"t.empleado_id::text", "e.nombre || ' ' || e.apellido", "NULL", "NULL", false},
+	"servicio": {"t.servicio_id::text", "s.nombre", "t.servicio_id::text", "s.nombre", "v.servicio_id::text", "s.nombre", false},
+	// Paquetes y tarjetas se venden sin registrar el método: se agrupan por producto
+	"metodo": {"", "", "p.metodo", "p.metodo",
+		"COALESCE(v.metodo, 'venta_' || v.origen)", "COALESCE(v.metodo, 'venta_' || v.origen)", false},
+}
+
+// Ventas de prepagos y membresías: fecha, método (si se registró), origen, servicio (paquetes) y monto
+const ventasIngresos = `
+	SELECT pc.comprado_en AS fecha, NULL::text AS metodo, 'paquete' AS origen, pc.servicio_id, pc.precio AS monto
+	FROM paquetes_cliente pc
+	UNION ALL
+	SELECT tr.creado_en, NULL, 'tarjeta_regalo', NULL, tr.monto FROM tarjetas_regalo tr
+	UNION ALL
+	SELECT sp.pagado_en, sp.metodo, 'membresia', NULL, sp.precio FROM suscripcion_periodos sp WHERE sp.pagado_en IS NOT NULL`
+
+var nombresVenta = map[string]string{
+	"venta_paquete":        "Venta de paquetes",
+	"venta_tarjeta_regalo": "Venta de tarjetas de regalo",
+}
+
+type MontosIngresos struct {
+	Turnos          int    `json:"turnos"`
+	Reservado       Dinero `json:"reservado"`
+	Cobrado         Dinero `json:"cobrado"`
+	Propinas        Dinero `json:"propinas"`
+	ConsumoPrepagos Dinero `json:"consumo_prepagos"` // turnos pagados con paquete o tarjeta de regalo
+}
+
+type ComparacionIngresos struct {
+	Desde              string   `json:"desde"`
+	Hasta              string   `json:"hasta"`
+	MontosIngresos              // del período de comparación
+	VariacionReservado *float64 `json:"variacion_reservado"` // porcentaje
+	VariacionCobrado   *float64 `json:"variacion_cobrado"`
+}
+
+type FilaIngresos struct {
+	Clave    string `json:"clave"`
+	Etiqueta string `json:"etiqueta"`
+	MontosIngresos
+	PeriodoAnterior *ComparacionIngresos `json:"periodo_anterior,omitempty"`
+	AnioAnterior    *ComparacionIngresos `json:"anio_anterior,omitempty"`
+}
+
+// Agrega turnos y pagos de un rango según la agrupación, una fila por clave
+func agregarIngresos(db *sql.DB, a agrupacionIngresos, desde, hasta time.Time, empleadoID, servicioID int) ([]FilaIngresos, error) {
+	reservado := `SELECT NULL::text AS clave, NULL::text AS etiqueta, 0::bigint AS turnos, 0::numeric AS reservado WHERE FALSE`
+	if a.claveTurno != "" {
+		reservado = `
+		SELECT ` + a.claveTurno + ` AS clave, ` + a.etiquetaTurno + ` AS etiqueta,
+		       COUNT(*) AS turnos, SUM(COALESCE(t.precio_final, 0)) AS reservado
+		FROM turnos t
+		JOIN empleados e ON e.id = t.empleado_id
+		JOIN servicios s ON s.id = t.servicio_id
+		WHERE t.fecha BETWEEN $1 AND $2 AND t.estado != 'cancelado'
+		  AND ($3 = 0 OR t.empleado_id = $3) AND ($4 = 0 OR t.servicio_id = $4)
+		GROUP BY 1, 2`
+	}
+
+	rows, err := db.Query(`
+		WITH reservado AS (`+reservado+`),
+		cobrado AS (
+			SELECT clave, etiqueta, SUM(cobrado) AS cobrado, SUM(propinas) AS propinas, SUM(prepagos) AS prepagos
+			FROM (
+				SELECT `+a.clavePago+` AS clave, `+a.etiquetaPago+` AS etiqueta,
+				       CASE WHEN p.metodo IN ('paquete', 'tarjeta_regalo') THEN 0 ELSE p.monto END AS cobrado,
+				       p.propina AS propinas,
+				       CASE WHEN p.metodo IN ('paquete', 'tarjeta_regalo') THEN p.monto ELSE 0 END AS prepagos
+				FROM pagos p
+				JOIN turnos t ON t.id = p.turno_id
+				JOIN empleados e ON e.id = t.empleado_id
+				JOIN servicios s ON s.id = t.servicio_id
+				WHERE p.creado_en >= $1::date AND p.creado_en < $2::date + 1
+				  AND ($3 = 0 OR t.empleado_id = $3) AND ($4 = 0 OR t.servicio_id = $4)
+				UNION ALL
+				SELECT `+a.claveVenta+`, `+a.etiquetaVenta+`, v.monto, 0, 0
+				FROM (`+ventasIngresos+`) v
+				LEFT JOIN servicios s ON s.id = v.servicio_id
+				WHERE v.fecha >= $1::date AND v.fecha < $2::date + 1
+				  AND $3 = 0 AND ($4 = 0 OR v.servicio_id = $4)
+			) x
+			WHERE clave IS NOT NULL
+			GROUP BY 1, 2
+		)
+		SELECT COALESCE(r.clave, c.clave), COALESCE(r.etiqueta, c.etiqueta),
+		       COALESCE(r.turnos, 0), COALESCE(r.reservado, 0), COALESCE(c.cobrado, 0), COALESCE(c.propinas, 0),
+		       COALESCE(c.prepagos, 0)
+		FROM reservado r
+		FULL JOIN cobrado c ON c.clave = r.clave
+		ORDER BY 1`,
+		desde.Format("2006-01-02"), hasta.Format("2006-01-02"), empleadoID, servicioID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filas := []FilaIngresos{}
+	for rows.Next() {
+		var f FilaIngresos
+		if err := rows.Scan(&f.Clave, &f.Etiqueta, &f.Turnos, &f.Reservado, &f.Cobrado, &f.Propinas, &f.ConsumoPrepagos); err != nil {
+			return nil, err
+		}
+		if a.claveTurno == "" {
+			if nombre, ok := nombresMetodo[f.Etiqueta]; ok {
+				f.Etiqueta = nombre
+			} else if nombre, ok := nombresVenta[f.Etiqueta]; ok {
+				f.Etiqueta = nombre
+			}
+		}
+		filas = append(filas, f)
+	}
+	return filas, rows.Err()
+}
+
+func comparacion(actual, anterior MontosIngresos, desde, hasta time.Time) *ComparacionIngresos {
+	return &ComparacionIngresos{
+		Desde:              desde.Format("2006-01-02"),
+		Hasta:              hasta.Format("2006-01-02"),
+		MontosIngresos:     anterior,
+		VariacionReservado: variacion(actual.Reservado.Float64(), anterior.Reservado.Float64()),
+		VariacionCobrado:   variacion(actual.Cobrado.Float64(), anterior.Cobrado.Float64()),
+	}
+}
+
+// GET /reportes/ingresos?desde=2025-09-01&hasta=2025-09-30&agrupar=dia|semana|mes|empleado|servicio|metodo&empleado_id=&servicio_id=
+// Compara con el período inmediato anterior de igual duración y con el mismo período del año anterior.
+// En las agrupaciones por empleado, servicio o método cada fila trae también su comparación.
+func getReporteIngresos(c *gin.Context, db *sql.DB) {
+	desde, hasta, err := rangoReporte(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nombreAgrupacion := c.DefaultQuery("agrupar", "dia")
+	agrupacion, ok := agrupacionesIngresos[nombreAgrupacion]
+	if !ok || nombreAgrupacion == "total" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agrupar inválido: usar dia, semana, mes, empleado, servicio o metodo"})
+		return
+	}
+
+	filtros, err := filtrosReporte(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Períodos de comparación
+	dias := diasEntre(desde, hasta)
+	anteriorDesde, anteriorHasta := desde.AddDate(0, 0, -dias), desde.AddDate(0, 0, -1)
+	anioDesde, anioHasta := desde.AddDate(-1, 0, 0), hasta.AddDate(-1, 0, 0)
+
+	periodos := []struct{ desde, hasta time.Time }{{desde, hasta}, {anteriorDesde, anteriorHasta}, {anioDesde, anioHasta}}
+	var totales [3]MontosIngresos
+	for i, p := range periodos {
+		filas, err := agregarIngresos(db, agrupacionesIngresos["total"], p.desde, p.hasta, filtros[0], filtros[1])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(filas) > 0 {
+			totales[i] = filas[0].MontosIngresos
+		}
+	}
+
+	grupos, err := agregarIngresos(db, agrupacion, desde, hasta, filtros[0], filtros[1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Las claves temporales no se corresponden entre períodos; el resto se compara fila a fila
+	if !agrupacion.temporal {
+		for n, p := range periodos[1:] {
+			anteriores, err := agregarIngresos(db, agrupacion, p.desde, p.hasta, filtros[0], filtros[1])
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			montos := map[string]MontosIngresos{}
+			for _, a := range anteriores {
+				montos[a.Clave] = a.MontosIngresos
+			}
+			for i := range grupos {
+				comp := comparacion(grupos[i].MontosIngresos, montos[grupos[i].Clave], p.desde, p.hasta)
+				if n == 0 {
+					grupos[i].PeriodoAnterior = comp
+				} else {
+					grupos[i].AnioAnterior = comp
+				}
+			}
+		}
+		ordenarIngresos(grupos)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"desde":            desde.Format("2006-01-02"),
+		"hasta":            hasta.Format("2006-01-02"),
+		"agrupar":          nombreAgrupacion,
+		"moneda":           monedaPorDefecto,
+		"total":            totales[0],
+		"periodo_anterior": comparacion(totales[0], totales[1], anteriorDesde, anteriorHasta),
+		"anio_anterior":    comparacion(totales[0], totales[2], anioDesde, anioHasta),
+		"grupos":           grupos,
+	})
+}
+
+// Las dimensiones se ordenan por lo cobrado, de mayor a menor, y luego por nombre
+func ordenarIngresos(grupos []FilaIngresos) {
+	sort.SliceStable(grupos, func(i, j int) bool {
+		if grupos[i].Cobrado != grupos[j].Cobrado {
+			return grupos[i].Cobrado > grupos[j].Cobrado
+		}
+		return strings.ToLower(grupos[i].Etiqueta) < strings.ToLower(grupos[j].Etiqueta)
+	})
+}
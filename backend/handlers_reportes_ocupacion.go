@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ocupación de los empleados: minutos disponibles según el horario de trabajo
+// contra minutos de turnos por estado, en total, por día de la semana y por hora.
+// La utilización cuenta lo reservado, lo completado y los no_show (el lugar
+// quedó tomado); los cancelados se informan aparte.
+
+type MinutosOcupacion struct {
+	Disponible  int     `json:"disponible_min"`
+	Reservado   int     `json:"reservado_min"` // pendiente, pendiente_pago, confirmado
+	Completado  int     `json:"completado_min"`
+	Cancelado   int     `json:"cancelado_min"`
+	NoShow      int     `json:"no_show_min"`
+	Utilizacion float64 `json:"utilizacion"` // porcentaje
+}
+
+func (m *MinutosOcupacion) sumar(estado string, minutos int) {
+	switch estado {
+	case "disponible":
+		m.Disponible += minutos
+	case "completado":
+		m.Completado += minutos
+	case "cancelado":
+		m.Cancelado += minutos
+	case "no_show":
+		m.NoShow += minutos
+	default:
+		m.Reservado += minutos
+	}
+}
+
+func (m *MinutosOcupacion) calcularUtilizacion() {
+	m.Utilizacion = 0
+	if m.Disponible > 0 {
+		ocupado := float64(m.Reservado + m.Completado + m.NoShow)
+		m.Utilizacion = math.Round(ocupado/float64(m.Disponible)*1000) / 10
+	}
+}
+
+type OcupacionDia struct {
+	Dia      int    `json:"dia_semana"` // 1 lunes ... 7 domingo
+	Etiqueta string `json:"etiqueta"`
+	MinutosOcupacion
+}
+
+type OcupacionHora struct {
+	Hora     int    `json:"hora"`
+	Etiqueta string `json:"etiqueta"`
+	MinutosOcupacion
+}
+
+type OcupacionEmpleado struct {
+	EmpleadoID   int              `json:"empleado_id"`
+	Empleado     string           `json:"empleado"`
+	Total        MinutosOcupacion `json:"total"`
+	PorDiaSemana []OcupacionDia   `json:"por_dia_semana"`
+	PorHora      []OcupacionHora  `json:"por_hora"`
+
+	dias  [8]MinutosOcupacion
+	horas [24]MinutosOcupacion
+}
+
+// Suma un intervalo en el total, el día y las horas que atraviesa
+func (o *OcupacionEmpleado) sumar(dia int, estado string, ini, fin int) {
+	if fin <= ini {
+		return
+	}
+	o.Total.sumar(estado, fin-ini)
+	o.dias[dia].sumar(estado, fin-ini)
+	for m := ini; m < fin; {
+		hora := m / 60
+		corte := min((hora+1)*60, fin)
+		if hora < 24 {
+			o.horas[hora].sumar(estado, corte-m)
+		}
+		m = corte
+	}
+}
+
+// Pasa los acumuladores a las listas de salida (las horas sin actividad se omiten)
+func (o *OcupacionEmpleado) cerrar() {
+	o.Total.calcularUtilizacion()
+	o.PorDiaSemana = []OcupacionDia{}
+	for dia := 1; dia <= 7; dia++ {
+		m := o.dias[dia]
+		m.calcularUtilizacion()
+		o.PorDiaSemana = append(o.PorDiaSemana, OcupacionDia{Dia: dia, Etiqueta: diasSemana[dia%7], MinutosOcupacion: m})
+	}
+	o.PorHora = []OcupacionHora{}
+	for hora, m := range o.horas {
+		if m == (MinutosOcupacion{}) {
+			continue
+		}
+		m.calcularUtilizacion()
+		o.PorHora = append(o.PorHora, OcupacionHora{Hora: hora, Etiqueta: horaDelDia(hora * 60), MinutosOcupacion: m})
+	}
+}
+
+// Ocupación de un rango por empleado (empleadoID 0: todos) y el total del negocio
+func calcularOcupacion(db *sql.DB, desde, hasta time.Time, empleadoID int) ([]*OcupacionEmpleado, MinutosOcupacion, error) {
+	var total MinutosOcupacion
+
+	rows, err := db.Query(`SELECT id, nombre || ' ' || apellido FROM empleados WHERE $1 = 0 OR id = $1 ORDER BY nombre, apellido`, empleadoID)
+	if err != nil {
+		return nil, total, err
+	}
+	empleados := []*OcupacionEmpleado{}
+	indice := map[int]*OcupacionEmpleado{}
+	for rows.Next() {
+		o := &OcupacionEmpleado{}
+		if err := rows.Scan(&o.EmpleadoID, &o.Empleado); err != nil {
+			rows.Close()
+			return nil, total, err
+		}
+		empleados = append(empleados, o)
+		indice[o.EmpleadoID] = o
+	}
+	rows.Close()
+
+	// Minutos disponibles: las franjas de cada día del rango
+	for _, o := range empleados {
+		franjas, err := franjasEmpleado(db, o.EmpleadoID)
+		if err != nil {
+			return nil, total, err
+		}
+		for d := desde; !d.After(hasta); d = d.AddDate(0, 0, 1) {
+			dia := diaISO(d)
+			for _, f := range franjas[dia] {
+				o.sumar(dia, "disponible", f.Inicio, f.Fin)
+			}
+		}
+	}
+
+	// Minutos de turnos por estado
+	rows, err = db.Query(`
+		SELECT empleado_id, EXTRACT(ISODOW FROM fecha)::int, estado,
+		       (EXTRACT(EPOCH FROM hora_inicio) / 60)::int, (EXTRACT(EPOCH FROM hora_fin) / 60)::int
+		FROM turnos
+		WHERE fecha BETWEEN $1 AND $2 AND ($3 = 0 OR empleado_id = $3)`,
+		desde.Format("2006-01-02"), hasta.Format("2006-01-02"), empleadoID)
+	if err != nil {
+		return nil, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var empID, dia, ini, fin int
+		var estado string
+		if err := rows.Scan(&empID, &dia, &estado, &ini, &fin); err != nil {
+			return nil, total, err
+		}
+		if o, ok := indice[empID]; ok {
+			o.sumar(dia, estado, ini, fin)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, total, err
+	}
+
+	for _, o := range empleados {
+		o.cerrar()
+		total.Disponible += o.Total.Disponible
+		total.Reservado += o.Total.Reservado
+		total.Completado += o.Total.Completado
+		total.Cancelado += o.Total.Cancelado
+		total.NoShow += o.Total.NoShow
+	}
+	total.calcularUtilizacion()
+	return empleados, total, nil
+}
+
+// GET /reportes/ocupacion?desde=2025-09-01&hasta=2025-09-30&empleado_id=2&formato=json|csv
+func getReporteOcupacion(c *gin.Context, db *sql.DB) {
+	desde, hasta, err := rangoReporte(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	formato := c.DefaultQuery("formato", "json")
+	if formato != "json" && formato != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "formato inválido: usar json o csv"})
+		return
+	}
+
+	empleadoID := 0
+	if v := c.Query("empleado_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "empleado_id inválido"})
+			return
+		}
+		empleadoID = id
+	}
+
+	empleados, total, err := calcularOcupacion(db, desde, hasta, empleadoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if empleadoID != 0 && len(empleados) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "empleado no encontrado"})
+		return
+	}
+
+	if formato == "csv" {
+		exportOcupacionCSV(c, empleados, desde, hasta)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"desde":     desde.Format("2006-01-02"),
+		"hasta":     hasta.Format("2006-01-02"),
+		"total":     total,
+		"empleados": empleados,
+	})
+}
+
+// Una fila por empleado y dimensión (total, día de la semana, hora)
+func exportOcupacionCSV(c *gin.Context, empleados []*OcupacionEmpleado, desde, hasta time.Time) {
+	filas := [][]string{{"empleado_id", "empleado", "dimension", "clave", "etiqueta",
+		"disponible_min", "reservado_min", "completado_min", "cancelado_min", "no_show_min", "utilizacion"}}
+	fila := func(o *OcupacionEmpleado, dimension, clave, etiqueta string, m MinutosOcupacion) {
+		filas = append(filas, []string{strconv.Itoa(o.EmpleadoID), o.Empleado, dimension, clave, etiqueta,
+			strconv.Itoa(m.Disponible), strconv.Itoa(m.Reservado), strconv.Itoa(m.Completado),
+			strconv.Itoa(m.Cancelado), strconv.Itoa(m.NoShow), strconv.FormatFloat(m.Utilizacion, 'f', 1, 64)})
+	}
+	for _, o := range empleados {
+		fila(o, "total", "", "", o.Total)
+		for _, d := range o.PorDiaSemana {
+			fila(o, "dia_semana", strconv.Itoa(d.Dia), d.Etiqueta, d.MinutosOcupacion)
+		}
+		for _, h := range o.PorHora {
+			fila(o, "hora", strconv.Itoa(h.Hora), h.Etiqueta, h.MinutosOcupacion)
+		}
+	}
+
+	nombre := fmt.Sprintf("ocupacion_%s_%s.csv", desde.Format("20060102"), hasta.Format("20060102"))
+	c.Header("Content-Disposition", "attachment; filename="+nombre)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.WriteAll(filas)
+	if err := w.Error(); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,861 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"github.com/lib/pq"
+	"github.com/robfig/cron/v3"
+)
+
+// Reportes programados: suscripciones que envían un reporte por email según una
+// expresión cron (hora local del servidor). El período se calcula a partir de la hora
+// programada (por ejemplo, la semana anterior completa) y cada envío queda en envios_reportes.
+// Si el servidor estuvo apagado a la hora programada, el envío sale una sola vez al arrancar,
+// con el período que le correspondía a esa hora y no el del día en que se recupera.
+// Los envíos fallidos no se reintentan: quedan en el historial y se pueden repetir
+// con POST /reportes_programados/:id/enviar.
+
+// Tabla de un informe. Las celdas se formatean según el destino: Dinero, int, float64,
+// *float64 (nil = sin dato) o string.
+type tablaInforme struct {
+	Titulo   string
+	Columnas []string
+	Filas    [][]interface{}
+}
+
+type informe struct {
+	Reporte      string
+	Titulo       string
+	Negocio      string
+	Desde, Hasta time.Time
+	Tablas       []tablaInforme
+}
+
+// Períodos relativos al día del envío: desde y hasta, inclusive
+var periodosReporte = map[string]func(hoy time.Time) (time.Time, time.Time){
+	"ayer": func(hoy time.Time) (time.Time, time.Time) {
+		return hoy.AddDate(0, 0, -1), hoy.AddDate(0, 0, -1)
+	},
+	"semana_anterior": func(hoy time.Time) (time.Time, time.Time) {
+		lunes := hoy.AddDate(0, 0, 1-diaISO(hoy))
+		return lunes.AddDate(0, 0, -7), lunes.AddDate(0, 0, -1)
+	},
+	"mes_anterior": func(hoy time.Time) (time.Time, time.Time) {
+		primero := hoy.AddDate(0, 0, 1-hoy.Day())
+		return primero.AddDate(0, -1, 0), primero.AddDate(0, 0, -1)
+	},
+	"ultimos_7_dias": func(hoy time.Time) (time.Time, time.Time) {
+		return hoy.AddDate(0, 0, -7), hoy.AddDate(0, 0, -1)
+	},
+	"ultimos_30_dias": func(hoy time.Time) (time.Time, time.Time) {
+		return hoy.AddDate(0, 0, -30), hoy.AddDate(0, 0, -1)
+	},
+}
+
+type reporteProgramable struct {
+	titulo  string
+	generar func(db *sql.DB, p ParametrosReporte, desde, hasta time.Time) ([]tablaInforme, error)
+}
+
+var reportesProgramables = map[string]reporteProgramable{
+	"resumen": {"Resumen de ingresos y ocupación", func(db *sql.DB, p ParametrosReporte, desde, hasta time.Time) ([]tablaInforme, error) {
+		ingresos, err := tablasIngresos(db, p, desde, hasta)
+		if err != nil {
+			return nil, err
+		}
+		ocupacion, err := tablasOcupacion(db, p, desde, hasta)
+		return append(ingresos, ocupacion...), err
+	}},
+	"ingresos":      {"Ingresos", tablasIngresos},
+	"ocupacion":     {"Ocupación", tablasOcupacion},
+	"cancelaciones": {"Cancelaciones y ausencias", tablasCancelaciones},
+}
+
+// Encabezado de la primera columna según la agrupación de ingresos
+var etiquetasAgrupacion = map[string]string{
+	"empleado": "Empleado",
+	"servicio": "Servicio",
+	"metodo":   "Método",
+	"dia":      "Día",
+	"semana":   "Semana",
+	"mes":      "Mes",
+}
+
+// Totales contra el período anterior de igual duración y el detalle según agrupar (por defecto empleado)
+func tablasIngresos(db *sql.DB, p ParametrosReporte, desde, hasta time.Time) ([]tablaInforme, error) {
+	dias := diasEntre(desde, hasta)
+	var totales [2]MontosIngresos
+	for i, r := range [][2]time.Time{{desde, hasta}, {desde.AddDate(0, 0, -dias), desde.AddDate(0, 0, -1)}} {
+		filas, err := agregarIngresos(db, agrupacionesIngresos["total"], r[0], r[1], p.EmpleadoID, p.ServicioID)
+		if err != nil {
+			return nil, err
+		}
+		if len(filas) > 0 {
+			totales[i] = filas[0].MontosIngresos
+		}
+	}
+	act, ant := totales[0], totales[1]
+	resumen := tablaInforme{
+		Titulo:   "Ingresos",
+		Columnas: []string{"", "Período", "Período anterior", "Variación %"},
+		Filas: [][]interface{}{
+			{"Turnos", act.Turnos, ant.Turnos, variacion(float64(act.Turnos), float64(ant.Turnos))},
+			{"Reservado", act.Reservado, ant.Reservado, variacion(act.Reservado.Float64(), ant.Reservado.Float64())},
+			{"Cobrado", act.Cobrado, ant.Cobrado, variacion(act.Cobrado.Float64(), ant.Cobrado.Float64())},
+			{"Propinas", act.Propinas, ant.Propinas, variacion(act.Propinas.Float64(), ant.Propinas.Float64())},
+			{"Consumo de prepagos", act.ConsumoPrepagos, ant.ConsumoPrepagos,
+				variacion(act.ConsumoPrepagos.Float64(), ant.ConsumoPrepagos.Float64())},
+		},
+	}
+
+	agrupar := p.Agrupar
+	if agrupar == "" {
+		agrupar = "empleado"
+	}
+	agrupacion := agrupacionesIngresos[agrupar]
+	grupos, err := agregarIngresos(db, agrupacion, desde, hasta, p.EmpleadoID, p.ServicioID)
+	if err != nil {
+		return nil, err
+	}
+	if !agrupacion.temporal {
+		ordenarIngresos(grupos)
+	}
+	detalle := tablaInforme{
+		Titulo:   "Ingresos por " + strings.ToLower(etiquetasAgrupacion[agrupar]),
+		Columnas: []string{etiquetasAgrupacion[agrupar], "Turnos", "Reservado", "Cobrado", "Propinas", "Consumo de prepagos"},
+	}
+	for _, g := range grupos {
+		detalle.Filas = append(detalle.Filas, []interface{}{g.Etiqueta, g.Turnos, g.Reservado, g.Cobrado, g.Propinas, g.ConsumoPrepagos})
+	}
+	return []tablaInforme{resumen, detalle}, nil
+}
+
+// Ocupación por empleado en horas, con el total del negocio
+func tablasOcupacion(db *sql.DB, p ParametrosReporte, desde, hasta time.Time) ([]tablaInforme, error) {
+	empleados, total, err := calcularOcupacion(db, desde, hasta, p.EmpleadoID)
+	if err != nil {
+		return nil, err
+	}
+	horas := func(minutos int) float64 { return float64(minutos) / 60 }
+	fila := func(nombre string, m MinutosOcupacion) []interface{} {
+		return []interface{}{nombre, horas(m.Disponible), horas(m.Reservado), horas(m.Completado),
+			horas(m.NoShow), horas(m.Cancelado), m.Utilizacion}
+	}
+
+	t := tablaInforme{
+		Titulo:   "Ocupación",
+		Columnas: []string{"Empleado", "Disponible (h)", "Reservado (h)", "Completado (h)", "No show (h)", "Cancelado (h)", "Utilización %"},
+	}
+	for _, o := range empleados {
+		t.Filas = append(t.Filas, fila(o.Empleado, o.Total))
+	}
+	if p.EmpleadoID == 0 {
+		t.Filas = append(t.Filas, fila("Total", total))
+	}
+	return []tablaInforme{t}, nil
+}
+
+// Totales, servicios con más ausencias y motivos de cancelación
+func tablasCancelaciones(db *sql.DB, p ParametrosReporte, desde, hasta time.Time) ([]tablaInforme, error) {
+	horasTardia := configInt(db, "cancelacion_tardia_horas")
+	columnas := []string{"", "Turnos", "Cancelados", "Tardías", "Ajenas al cliente", "No show", "Cancelación %", "No show %", "Ingreso perdido"}
+	fila := func(etiqueta string, m MetricasCancelacion) []interface{} {
+		return []interface{}{etiqueta, m.Turnos, m.Cancelados, m.CancelacionesTardias, m.CancelacionesAjenas, m.NoShows,
+			m.TasaCancelacion, m.TasaNoShow, m.IngresoPerdido}
+	}
+
+	var tablas []tablaInforme
+	for _, dimension := range []string{"total", "servicio", "motivo"} {
+		filas, err := agregarCancelaciones(db, dimensionesCancelaciones[dimension], desde, hasta, p.EmpleadoID, p.ServicioID, horasTardia)
+		if err != nil {
+			return nil, err
+		}
+
+		switch dimension {
+		case "total":
+			t := tablaInforme{Titulo: "Cancelaciones y ausencias", Columnas: columnas}
+			total := MetricasCancelacion{}
+			if len(filas) > 0 {
+				total = filas[0].MetricasCancelacion
+			}
+			t.Filas = append(t.Filas, fila("Total", total))
+			tablas = append(tablas, t)
+		case "servicio":
+			ordenarPorTasaNoShow(filas)
+			t := tablaInforme{Titulo: "Por servicio", Columnas: append([]string{"Servicio"}, columnas[1:]...)}
+			for _, f := range filas {
+				t.Filas = append(t.Filas, fila(f.Etiqueta, f.MetricasCancelacion))
+			}
+			tablas = append(tablas, t)
+		case "motivo":
+			t := tablaInforme{Titulo: "Motivos de cancelación", Columnas: []string{"Motivo", "Cancelados", "Tardías"}}
+			for _, f := range filas {
+				motivo := motivosCancelacion[f.Clave]
+				if motivo == "" {
+					motivo = "Sin motivo"
+				}
+				t.Filas = append(t.Filas, []interface{}{motivo, f.Cancelados, f.CancelacionesTardias})
+			}
+			tablas = append(tablas, t)
+		}
+	}
+	return tablas, nil
+}
+
+// Genera el informe con el período relativo al día de ref (la hora programada o ahora)
+func generarInforme(db *sql.DB, r ReporteProgramado, ref time.Time) (informe, error) {
+	hoy, _ := time.Parse("2006-01-02", ref.Format("2006-01-02"))
+	desde, hasta := periodosReporte[r.Parametros.Periodo](hoy)
+	def := reportesProgramables[r.Reporte]
+	inf := informe{
+		Reporte: r.Reporte,
+		Titulo:  def.titulo,
+		Negocio: configString(db, "negocio_nombre"),
+		Desde:   desde,
+		Hasta:   hasta,
+	}
+	var err error
+	inf.Tablas, err = def.generar(db, r.Parametros, desde, hasta)
+	return inf, err
+}
+
+func (inf informe) periodo() string {
+	if inf.Desde.Equal(inf.Hasta) {
+		return inf.Desde.Format("02/01/2006")
+	}
+	return "Del " + inf.Desde.Format("02/01/2006") + " al " + inf.Hasta.Format("02/01/2006")
+}
+
+func (inf informe) archivo() string {
+	return fmt.Sprintf("%s_%s_%s", inf.Reporte, inf.Desde.Format("20060102"), inf.Hasta.Format("20060102"))
+}
+
+// Texto de una celda: para lectura (es-AR, importes con signo) o para CSV (números sin formato, coma decimal)
+func textoCelda(v interface{}, paraCSV bool) string {
+	decimal := func(f float64) string {
+		return strings.Replace(strconv.FormatFloat(f, 'f', 1, 64), ".", ",", 1)
+	}
+	switch x := v.(type) {
+	case Dinero:
+		if paraCSV {
+			return strings.Replace(x.String(), ".", ",", 1)
+		}
+		return x.Formato()
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		return decimal(x)
+	case *float64:
+		if x == nil {
+			if paraCSV {
+				return ""
+			}
+			return "-"
+		}
+		return decimal(*x)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+// Un CSV con todas las tablas, separadas por una línea en blanco (formato es-AR, ';')
+func informeCSV(inf informe) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = ';'
+	w.Write([]string{inf.Titulo, inf.periodo()})
+	for _, t := range inf.Tablas {
+		w.Write([]string{})
+		w.Write([]string{t.Titulo})
+		w.Write(t.Columnas)
+		for _, f := range t.Filas {
+			fila := make([]string, len(f))
+			for i, v := range f {
+				fila[i] = textoCelda(v, true)
+				if _, ok := v.(string); ok {
+					fila[i] = escaparFormula(fila[i])
+				}
+			}
+			w.Write(fila)
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func informePDF(inf informe) ([]byte, error) {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // cp1252: tildes y ñ en las fuentes estándar
+	pdf.SetTitle(inf.Titulo, true)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	titulo := inf.Titulo
+	if inf.Negocio != "" {
+		titulo = inf.Negocio + " - " + titulo
+	}
+	pdf.CellFormat(0, 8, tr(titulo), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, tr(inf.periodo()), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// Primera columna fija; el resto reparte el ancho útil (277 mm en A4 apaisado)
+	for _, t := range inf.Tablas {
+		primera, resto := 70.0, 0.0
+		if len(t.Columnas) > 1 {
+			resto = (277 - primera) / float64(len(t.Columnas)-1)
+			if resto > 35 {
+				resto = 35
+			}
+		}
+		celda := func(i int, texto, borde string) {
+			ancho, alineacion := resto, "R"
+			if i == 0 {
+				ancho, alineacion = primera, "L"
+			}
+			pdf.CellFormat(ancho, 7, tr(texto), borde, 0, alineacion, false, 0, "")
+		}
+
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(0, 8, tr(t.Titulo), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 9)
+		for i, col := range t.Columnas {
+			celda(i, col, "B")
+		}
+		pdf.Ln(7)
+		pdf.SetFont("Helvetica", "", 9)
+		for _, f := range t.Filas {
+			for i, v := range f {
+				celda(i, textoCelda(v, false), "B")
+			}
+			pdf.Ln(7)
+		}
+		if len(t.Filas) == 0 {
+			pdf.SetFont("Helvetica", "I", 9)
+			pdf.CellFormat(0, 7, "Sin datos en el período", "", 1, "L", false, 0, "")
+		}
+		pdf.Ln(5)
+	}
+
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	return buf.Bytes(), err
+}
+
+var plantillaInforme = template.Must(template.New("informe").Parse(`<!DOCTYPE html>
+<html><body style="font-family: Arial, Helvetica, sans-serif; color: #222">
+<h2 style="margin-bottom: 4px">{{if .Negocio}}{{.Negocio}} - {{end}}{{.Titulo}}</h2>
+<p style="margin-top: 0; color: #666">{{.Periodo}}</p>
+{{range .Tablas}}
+<h3>{{.Titulo}}</h3>
+<table cellpadding="6" style="border-collapse: collapse; font-size: 14px">
+<tr>{{range $i, $c := .Columnas}}<th style="border-bottom: 2px solid #999; text-align: {{if $i}}right{{else}}left{{end}}">{{$c}}</th>{{end}}</tr>
+{{range .Filas}}<tr>{{range $i, $c := .}}<td style="border-bottom: 1px solid #ddd; text-align: {{if $i}}right{{else}}left{{end}}">{{$c}}</td>{{end}}</tr>
+{{else}}<tr><td colspan="{{len .Columnas}}" style="color: #666"><i>Sin datos en el período</i></td></tr>
+{{end}}</table>
+{{end}}{{if .Adjunto}}<p>Se adjunta el reporte completo ({{.Adjunto}}).</p>{{end}}
+</body></html>`))
+
+// Cuerpo HTML: con las tablas (formato html) o solo el encabezado y el aviso del adjunto
+func informeHTML(inf informe, adjunto string) (string, error) {
+	type tabla struct {
+		Titulo   string
+		Columnas []string
+		Filas    [][]string
+	}
+	datos := struct {
+		Negocio, Titulo, Periodo, Adjunto string
+		Tablas                            []tabla
+	}{inf.Negocio, inf.Titulo, inf.periodo(), adjunto, nil}
+	if adjunto == "" {
+		for _, t := range inf.Tablas {
+			vt := tabla{Titulo: t.Titulo, Columnas: t.Columnas}
+			for _, f := range t.Filas {
+				fila := make([]string, len(f))
+				for i, v := range f {
+					fila[i] = textoCelda(v, false)
+				}
+				vt.Filas = append(vt.Filas, fila)
+			}
+			datos.Tablas = append(datos.Tablas, vt)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := plantillaInforme.Execute(&buf, datos)
+	return buf.String(), err
+}
+
+func emailInforme(r ReporteProgramado, inf informe) (Email, error) {
+	asunto := r.Nombre + " - " + inf.periodo()
+	if inf.Negocio != "" {
+		asunto = inf.Negocio + ": " + asunto
+	}
+	e := Email{Para: r.Destinatarios, Asunto: asunto}
+
+	var err error
+	switch r.Formato {
+	case "pdf":
+		var datos []byte
+		if datos, err = informePDF(inf); err != nil {
+			return e, err
+		}
+		e.Adjuntos = append(e.Adjuntos, Adjunto{Nombre: inf.archivo() + ".pdf", Tipo: "application/pdf", Contenido: datos})
+	case "csv":
+		var datos []byte
+		if datos, err = informeCSV(inf); err != nil {
+			return e, err
+		}
+		e.Adjuntos = append(e.Adjuntos, Adjunto{Nombre: inf.archivo() + ".csv", Tipo: "text/csv", Contenido: datos})
+	}
+
+	adjunto := ""
+	if len(e.Adjuntos) > 0 {
+		adjunto = e.Adjuntos[0].Nombre
+	}
+	e.HTML, err = informeHTML(inf, adjunto)
+	return e, err
+}
+
+// Genera y envía el reporte y registra el envío en el historial (también si falló)
+func enviarReporte(db *sql.DB, r ReporteProgramado, ref time.Time, origen string) (EnvioReporte, error) {
+	envio := EnvioReporte{
+		ReporteProgramadoID: &r.ID,
+		Nombre:              r.Nombre,
+		Reporte:             r.Reporte,
+		Destinatarios:       r.Destinatarios,
+		Formato:             r.Formato,
+		Origen:              origen,
+		Notificador:         "ninguno",
+	}
+	if notificador != nil {
+		envio.Notificador = notificador.Nombre()
+	}
+
+	inf, err := generarInforme(db, r, ref)
+	envio.Desde, envio.Hasta = inf.Desde.Format("2006-01-02"), inf.Hasta.Format("2006-01-02")
+	if err == nil && notificador == nil {
+		err = errSinNotificador
+	}
+	if err == nil {
+		var e Email
+		if e, err = emailInforme(r, inf); err == nil {
+			envio.Bytes, err = notificador.Enviar(e)
+		}
+	}
+	envio.Estado = "enviado"
+	if n, ok := notificador.(*notificadorArchivo); ok && err == nil {
+		// Guardado localmente: no cuenta como enviado ni corre ultimo_envio
+		envio.Estado = "no_enviado"
+		envio.Error = "NOTIFICADOR=archivo: el mensaje se guardó en " + n.dir + " y no se envió"
+	}
+	if err == errSinNotificador {
+		envio.Estado, envio.Error = "no_enviado", err.Error()
+	} else if err != nil {
+		envio.Estado, envio.Error = "error", err.Error()
+	}
+
+	errHistorial := db.QueryRow(`INSERT INTO envios_reportes (reporte_programado_id, nombre, reporte, desde, hasta, destinatarios,
+	                             formato, origen, estado, error, notificador, bytes)
+	                             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12) RETURNING id, enviado_en`,
+		r.ID, envio.Nombre, envio.Reporte, envio.Desde, envio.Hasta, pq.Array(envio.Destinatarios),
+		envio.Formato, envio.Origen, envio.Estado, envio.Error, envio.Notificador, envio.Bytes).
+		Scan(&envio.ID, &envio.EnviadoEn)
+	if errHistorial == nil && envio.Estado == "enviado" {
+		_, errHistorial = db.Exec("UPDATE reportes_programados SET ultimo_envio=$2 WHERE id=$1", r.ID, envio.EnviadoEn)
+	}
+	if errHistorial != nil {
+		log.Printf("Error registrando el envío del reporte %d: %v", r.ID, errHistorial)
+		if err == nil {
+			err = errHistorial
+		}
+	}
+	return envio, err
+}
+
+// Envía los reportes cuya hora programada ya pasó. Antes de enviar se corre
+// proximo_envio con un UPDATE condicional, así un reporte sale una sola vez
+// aunque haya más de una instancia del backend.
+func enviarReportesPendientes(db *sql.DB) error {
+	rows, err := db.Query("SELECT " + columnasReporteProgramado + " FROM reportes_programados r WHERE r.activo AND r.proximo_envio <= NOW() ORDER BY r.proximo_envio")
+	if err != nil {
+		return err
+	}
+	var pendientes []ReporteProgramado
+	for rows.Next() {
+		var r ReporteProgramado
+		if err := scanReporteProgramado(rows, &r); err != nil {
+			rows.Close()
+			return err
+		}
+		pendientes = append(pendientes, r)
+	}
+	rows.Close()
+
+	for _, r := range pendientes {
+		ahora := time.Now()
+		programado := ahora
+		if r.ProximoEnvio != nil {
+			programado = *r.ProximoEnvio
+		}
+		programa, err := cron.ParseStandard(r.Cron)
+		if err != nil {
+			log.Printf("Reporte programado %d: cron inválido %q: %v", r.ID, r.Cron, err)
+			continue
+		}
+		res, err := db.Exec("UPDATE reportes_programados SET proximo_envio=$2 WHERE id=$1 AND activo AND proximo_envio <= NOW()",
+			r.ID, programa.Next(ahora))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // lo tomó otra instancia o se modificó mientras tanto
+		}
+		if _, err := enviarReporte(db, r, programado, "programado"); err != nil {
+			log.Printf("Error enviando el reporte programado %d (%s): %v", r.ID, r.Nombre, err)
+		}
+	}
+	return nil
+}
+
+func iniciarReportesProgramados(db *sql.DB) {
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := enviarReportesPendientes(db); err != nil {
+				log.Println("Error enviando reportes programados:", err)
+			}
+		}
+	}()
+}
+
+const columnasReporteProgramado = `r.id, r.nombre, r.reporte, r.parametros, r.cron, r.destinatarios, r.formato, r.activo, r.proximo_envio, r.ultimo_envio`
+
+func scanReporteProgramado(sc scanner, r *ReporteProgramado) error {
+	var parametros []byte
+	err := sc.Scan(&r.ID, &r.Nombre, &r.Reporte, &parametros, &r.Cron, pq.Array(&r.Destinatarios),
+		&r.Formato, &r.Activo, &r.ProximoEnvio, &r.UltimoEnvio)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(parametros, &r.Parametros)
+}
+
+// Valida y normaliza la suscripción; devuelve el próximo envío (nil si está inactiva)
+// Solo expresiones de cinco campos ("0 8 * * 1"), sin descriptores como @every o @hourly,
+// y como mucho un envío por hora. El intervalo mínimo se mide entre los próximos envíos:
+// minutos y horas se repiten igual todos los días, así que alcanza con un par de días.
+func validarCron(expr string) (cron.Schedule, error) {
+	if strings.HasPrefix(expr, "@") {
+		return nil, errors.New("cron inválido: usar una expresión de cinco campos (minuto hora día mes día_semana)")
+	}
+	programa, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("cron inválido: %v", err)
+	}
+	t := programa.Next(time.Now())
+	for i := 0; i < 60 && !t.IsZero(); i++ {
+		siguiente := programa.Next(t)
+		if !siguiente.IsZero() && siguiente.Sub(t) < time.Hour {
+			return nil, errors.New("cron inválido: los reportes se envían como mucho una vez por hora")
+		}
+		t = siguiente
+	}
+	return programa, nil
+}
+
+func validarReporteProgramado(r *ReporteProgramado) (*time.Time, error) {
+	r.Nombre = strings.TrimSpace(r.Nombre)
+	if r.Nombre == "" {
+		return nil, errors.New("nombre es requerido")
+	}
+	if _, ok := reportesProgramables[r.Reporte]; !ok {
+		return nil, errors.New("reporte inválido: usar resumen, ingresos, ocupacion o cancelaciones")
+	}
+	if r.Formato != "pdf" && r.Formato != "csv" && r.Formato != "html" {
+		return nil, errors.New("formato inválido: usar pdf, csv o html")
+	}
+
+	p := &r.Parametros
+	if p.Periodo == "" {
+		p.Periodo = "semana_anterior"
+	}
+	if _, ok := periodosReporte[p.Periodo]; !ok {
+		return nil, errors.New("parametros.periodo inválido: usar ayer, semana_anterior, mes_anterior, ultimos_7_dias o ultimos_30_dias")
+	}
+	if _, ok := etiquetasAgrupacion[p.Agrupar]; p.Agrupar != "" && !ok {
+		return nil, errors.New("parametros.agrupar inválido: usar empleado, servicio, metodo, dia, semana o mes")
+	}
+	if p.EmpleadoID < 0 || p.ServicioID < 0 {
+		return nil, errors.New("parametros.empleado_id/servicio_id inválido")
+	}
+
+	r.Cron = strings.TrimSpace(r.Cron)
+	programa, err := validarCron(r.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.Destinatarios) == 0 {
+		return nil, errors.New("destinatarios es requerido")
+	}
+	for i, d := range r.Destinatarios {
+		dir, err := mail.ParseAddress(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("destinatario inválido: %s", d)
+		}
+		r.Destinatarios[i] = dir.Address
+	}
+
+	if !r.Activo {
+		return nil, nil
+	}
+	proximo := programa.Next(time.Now())
+	return &proximo, nil
+}
+
+// Listar reportes programados
+func getReportesProgramados(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT " + columnasReporteProgramado + " FROM reportes_programados r ORDER BY r.nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reportes := []ReporteProgramado{}
+	for rows.Next() {
+		var r ReporteProgramado
+		if err := scanReporteProgramado(rows, &r); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reportes = append(reportes, r)
+	}
+
+	c.JSON(http.StatusOK, reportes)
+}
+
+// Crear reporte programado. Resumen de la semana anterior todos los lunes a las 8:
+// {"nombre": "Resumen semanal", "reporte": "resumen", "cron": "0 8 * * 1", "destinatarios": ["duenio@barberia.com"]}
+func createReporteProgramado(c *gin.Context, db *sql.DB) {
+	r := ReporteProgramado{Activo: true, Formato: "pdf"}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proximo, err := validarReporteProgramado(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r.ProximoEnvio = proximo
+	parametros, _ := json.Marshal(r.Parametros)
+
+	err = db.QueryRow(`INSERT INTO reportes_programados (nombre, reporte, parametros, cron, destinatarios, formato, activo, proximo_envio)
+	                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		r.Nombre, r.Reporte, parametros, r.Cron, pq.Array(r.Destinatarios), r.Formato, r.Activo, r.ProximoEnvio).
+		Scan(&r.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// Actualizar reporte programado (el próximo envío se recalcula desde ahora)
+func updateReporteProgramado(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	r := ReporteProgramado{Activo: true, Formato: "pdf"}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proximo, err := validarReporteProgramado(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r.ProximoEnvio = proximo
+	parametros, _ := json.Marshal(r.Parametros)
+
+	err = db.QueryRow(`UPDATE reportes_programados SET nombre=$1, reporte=$2, parametros=$3, cron=$4, destinatarios=$5,
+	                   formato=$6, activo=$7, proximo_envio=$8 WHERE id=$9 RETURNING id, ultimo_envio`,
+		r.Nombre, r.Reporte, parametros, r.Cron, pq.Array(r.Destinatarios), r.Formato, r.Activo, r.ProximoEnvio, id).
+		Scan(&r.ID, &r.UltimoEnvio)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reporte programado no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// Borrar reporte programado (el historial de envíos se conserva)
+func deleteReporteProgramado(c *gin.Context, db *sql.DB) {
+	res, err := db.Exec("DELETE FROM reportes_programados WHERE id=$1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reporte programado no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "reporte programado eliminado"})
+}
+
+func obtenerReporteProgramado(c *gin.Context, db *sql.DB) (ReporteProgramado, bool) {
+	var r ReporteProgramado
+	err := scanReporteProgramado(db.QueryRow("SELECT "+columnasReporteProgramado+" FROM reportes_programados r WHERE r.id=$1", c.Param("id")), &r)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reporte programado no encontrado"})
+		return r, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return r, false
+	}
+	return r, true
+}
+
+// POST /reportes_programados/:id/enviar: envía ahora, sin cambiar la programación
+func enviarReporteProgramado(c *gin.Context, db *sql.DB) {
+	r, ok := obtenerReporteProgramado(c, db)
+	if !ok {
+		return
+	}
+
+	envio, err := enviarReporte(db, r, time.Now(), "manual")
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "envio": envio})
+		return
+	}
+
+	c.JSON(http.StatusOK, envio)
+}
+
+// GET /reportes_programados/:id/vista?formato=html|csv|pdf: el reporte tal como se enviaría hoy
+func vistaReporteProgramado(c *gin.Context, db *sql.DB) {
+	r, ok := obtenerReporteProgramado(c, db)
+	if !ok {
+		return
+	}
+	formato := c.DefaultQuery("formato", r.Formato)
+
+	inf, err := generarInforme(db, r, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var datos []byte
+	tipo := ""
+	switch formato {
+	case "html":
+		var html string
+		html, err = informeHTML(inf, "")
+		datos, tipo = []byte(html), "text/html; charset=utf-8"
+	case "csv":
+		datos, err = informeCSV(inf)
+		tipo = "text/csv; charset=utf-8"
+	case "pdf":
+		datos, err = informePDF(inf)
+		tipo = "application/pdf"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "formato inválido: usar html, csv o pdf"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if formato != "html" {
+		c.Header("Content-Disposition", "inline; filename="+inf.archivo()+"."+formato)
+	}
+	c.Data(http.StatusOK, tipo, datos)
+}
+
+// GET /envios_reportes?reporte_programado_id=&estado=enviado|error&pagina=1&por_pagina=50
+// Historial de envíos, los más recientes primero
+func getEnviosReportes(c *gin.Context, db *sql.DB) {
+	pagina, porPagina := paginacion(c)
+	conds := []string{"TRUE"}
+	var args []interface{}
+	if v := c.Query("reporte_programado_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reporte_programado_id inválido"})
+			return
+		}
+		args = append(args, id)
+		conds = append(conds, fmt.Sprintf("reporte_programado_id = $%d", len(args)))
+	}
+	if v := c.Query("estado"); v != "" {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf("estado = $%d", len(args)))
+	}
+	where := strings.Join(conds, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM envios_reportes WHERE "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	args = append(args, porPagina, (pagina-1)*porPagina)
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, reporte_programado_id, nombre, reporte, TO_CHAR(desde, 'YYYY-MM-DD'), TO_CHAR(hasta, 'YYYY-MM-DD'),
+		       destinatarios, formato, origen, estado, COALESCE(error, ''), notificador, bytes, enviado_en
+		FROM envios_reportes
+		WHERE %s
+		ORDER BY enviado_en DESC, id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	envios := []EnvioReporte{}
+	for rows.Next() {
+		var e EnvioReporte
+		err := rows.Scan(&e.ID, &e.ReporteProgramadoID, &e.Nombre, &e.Reporte, &e.Desde, &e.Hasta,
+			pq.Array(&e.Destinatarios), &e.Formato, &e.Origen, &e.Estado, &e.Error, &e.Notificador, &e.Bytes, &e.EnviadoEn)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		envios = append(envios, e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"envios":     envios,
+		"total":      total,
+		"pagina":     pagina,
+		"por_pagina": porPagina,
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestValidarCron(t *testing.T) {
+	casos := []struct {
+		expr string
+		ok   bool
+	}{
+		{"0 8 * * 1", true},
+		{"0 * * * *", true},
+		{"30 7,19 * * *", true},
+		{"0 9 1 * *", true},
+		{"0 0-23/2 * * *", true},
+		{"@every 1m", false},
+		{"@hourly", false},
+		{"@weekly", false},
+		{"* * * * *", false},
+		{"*/15 * * * *", false},
+		{"0,30 8 * * *", false},
+		{"0,59 8 1 * *", false},
+		{"0 8 * *", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		_, err := validarCron(c.expr)
+		if (err == nil) != c.ok {
+			t.Errorf("validarCron(%q): error = %v, se esperaba ok = %v", c.expr, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retención de clientes: cohortes por mes del primer turno completado, intervalo
+// habitual entre visitas y clientes atrasados respecto de su propio intervalo.
+
+const factorAtrasoPorDefecto = 1.5
+
+// Hábito de cada cliente según sus visitas completadas (un día cuenta una vez):
+// cantidad de visitas, intervalo promedio en días y última visita.
+// Solo clientes con al menos dos visitas (si no, no hay intervalo).
+const sqlHabitosClientes = `
+	SELECT cliente_id, COUNT(*) AS visitas, AVG(dias)::float8 AS promedio_dias, MAX(fecha) AS ultima
+	FROM (
+		SELECT cliente_id, fecha, fecha - LAG(fecha) OVER (PARTITION BY cliente_id ORDER BY fecha) AS dias
+		FROM (SELECT DISTINCT cliente_id, fecha FROM turnos WHERE estado = 'completado') v
+	) i
+	GROUP BY cliente_id
+	HAVING COUNT(dias) > 0`
+
+// Condición de cliente atrasado sobre el alias c (usada también por los segmentos):
+// pasaron más de factor veces su intervalo habitual y no tiene un turno reservado a futuro.
+func condicionAtrasado(factor string) string {
+	return `c.id IN (SELECT h.cliente_id FROM (` + sqlHabitosClientes + `) h
+	                 WHERE CURRENT_DATE - h.ultima > ` + factor + `::float8 * h.promedio_dias)
+	AND NOT EXISTS (SELECT 1 FROM turnos tf WHERE tf.cliente_id = c.id AND tf.fecha >= CURRENT_DATE
+	                AND tf.estado IN ('pendiente', 'pendiente_pago', 'confirmado'))`
+}
+
+type RetencionMes struct {
+	Mes        int      `json:"mes"` // meses después del primero
+	Clientes   int      `json:"clientes"`
+	Porcentaje *float64 `json:"porcentaje"`
+}
+
+type Cohorte struct {
+	Cohorte   string         `json:"cohorte"` // YYYY-MM del primer turno completado
+	Clientes  int            `json:"clientes"`
+	Retencion []RetencionMes `json:"retencion"`
+}
+
+type IntervaloServicio struct {
+	ServicioID   int      `json:"servicio_id"`
+	Servicio     string   `json:"servicio"`
+	Clientes     int      `json:"clientes"`   // clientes que lo repitieron
+	Intervalos   int      `json:"intervalos"` // repeticiones medidas
+	PromedioDias *float64 `json:"promedio_dias"`
+	MedianaDias  *float64 `json:"mediana_dias"`
+}
+
+// GET /reportes/retencion?desde=2025-01&hasta=2025-12&meses=12
+// desde/hasta: meses de las cohortes (por defecto los últimos 12); meses: seguimiento máximo
+func getReporteRetencion(c *gin.Context, db *sql.DB) {
+	ahora := time.Now()
+	mesActual := time.Date(ahora.Year(), ahora.Month(), 1, 0, 0, 0, 0, time.UTC)
+	desde, err1 := time.Parse("2006-01", c.DefaultQuery("desde", mesActual.AddDate(0, -11, 0).Format("2006-01")))
+	hasta, err2 := time.Parse("2006-01", c.DefaultQuery("hasta", mesActual.Format("2006-01")))
+	if err1 != nil || err2 != nil || hasta.Before(desde) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "desde/hasta inválidos: usar YYYY-MM"})
+		return
+	}
+	meses, err := strconv.Atoi(c.DefaultQuery("meses", "12"))
+	if err != nil || meses < 1 || meses > 36 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "meses inválido: entre 1 y 36"})
+		return
+	}
+
+	// Clientes activos por cohorte y mes relativo (el mes 0 es el tamaño de la cohorte)
+	rows, err := db.Query(`
+		WITH primeras AS (
+			SELECT cliente_id, DATE_TRUNC('month', MIN(fecha))::date AS cohorte
+			FROM turnos WHERE estado = 'completado'
+			GROUP BY cliente_id
+		),
+		actividad AS (
+			SELECT DISTINCT cliente_id, DATE_TRUNC('month', fecha)::date AS mes
+			FROM turnos WHERE estado = 'completado'
+		)
+		SELECT TO_CHAR(p.cohorte, 'YYYY-MM'),
+		       ((EXTRACT(YEAR FROM a.mes) - EXTRACT(YEAR FROM p.cohorte)) * 12
+		        + EXTRACT(MONTH FROM a.mes) - EXTRACT(MONTH FROM p.cohorte))::int AS relativo,
+		       COUNT(*)
+		FROM primeras p
+		JOIN actividad a ON a.cliente_id = p.cliente_id
+		WHERE p.cohorte BETWEEN $1 AND $2 AND a.mes <= p.cohorte + make_interval(months => $3)
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		desde.Format("2006-01-02"), hasta.Format("2006-01-02"), meses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	activos := map[string]map[int]int{}
+	for rows.Next() {
+		var cohorte string
+		var relativo, n int
+		if err := rows.Scan(&cohorte, &relativo, &n); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if activos[cohorte] == nil {
+			activos[cohorte] = map[int]int{}
+		}
+		activos[cohorte][relativo] = n
+	}
+	rows.Close()
+
+	// Una fila por mes del rango; solo los meses ya transcurridos de cada cohorte
+	cohortes := []Cohorte{}
+	for m := desde; !m.After(hasta); m = m.AddDate(0, 1, 0) {
+		clave := m.Format("2006-01")
+		co := Cohorte{Cohorte: clave, Clientes: activos[clave][0], Retencion: []RetencionMes{}}
+		for k := 1; k <= meses && !m.AddDate(0, k, 0).After(mesActual); k++ {
+			n := activos[clave][k]
+			co.Retencion = append(co.Retencion, RetencionMes{Mes: k, Clientes: n, Porcentaje: porcentaje(n, co.Clientes)})
+		}
+		cohortes = append(cohortes, co)
+	}
+
+	// Intervalo entre visitas del mismo servicio
+	rows, err = db.Query(`
+		WITH intervalos AS (
+			SELECT cliente_id, servicio_id,
+			       fecha - LAG(fecha) OVER (PARTITION BY cliente_id, servicio_id ORDER BY fecha) AS dias
+			FROM (SELECT DISTINCT cliente_id, servicio_id, fecha FROM turnos WHERE estado = 'completado') v
+		)
+		SELECT s.id, s.nombre, COUNT(DISTINCT i.cliente_id), COUNT(*),
+		       ROUND(AVG(i.dias), 1)::float8,
+		       (PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY i.dias))::float8
+		FROM intervalos i
+		JOIN servicios s ON s.id = i.servicio_id
+		WHERE i.dias IS NOT NULL
+		GROUP BY s.id, s.nombre
+		ORDER BY s.nombre`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	servicios := []IntervaloServicio{}
+	for rows.Next() {
+		var is IntervaloServicio
+		if err := rows.Scan(&is.ServicioID, &is.Servicio, &is.Clientes, &is.Intervalos, &is.PromedioDias, &is.MedianaDias); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		servicios = append(servicios, is)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"desde":                  desde.Format("2006-01"),
+		"hasta":                  hasta.Format("2006-01"),
+		"cohortes":               cohortes,
+		"intervalo_por_servicio": servicios,
+	})
+}
+
+type ClienteAtrasado struct {
+	ClienteID               int     `json:"cliente_id"`
+	Nombre                  string  `json:"nombre"`
+	Telefono                string  `json:"telefono"`
+	Email                   string  `json:"email"`
+	ConsentimientoMarketing bool    `json:"consentimiento_marketing"`
+	Visitas                 int     `json:"visitas"`
+	PromedioDias            float64 `json:"promedio_dias"`
+	UltimaVisita            string  `json:"ultima_visita"`
+	DiasSinVenir            int     `json:"dias_sin_venir"`
+	Atraso                  float64 `json:"atraso"` // días sin venir / intervalo habitual
+}
+
+// GET /reportes/clientes_atrasados?factor=1.5&pagina=1&por_pagina=50
+// Clientes que superaron factor veces su intervalo habitual y no tienen turno reservado,
+// los más atrasados primero. Para campañas: segmento con la regla visita_atrasada.
+func getClientesAtrasados(c *gin.Context, db *sql.DB) {
+	factor, err := strconv.ParseFloat(c.DefaultQuery("factor", strconv.FormatFloat(factorAtrasoPorDefecto, 'f', -1, 64)), 64)
+	if err != nil || factor <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "factor inválido"})
+		return
+	}
+	pagina, porPagina := paginacion(c)
+
+	where := condicionAtrasado("$1") + " AND c.anonimizado_en IS NULL"
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM clientes c WHERE "+where, factor).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT c.id, c.nombre || ' ' || c.apellido, COALESCE(c.telefono, ''), COALESCE(c.email, ''), c.consentimiento_marketing,
+		       h.visitas, ROUND(h.promedio_dias::numeric, 1)::float8, TO_CHAR(h.ultima, 'YYYY-MM-DD'),
+		       CURRENT_DATE - h.ultima, ROUND(((CURRENT_DATE - h.ultima) / h.promedio_dias)::numeric, 2)::float8
+		FROM clientes c
+		JOIN (%s) h ON h.cliente_id = c.id
+		WHERE %s
+		ORDER BY (CURRENT_DATE - h.ultima) / h.promedio_dias DESC, c.id
+		LIMIT $2 OFFSET $3`, sqlHabitosClientes, where),
+		factor, porPagina, (pagina-1)*porPagina)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	clientes := []ClienteAtrasado{}
+	for rows.Next() {
+		var a ClienteAtrasado
+		err := rows.Scan(&a.ClienteID, &a.Nombre, &a.Telefono, &a.Email, &a.ConsentimientoMarketing,
+			&a.Visitas, &a.PromedioDias, &a.UltimaVisita, &a.DiasSinVenir, &a.Atraso)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clientes = append(clientes, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"factor":     factor,
+		"clientes":   clientes,
+		"total":      total,
+		"pagina":     pagina,
+		"por_pagina": porPagina,
+	})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Traduce las reglas de un segmento a condiciones SQL sobre la tabla clientes (alias c).
+// args trae los parámetros ya usados por la consulta, así los placeholders siguen la numeración.
+func condicionesSegmento(reglas []ReglaSegmento, args []interface{}) ([]string, []interface{}, error) {
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var conds []string
+	for _, r := range reglas {
+		switch r.Tipo {
+		case "etiqueta", "sin_etiqueta":
+			if r.Etiqueta == "" {
+				return nil, nil, fmt.Errorf("regla %s: etiqueta es requerida", r.Tipo)
+			}
+			cond := `EXISTS (SELECT 1 FROM cliente_etiquetas ce JOIN etiquetas e ON ce.etiqueta_id = e.id
+			                 WHERE ce.cliente_id = c.id AND e.nombre = ` + param(r.Etiqueta) + `)`
+			if r.Tipo == "sin_etiqueta" {
+				cond = "NOT " + cond
+			}
+			conds = append(conds, cond)
+
+		case "sin_visita_dias":
+			if r.Dias <= 0 {
+				return nil, nil, errors.New("regla sin_visita_dias: dias debe ser mayor a 0")
+			}
+			conds = append(conds, `NOT EXISTS (SELECT 1 FROM turnos t WHERE t.cliente_id = c.id
+			                       AND t.estado = 'completado' AND t.fecha >= CURRENT_DATE - `+param(r.Dias)+`::int)`)
+
+		case "min_turnos", "max_turnos":
+			if r.Cantidad < 0 {
+				return nil, nil, fmt.Errorf("regla %s: cantidad inválida", r.Tipo)
+			}
+			op := ">="
+			if r.Tipo == "max_turnos" {
+				op = "<="
+			}
+			conds = append(conds, `(SELECT COUNT(*) FROM turnos t WHERE t.cliente_id = c.id
+			                       AND t.estado != 'cancelado') `+op+` `+param(r.Cantidad))
+
+		case "uso_servicio":
+			if r.ServicioID <= 0 {
+				return nil, nil, errors.New("regla uso_servicio: servicio_id es requerido")
+			}
+			cond := `EXISTS (SELECT 1 FROM turnos t WHERE t.cliente_id = c.id
+			         AND t.estado = 'completado' AND t.servicio_id = ` + param(r.ServicioID)
+			if r.Dias > 0 {
+				cond += ` AND t.fecha >= CURRENT_DATE - ` + param(r.Dias) + `::int`
+			}
+			conds = append(conds, cond+`)`)
+
+		case "visita_atrasada":
+			factor := r.Factor
+			if factor == 0 {
+				factor = factorAtrasoPorDefecto
+			}
+			if factor < 0 {
+				return nil, nil, errors.New("regla visita_atrasada: factor inválido")
+			}
+			conds = append(conds, "("+condicionAtrasado(param(factor))+")")
+
+		default:
+			return nil, nil, fmt.Errorf("tipo de regla desconocido: %q", r.Tipo)
+		}
+	}
+
+	// Los clientes anonimizados nunca forman parte de un segmento
+	conds = append(conds, "c.anonimizado_en IS NULL")
+	return conds, args, nil
+}
+
+// Página y tamaño de página desde ?pagina=&por_pagina=
+func paginacion(c *gin.Context) (int, int) {
+	pagina, err := strconv.Atoi(c.DefaultQuery("pagina", "1"))
+	if err != nil || pagina < 1 {
+		pagina = 1
+	}
+	porPagina, err := strconv.Atoi(c.DefaultQuery("por_pagina", "50"))
+	if err != nil || porPagina < 1 {
+		porPagina = 50
+	}
+	if porPagina > 200 {
+		porPagina = 200
+	}
+	return pagina, porPagina
+}
+
+func obtenerSegmento(db ejecutor, id interface{}) (Segmento, error) {
+	var s Segmento
+	var reglas []byte
+	err := db.QueryRow("SELECT id, nombre, descripcion, reglas FROM segmentos WHERE id=$1", id).
+		Scan(&s.ID, &s.Nombre, &s.Descripcion, &reglas)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(reglas, &s.Reglas)
+	return s, err
+}
+
+// Listar todos los segmentos
+func getSegmentos(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT id, nombre, descripcion, reglas FROM segmentos ORDER BY nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	segmentos := []Segmento{}
+	for rows.Next() {
+		var s Segmento
+		var reglas []byte
+		if err := rows.Scan(&s.ID, &s.Nombre, &s.Descripcion, &reglas); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := json.Unmarshal(reglas, &s.Reglas); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		segmentos = append(segmentos, s)
+	}
+
+	c.JSON(http.StatusOK, segmentos)
+}
+
+// Obtener segmento por ID
+func getSegmento(c *gin.Context, db *sql.DB) {
+	s, err := obtenerSegmento(db, c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "segmento no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// Valida el body de un segmento y devuelve las reglas serializadas
+func bindSegmento(c *gin.Context, s *Segmento) ([]byte, error) {
+	if err := c.ShouldBindJSON(s); err != nil {
+		return nil, err
+	}
+	s.Nombre = strings.TrimSpace(s.Nombre)
+	if s.Nombre == "" {
+		return nil, errors.New("nombre es requerido")
+	}
+	if len(s.Reglas) == 0 {
+		return nil, errors.New("el segmento debe tener al menos una regla")
+	}
+	if _, _, err := condicionesSegmento(s.Reglas, nil); err != nil {
+		return nil, err
+	}
+	return json.Marshal(s.Reglas)
+}
+
+// Crear segmento
+func createSegmento(c *gin.Context, db *sql.DB) {
+	var s Segmento
+	reglas, err := bindSegmento(c, &s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = db.QueryRow(`INSERT INTO segmentos (nombre, descripcion, reglas) VALUES ($1, $2, $3) RETURNING id`,
+		s.Nombre, s.Descripcion, reglas).Scan(&s.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// Actualizar segmento
+func updateSegmento(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	var s Segmento
+	reglas, err := bindSegmento(c, &s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE segmentos SET nombre=$1, descripcion=$2, reglas=$3 WHERE id=$4`,
+		s.Nombre, s.Descripcion, reglas, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segmento no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "segmento actualizado"})
+}
+
+// Borrar segmento. Si alguna regla de precio lo usa se rechaza: hay que borrar o
+// cambiar esas reglas primero para que los precios no cambien sin aviso.
+func deleteSegmento(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	res, err := db.Exec("DELETE FROM segmentos WHERE id=$1", id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusConflict, gin.H{"error": "el segmento está usado en reglas de precio; quitarlo de esas reglas antes de borrarlo"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segmento no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "segmento eliminado"})
+}
+
+// GET /segmentos/:id/clientes?pagina=1&por_pagina=50
+func getClientesSegmento(c *gin.Context, db *sql.DB) {
+	s, err := obtenerSegmento(db, c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "segmento no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	conds, args, err := condicionesSegmento(s.Reglas, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM clientes c"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pagina, porPagina := paginacion(c)
+	args = append(args, porPagina, (pagina-1)*porPagina)
+	query := fmt.Sprintf("SELECT %s FROM clientes c%s ORDER BY c.id LIMIT $%d OFFSET $%d",
+		columnasCliente, where, len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	clientes := []Cliente{}
+	for rows.Next() {
+		var cl Cliente
+		if err := scanCliente(rows, &cl); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clientes = append(clientes, cl)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"segmento":   s,
+		"clientes":   clientes,
+		"total":      total,
+		"pagina":     pagina,
+		"por_pagina": porPagina,
+	})
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Señas: los servicios con seña (o los clientes con ausencias reiteradas) reservan en
+// estado pendiente_pago. El webhook de la pasarela confirma el turno; si no se paga
+// a tiempo, vencerSenasPendientes lo cancela y libera el horario.
+
+// Monto de seña que corresponde al turno (0 = no requiere)
+func senaRequerida(db *sql.DB, q ejecutor, t Turno) (Dinero, error) {
+	var sena Dinero
+	if err := q.QueryRow("SELECT sena FROM servicios WHERE id=$1", t.ServicioID).Scan(&sena); err != nil {
+		return 0, err
+	}
+
+	if sena == 0 {
+		conf, err := calcularConfiabilidad(db, t.ClienteID)
+		if err != nil {
+			return 0, err
+		}
+		if conf.Restricciones.RequiereSena {
+			sena = t.PrecioFinal.Porcentaje(float64(configInt(db, "sena_porcentaje")))
+		}
+	}
+
+	// Lo ya cubierto con paquete o tarjeta de regalo no se vuelve a cobrar
+	_, _, saldo, err := saldoTurno(q, t.ID)
+	if err != nil {
+		return 0, err
+	}
+	if sena > saldo {
+		sena = saldo
+	}
+	return sena, nil
+}
+
+// Registra la seña y deja el turno en pendiente_pago. El link de pago se genera
+// después del commit (generarCheckoutSena): la pasarela no se llama con la transacción
+// abierta y un cobro nunca queda apuntando a una seña que se deshizo.
+func crearSena(db *sql.DB, tx *sql.Tx, t *Turno, monto Dinero) (int, error) {
+	if pasarela == nil {
+		return 0, errSinPasarela
+	}
+	venceEn := time.Now().Add(time.Duration(configInt(db, "sena_vencimiento_minutos")) * time.Minute)
+
+	var senaID int
+	err := tx.QueryRow(`INSERT INTO senas (turno_id, monto, moneda, pasarela, vence_en) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		t.ID, monto, t.Moneda, pasarela.Nombre(), venceEn).Scan(&senaID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE turnos SET estado='pendiente_pago' WHERE id=$1`, t.ID); err != nil {
+		return 0, err
+	}
+	t.Estado = "pendiente_pago"
+	return senaID, nil
+}
+
+// Genera el link de pago de una seña ya registrada. Si la pasarela falla, la seña
+// se da por vencida y el turno se cancela para liberar el horario.
+func generarCheckoutSena(db *sql.DB, senaID int, t *Turno) error {
+	var monto Dinero
+	var moneda, servicio string
+	var venceEn time.Time
+	err := db.QueryRow(`SELECT se.monto, se.moneda, se.vence_en, s.nombre
+	                    FROM senas se JOIN turnos t ON t.id = se.turno_id JOIN servicios s ON s.id = t.servicio_id
+	                    WHERE se.id = $1`, senaID).Scan(&monto, &moneda, &venceEn, &servicio)
+	if err != nil {
+		return err
+	}
+
+	co, err := pasarela.CrearCobro(Cobro{
+		Referencia: fmt.Sprintf("sena-%d", senaID),
+		Titulo:     fmt.Sprintf("Seña %s - %s %s", servicio, t.Fecha, t.HoraInicio),
+		Monto:      monto,
+		Moneda:     moneda,
+		VenceEn:    venceEn,
+	})
+	if err != nil {
+		err = fmt.Errorf("no se pudo generar el cobro de la seña: %w", err)
+		tx, errTx := db.Begin()
+		if errTx != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if errTx := vencerSena(db, tx, senaID, "sena_sin_cobro"); errTx != nil {
+			log.Println("Error cancelando el turno de la seña", senaID, ":", errTx)
+			return err
+		}
+		if errTx := tx.Commit(); errTx != nil {
+			log.Println("Error cancelando el turno de la seña", senaID, ":", errTx)
+			return err
+		}
+		t.Estado = "cancelado"
+		return err
+	}
+
+	if _, err := db.Exec(`UPDATE senas SET checkout_id=$1, checkout_url=$2 WHERE id=$3`, co.ID, co.URL, senaID); err != nil {
+		return err
+	}
+	t.CheckoutURL = co.URL
+	return nil
+}
+
+// Vence una seña pendiente y cancela su turno con el motivo indicado, devolviendo
+// puntos, cupón, membresía y prepagos
+func vencerSena(db *sql.DB, tx *sql.Tx, senaID int, motivo string) error {
+	var turnoID int
+	err := tx.QueryRow(`UPDATE senas SET estado='vencida', resuelto_en=NOW() WHERE id=$1 AND estado='pendiente' RETURNING turno_id`,
+		senaID).Scan(&turnoID)
+	if err == sql.ErrNoRows {
+		return nil // ya resuelta
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE turnos SET estado='cancelado', cancelado_en=NOW(), motivo_cancelacion=$2 WHERE id=$1 AND estado='pendiente_pago'`, turnoID, motivo)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // el turno ya había cambiado de estado a mano
+	}
+	if err := reintegrarCanjePuntos(db, tx, turnoID); err != nil {
+		return err
+	}
+	if err := anularCanjeCupon(tx, turnoID); err != nil {
+		return err
+	}
+	if err := liberarUsoMembresia(tx, turnoID); err != nil {
+		return err
+	}
+	return reintegrarPrepagos(db, tx, turnoID, false)
+}
+
+// Da por vencida la seña pendiente de un turno que se cancela a mano. Si el pago
+// llega después, el webhook lo registra como a reintegrar.
+func anularSenaPendiente(tx *sql.Tx, turnoID int) error {
+	_, err := tx.Exec(`UPDATE senas SET estado='vencida', resuelto_en=NOW() WHERE turno_id=$1 AND estado='pendiente'`, turnoID)
+	return err
+}
+
+// Vence las señas que no se pagaron a tiempo
+func vencerSenasPendientes(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id FROM senas WHERE estado='pendiente' AND vence_en < NOW()`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := vencerSena(db, tx, id, "sena_vencida"); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Revisa las señas vencidas cada minuto
+func iniciarVencimientoSenas(db *sql.DB) {
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := vencerSenasPendientes(db); err != nil {
+				log.Println("Error venciendo señas:", err)
+			}
+		}
+	}()
+}
+
+// Aplica un evento de la pasarela. Cada evento se procesa una sola vez (webhook_eventos).
+func procesarEventoPago(db *sql.DB, ev EventoPago) (string, error) {
+	if !strings.HasPrefix(ev.Referencia, "sena-") {
+		return "evento ignorado", nil
+	}
+	senaID, err := strconv.Atoi(strings.TrimPrefix(ev.Referencia, "sena-"))
+	if err != nil {
+		return "evento ignorado", nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO webhook_eventos (pasarela, evento_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		pasarela.Nombre(), ev.EventoID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "evento ya procesado", nil
+	}
+
+	var turnoID int
+	var estado string
+	var monto Dinero
+	err = tx.QueryRow(`SELECT turno_id, estado, monto FROM senas WHERE id=$1 FOR UPDATE`, senaID).Scan(&turnoID, &estado, &monto)
+	if err == sql.ErrNoRows {
+		return "seña inexistente", tx.Commit()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var estadoTurno string
+	if err := tx.QueryRow(`SELECT estado FROM turnos WHERE id=$1 FOR UPDATE`, turnoID).Scan(&estadoTurno); err != nil {
+		return "", err
+	}
+
+	resultado := "sin cambios"
+	switch ev.Estado {
+	case "aprobado":
+		// Cobro que llegó con la seña vencida o el turno ya cancelado: el turno no se
+		// reactiva; el pago queda registrado en la seña para devolverlo
+		if estado == "vencida" || (estado == "pendiente" && estadoTurno == "cancelado") {
+			_, err = tx.Exec(`UPDATE senas SET estado='a_reintegrar', pago_externo_id=$1, resuelto_en=NOW() WHERE id=$2`, ev.PagoID, senaID)
+			if err != nil {
+				return "", err
+			}
+			log.Printf("Seña %d: pago %s aprobado con el turno %d cancelado, queda a reintegrar", senaID, ev.PagoID, turnoID)
+			resultado = "pago a reintegrar"
+			break
+		}
+		if estado != "pendiente" {
+			log.Printf("Seña %d: pago %s aprobado con la seña %s, requiere reintegro manual", senaID, ev.PagoID, estado)
+			resultado = "seña ya " + estado
+			break
+		}
+		if ev.Monto < monto {
+			log.Printf("Seña %d: pago %s por %s menor a la seña (%s)", senaID, ev.PagoID, ev.Monto.String(), monto.String())
+			resultado = "monto insuficiente"
+			break
+		}
+
+		_, err = tx.Exec(`UPDATE senas SET estado='aprobada', pago_externo_id=$1, resuelto_en=NOW() WHERE id=$2`, ev.PagoID, senaID)
+		if err != nil {
+			return "", err
+		}
+		p := Pago{TurnoID: turnoID, Tipo: "pago", Metodo: pasarela.Metodo(), Monto: monto, Referencia: ev.PagoID, Nota: "Seña"}
+		if err := registrarPago(tx, &p); err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(`UPDATE turnos SET estado='confirmado' WHERE id=$1 AND estado='pendiente_pago'`, turnoID); err != nil {
+			return "", err
+		}
+		resultado = "turno confirmado"
+
+	case "vencido":
+		if err := vencerSena(db, tx, senaID, "sena_vencida"); err != nil {
+			return "", err
+		}
+		resultado = "seña vencida"
+	}
+	// rechazado / pendiente: el cliente puede reintentar el pago hasta el vencimiento
+
+	return resultado, tx.Commit()
+}
+
+// POST /webhooks/pagos
+func webhookPagos(c *gin.Context, db *sql.DB) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ev, err := pasarela.LeerWebhook(c.Request, body)
+	if err == errFirmaInvalida {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		// 5xx: la pasarela reintenta la notificación
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	resultado, err := procesarEventoPago(db, ev)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": resultado})
+}
+
+// POST /pasarela/fake/checkout/:referencia?estado=aprobado
+// Simula el pago en la pasarela fake: arma el webhook firmado y lo envía a /webhooks/pagos.
+func pagarCheckoutFake(c *gin.Context, db *sql.DB) {
+	fake := pasarela.(*pasarelaFake) // la ruta solo se registra con la pasarela fake activa
+
+	senaID, err := strconv.Atoi(strings.TrimPrefix(c.Param("referencia"), "sena-"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "referencia inválida"})
+		return
+	}
+	var monto Dinero
+	if err := db.QueryRow("SELECT monto FROM senas WHERE id=$1", senaID).Scan(&monto); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "seña no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	estado := c.DefaultQuery("estado", "aprobado")
+	pagoID := fmt.Sprintf("fake-%d", time.Now().UnixNano())
+	body, _ := json.Marshal(EventoPago{
+		EventoID:   pagoID + ":" + estado,
+		Referencia: c.Param("referencia"),
+		PagoID:     pagoID,
+		Estado:     estado,
+		Monto:      monto,
+	})
+
+	req, err := http.NewRequest("POST", urlPublica()+"/webhooks/pagos", strings.NewReader(string(body)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Firma", fake.firmar(body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	respuesta, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json; charset=utf-8", respuesta)
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 // Estructura Servicio
@@ -15,9 +19,130 @@ import (
 //     Precio      float64 `json:"precio"`
 // }
 
-// Listar todos los servicios
+// Columnas comunes para leer un servicio (alias s) con el nombre de su categoría (alias cs)
+// El precio es el vigente hoy según el historial (todo servicio tiene al menos un precio).
+const columnasServicio = `s.id, s.nombre, s.duracion_min,
+	(SELECT sp.precio FROM servicio_precios sp WHERE sp.servicio_id = s.id AND sp.vigente_desde <= NOW()
+	 ORDER BY sp.vigente_desde DESC LIMIT 1),
+	s.moneda, s.puntos,
+	s.categoria_id, COALESCE(cs.nombre, ''), s.descripcion, s.imagen_url, s.orden, s.activo, s.reservable_online, s.sena`
+
+const fromServicios = ` FROM servicios s LEFT JOIN categorias_servicio cs ON cs.id = s.categoria_id`
+
+func scanServicio(sc scanner, s *Servicio) error {
+	return sc.Scan(&s.ID, &s.Nombre, &s.DuracionMin, &s.Precio, &s.Moneda, &s.Puntos,
+		&s.CategoriaID, &s.Categoria, &s.Descripcion, &s.ImagenURL, &s.Orden, &s.Activo, &s.ReservableOnline, &s.Sena)
+}
+
+func obtenerServicio(db *sql.DB, id interface{}) (Servicio, error) {
+	var s Servicio
+	err := scanServicio(db.QueryRow("SELECT "+columnasServicio+fromServicios+" WHERE s.id=$1", id), &s)
+	return s, err
+}
+
+// Precio de un servicio a partir de una hora del día
+type precioDesde struct {
+	Desde  string // "15:04:05"; "" = vigente desde antes del día
+	Precio Dinero
+	Moneda string
+}
+
+// Precios de un servicio que rigen durante un día (para congelarlos en un turno): el vigente
+// al empezar el día y los cambios programados dentro del día, del más nuevo al más viejo.
+// El historial es la única fuente (servicios.precio solo se conserva por compatibilidad);
+// todo servicio tiene un precio desde 1970, así que sql.ErrNoRows = servicio inexistente.
+func preciosDelDia(q ejecutor, servicioID int, fecha string) ([]precioDesde, error) {
+	var inicial precioDesde
+	err := q.QueryRow(`
+		SELECT sp.precio, sp.moneda FROM servicio_precios sp
+		WHERE sp.servicio_id = $1 AND sp.vigente_desde <= $2::date
+		ORDER BY sp.vigente_desde DESC LIMIT 1`, servicioID, fecha).Scan(&inicial.Precio, &inicial.Moneda)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT TO_CHAR(sp.vigente_desde, 'HH24:MI:SS'), sp.precio, sp.moneda FROM servicio_precios sp
+		WHERE sp.servicio_id = $1 AND sp.vigente_desde > $2::date AND sp.vigente_desde < $2::date + 1
+		ORDER BY sp.vigente_desde DESC`, servicioID, fecha)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var precios []precioDesde
+	for rows.Next() {
+		var p precioDesde
+		if err := rows.Scan(&p.Desde, &p.Precio, &p.Moneda); err != nil {
+			return nil, err
+		}
+		precios = append(precios, p)
+	}
+	return append(precios, inicial), rows.Err()
+}
+
+// Precio vigente a una hora ("15:04:05") entre los que devuelve preciosDelDia
+func precioALaHora(precios []precioDesde, hora string) precioDesde {
+	for _, p := range precios {
+		if p.Desde <= hora {
+			return p
+		}
+	}
+	return precios[len(precios)-1]
+}
+
+// Filtros de ?categoria_id=&activo=&reservable_online=&q=
+// Por defecto solo se listan los servicios activos (activo=todos para ver también los archivados).
+func filtrosServicios(c *gin.Context) ([]string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if v := c.Query("categoria_id"); v != "" {
+		conds = append(conds, "s.categoria_id = "+param(v))
+	}
+
+	switch v := c.DefaultQuery("activo", "true"); v {
+	case "true", "false":
+		conds = append(conds, "s.activo = "+param(v == "true"))
+	case "todos":
+	default:
+		return nil, nil, fmt.Errorf("activo inválido: %s", v)
+	}
+
+	if v := c.Query("reservable_online"); v != "" {
+		if v != "true" && v != "false" {
+			return nil, nil, fmt.Errorf("reservable_online inválido: %s", v)
+		}
+		conds = append(conds, "s.reservable_online = "+param(v == "true"))
+	}
+
+	if v := strings.TrimSpace(c.Query("q")); v != "" {
+		p := param("%" + v + "%")
+		conds = append(conds, "(s.nombre ILIKE "+p+" OR s.descripcion ILIKE "+p+")")
+	}
+
+	return conds, args, nil
+}
+
+// Listar servicios (con filtros), ordenados por categoría y orden de presentación
 func getServicios(c *gin.Context, db *sql.DB) {
-	rows, err := db.Query("SELECT id, nombre, duracion_min, precio FROM servicios")
+	conds, args, err := filtrosServicios(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := "SELECT " + columnasServicio + fromServicios
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY cs.orden NULLS LAST, s.orden, s.nombre"
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -27,7 +152,7 @@ func getServicios(c *gin.Context, db *sql.DB) {
 	var servicios []Servicio
 	for rows.Next() {
 		var s Servicio
-		if err := rows.Scan(&s.ID, &s.Nombre, &s.DuracionMin, &s.Precio); err != nil {
+		if err := scanServicio(rows, &s); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -37,12 +162,10 @@ func getServicios(c *gin.Context, db *sql.DB) {
 	c.JSON(http.StatusOK, servicios)
 }
 
-// Obtener servicio por ID
+// Obtener servicio por ID (también los archivados, para resolver turnos pasados)
 func getServicio(c *gin.Context, db *sql.DB) {
 	id := c.Param("id")
-	var s Servicio
-	err := db.QueryRow("SELECT id, nombre, duracion_min, precio FROM servicios WHERE id=$1", id).
-		Scan(&s.ID, &s.Nombre, &s.DuracionMin, &s.Precio)
+	s, err := obtenerServicio(db, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
@@ -56,33 +179,90 @@ func getServicio(c *gin.Context, db *sql.DB) {
 
 // Crear servicio
 func createServicio(c *gin.Context, db *sql.DB) {
-	var s Servicio
+	s := Servicio{Activo: true, ReservableOnline: true, Moneda: monedaPorDefecto}
 	if err := c.ShouldBindJSON(&s); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if s.Precio < 0 || s.Sena < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "precio inválido"})
+		return
+	}
 
-	query := `INSERT INTO servicios (nombre, duracion_min, precio) VALUES ($1, $2, $3) RETURNING id`
-	err := db.QueryRow(query, s.Nombre, s.DuracionMin, s.Precio).Scan(&s.ID)
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO servicios (nombre, duracion_min, precio, moneda, puntos, categoria_id, descripcion, imagen_url, orden, activo, reservable_online, sena)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+	err = tx.QueryRow(query, s.Nombre, s.DuracionMin, s.Precio, s.Moneda, s.Puntos, s.CategoriaID, s.Descripcion, s.ImagenURL,
+		s.Orden, s.Activo, s.ReservableOnline, s.Sena).Scan(&s.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Primer precio del historial, vigente desde siempre
+	_, err = tx.Exec(`INSERT INTO servicio_precios (servicio_id, precio, moneda, vigente_desde) VALUES ($1, $2, $3, '1970-01-01')`,
+		s.ID, s.Precio, s.Moneda)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusCreated, s)
 }
 
-// Actualizar servicio
+// Actualizar servicio (los campos omitidos conservan su valor)
 func updateServicio(c *gin.Context, db *sql.DB) {
 	id := c.Param("id")
-	var s Servicio
+	s, err := obtenerServicio(db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	precioAnterior, monedaAnterior := s.Precio, s.Moneda
 	if err := c.ShouldBindJSON(&s); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if s.Precio < 0 || s.Sena < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "precio inválido"})
+		return
+	}
 
-	query := `UPDATE servicios SET nombre=$1, duracion_min=$2, precio=$3 WHERE id=$4`
-	res, err := db.Exec(query, s.Nombre, s.DuracionMin, s.Precio, id)
+	// Un cambio de precio puede programarse a futuro; los turnos ya reservados no cambian
+	vigenteDesde := time.Now()
+	if s.PrecioVigenteDesde != nil {
+		vigenteDesde = *s.PrecioVigenteDesde
+	}
+	cambioPrecio := s.Precio != precioAnterior || s.Moneda != monedaAnterior || s.PrecioVigenteDesde != nil
+	inmediato := !vigenteDesde.After(time.Now())
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE servicios SET nombre=$1, duracion_min=$2, puntos=$3, categoria_id=$4, descripcion=$5,
+	              imagen_url=$6, orden=$7, activo=$8, reservable_online=$9, sena=$10
+	          WHERE id=$11`
+	res, err := tx.Exec(query, s.Nombre, s.DuracionMin, s.Puntos, s.CategoriaID, s.Descripcion, s.ImagenURL,
+		s.Orden, s.Activo, s.ReservableOnline, s.Sena, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -94,28 +274,195 @@ func updateServicio(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if cambioPrecio {
+		_, err = tx.Exec(`INSERT INTO servicio_precios (servicio_id, precio, moneda, vigente_desde) VALUES ($1, $2, $3, $4)`,
+			id, s.Precio, s.Moneda, vigenteDesde)
+		if err == nil && inmediato {
+			_, err = tx.Exec(`UPDATE servicios SET precio=$1, moneda=$2 WHERE id=$3`, s.Precio, s.Moneda, id)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "servicio actualizado"})
 }
 
-// Borrar servicio (solo si no hay turnos asignados)
+// GET /servicios/:id/precios
+func getPreciosServicio(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	rows, err := db.Query(`SELECT id, servicio_id, precio, moneda, vigente_desde FROM servicio_precios
+	                       WHERE servicio_id=$1 ORDER BY vigente_desde DESC, id DESC`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	precios := []PrecioServicio{}
+	for rows.Next() {
+		var p PrecioServicio
+		if err := rows.Scan(&p.ID, &p.ServicioID, &p.Precio, &p.Moneda, &p.VigenteDesde); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		precios = append(precios, p)
+	}
+
+	c.JSON(http.StatusOK, precios)
+}
+
+// POST /servicios/:id/archivar y /servicios/:id/restaurar
+func setServicioActivo(c *gin.Context, db *sql.DB, activo bool) {
+	id := c.Param("id")
+	res, err := db.Exec("UPDATE servicios SET activo=$1 WHERE id=$2", activo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
+		return
+	}
+
+	if activo {
+		c.JSON(http.StatusOK, gin.H{"status": "servicio restaurado"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"status": "servicio archivado"})
+	}
+}
+
+// Borrar servicio. Si tiene turnos se archiva en lugar de borrarlo,
+// para no romper el historial.
 func deleteServicio(c *gin.Context, db *sql.DB) {
 	id := c.Param("id")
 
+	// Verificación y borrado en una misma transacción, con el servicio bloqueado para que
+	// no se le asigne un turno, paquete o regla en el medio
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
 	// Verificar si hay turnos con este servicio
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM turnos WHERE servicio_id=$1", id).Scan(&count)
+	var conTurnos bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM turnos WHERE servicio_id = s.id)
+	                   FROM servicios s WHERE s.id=$1 FOR UPDATE`, id).Scan(&conTurnos)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no se puede eliminar: existen turnos asignados a este servicio"})
+	if conTurnos {
+		tx.Rollback()
+		setServicioActivo(c, db, false)
+		return
+	}
+
+	// Paquetes, reglas, planes y cupones que lo referencian: hay que darlos de baja o editarlos antes
+	var referencias []string
+	err = tx.QueryRow(`
+		SELECT ARRAY_REMOVE(ARRAY[
+			CASE WHEN EXISTS (SELECT 1 FROM paquetes WHERE servicio_id = $1) THEN 'paquetes' END,
+			CASE WHEN EXISTS (SELECT 1 FROM paquetes_cliente WHERE servicio_id = $1) THEN 'paquetes vendidos' END,
+			CASE WHEN EXISTS (SELECT 1 FROM reglas_comision WHERE servicio_id = $1) THEN 'reglas de comisión' END,
+			CASE WHEN EXISTS (SELECT 1 FROM reglas_precio WHERE servicio_id = $1) THEN 'reglas de precio' END,
+			CASE WHEN EXISTS (SELECT 1 FROM planes_membresia WHERE $1 = ANY(servicios)) THEN 'planes de membresía' END,
+			CASE WHEN EXISTS (SELECT 1 FROM cupones WHERE $1 = ANY(servicios)) THEN 'cupones' END
+		], NULL)`, id).Scan(pq.Array(&referencias))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(referencias) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "el servicio está referenciado en " + strings.Join(referencias, ", ") + "; archivarlo en lugar de borrarlo"})
 		return
 	}
 
 	// Borrar servicio
-	res, err := db.Exec("DELETE FROM servicios WHERE id=$1", id)
+	if _, err := tx.Exec("DELETE FROM servicios WHERE id=$1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "servicio eliminado"})
+}
+
+// Listar categorías de servicios
+func getCategoriasServicio(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT id, nombre, orden FROM categorias_servicio ORDER BY orden, nombre")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	categorias := []CategoriaServicio{}
+	for rows.Next() {
+		var cs CategoriaServicio
+		if err := rows.Scan(&cs.ID, &cs.Nombre, &cs.Orden); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		categorias = append(categorias, cs)
+	}
+
+	c.JSON(http.StatusOK, categorias)
+}
+
+// Crear categoría de servicios
+func createCategoriaServicio(c *gin.Context, db *sql.DB) {
+	var cs CategoriaServicio
+	if err := c.ShouldBindJSON(&cs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(cs.Nombre) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nombre es requerido"})
+		return
+	}
+
+	err := db.QueryRow(`INSERT INTO categorias_servicio (nombre, orden) VALUES ($1, $2) RETURNING id`, cs.Nombre, cs.Orden).Scan(&cs.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cs)
+}
+
+// Actualizar categoría de servicios
+func updateCategoriaServicio(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	var cs CategoriaServicio
+	if err := c.ShouldBindJSON(&cs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(cs.Nombre) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nombre es requerido"})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE categorias_servicio SET nombre=$1, orden=$2 WHERE id=$3`, cs.Nombre, cs.Orden, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -123,9 +470,27 @@ func deleteServicio(c *gin.Context, db *sql.DB) {
 
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "servicio no encontrado"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "categoría no encontrada"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "servicio eliminado"})
+	c.JSON(http.StatusOK, gin.H{"status": "categoría actualizada"})
+}
+
+// Borrar categoría (sus servicios quedan sin categoría)
+func deleteCategoriaServicio(c *gin.Context, db *sql.DB) {
+	id := c.Param("id")
+	res, err := db.Exec("DELETE FROM categorias_servicio WHERE id=$1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "categoría no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "categoría eliminada"})
 }
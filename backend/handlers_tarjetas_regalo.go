@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Tarjetas de regalo: un código con saldo en pesos. Cada uso en un turno queda en
+// tarjeta_movimientos y como pago (metodo "tarjeta_regalo").
+
+const columnasTarjeta = `id, codigo, monto, moneda, comprador_id, destinatario, TO_CHAR(vence_en, 'YYYY-MM-DD'), activo, creado_en,
+	(SELECT COALESCE(SUM(m.monto), 0) FROM tarjeta_movimientos m WHERE m.tarjeta_id = tarjetas_regalo.id)`
+
+func scanTarjeta(sc scanner, tr *TarjetaRegalo) error {
+	return sc.Scan(&tr.ID, &tr.Codigo, &tr.Monto, &tr.Moneda, &tr.CompradorID, &tr.Destinatario, &tr.VenceEn,
+		&tr.Activo, &tr.CreadoEn, &tr.Saldo)
+}
+
+// Código legible sin caracteres ambiguos (0/O, 1/I): "K7QM-X2PD-9RTA"
+func generarCodigoTarjeta() (string, error) {
+	const alfabeto = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	var sb strings.Builder
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alfabeto))))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(alfabeto[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+func normalizarCodigoTarjeta(codigo string) string {
+	return strings.ToUpper(strings.TrimSpace(codigo))
+}
+
+// Paga el turno (total o parcialmente) con el saldo de la tarjeta
+func consumirTarjetaRegalo(tx *sql.Tx, t *Turno) error {
+	var tr TarjetaRegalo
+	err := scanTarjeta(tx.QueryRow("SELECT "+columnasTarjeta+" FROM tarjetas_regalo WHERE codigo=$1 FOR UPDATE",
+		normalizarCodigoTarjeta(t.CodigoTarjeta)), &tr)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("tarjeta de regalo %s inválida", t.CodigoTarjeta)
+	}
+	if err != nil {
+		return err
+	}
+	if !tr.Activo {
+		return fmt.Errorf("la tarjeta de regalo %s está anulada", tr.Codigo)
+	}
+	if t.Fecha > tr.VenceEn {
+		return fmt.Errorf("la tarjeta de regalo %s vence el %s", tr.Codigo, tr.VenceEn)
+	}
+	if tr.Saldo <= 0 {
+		return fmt.Errorf("la tarjeta de regalo %s no tiene saldo", tr.Codigo)
+	}
+
+	_, _, saldoTurno, err := saldoTurno(tx, t.ID)
+	if err != nil {
+		return err
+	}
+	monto := tr.Saldo
+	if monto > saldoTurno {
+		monto = saldoTurno
+	}
+	if monto <= 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO tarjeta_movimientos (tarjeta_id, turno_id, tipo, monto) VALUES ($1, $2, 'consumo', $3)`,
+		tr.ID, t.ID, -monto)
+	if err != nil {
+		return err
+	}
+	p := Pago{TurnoID: t.ID, Tipo: "pago", Metodo: "tarjeta_regalo", Monto: monto, Referencia: tr.Codigo}
+	return registrarPago(tx, &p)
+}
+
+// Listar tarjetas de regalo
+func getTarjetasRegalo(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query("SELECT " + columnasTarjeta + " FROM tarjetas_regalo ORDER BY creado_en DESC, id DESC")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	tarjetas := []TarjetaRegalo{}
+	for rows.Next() {
+		var tr TarjetaRegalo
+		if err := scanTarjeta(rows, &tr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		tarjetas = append(tarjetas, tr)
+	}
+
+	c.JSON(http.StatusOK, tarjetas)
+}
+
+// GET /tarjetas_regalo/:codigo  (saldo y movimientos)
+func getTarjetaRegalo(c *gin.Context, db *sql.DB) {
+	var tr TarjetaRegalo
+	err := scanTarjeta(db.QueryRow("SELECT "+columnasTarjeta+" FROM tarjetas_regalo WHERE codigo=$1",
+		normalizarCodigoTarjeta(c.Param("codigo"))), &tr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tarjeta de regalo no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, turno_id, tipo, monto, creado_en FROM tarjeta_movimientos
+	                       WHERE tarjeta_id=$1 ORDER BY creado_en, id`, tr.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	tr.Movimientos = []MovimientoTarjeta{}
+	for rows.Next() {
+		var m MovimientoTarjeta
+		if err := rows.Scan(&m.ID, &m.TurnoID, &m.Tipo, &m.Monto, &m.CreadoEn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		tr.Movimientos = append(tr.Movimientos, m)
+	}
+
+	c.JSON(http.StatusOK, tr)
+}
+
+// POST /tarjetas_regalo  { "monto": 20000, "comprador_id": 3, "destinatario": "Ana" }
+func createTarjetaRegalo(c *gin.Context, db *sql.DB) {
+	tr := TarjetaRegalo{Moneda: monedaPorDefecto}
+	if err := c.ShouldBindJSON(&tr); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if tr.Monto <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "monto debe ser mayor a 0"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Reintenta ante el caso (improbable) de un código repetido
+	for intento := 0; ; intento++ {
+		if tr.Codigo, err = generarCodigoTarjeta(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		err = tx.QueryRow(`
+			INSERT INTO tarjetas_regalo (codigo, monto, moneda, comprador_id, destinatario, vence_en)
+			VALUES ($1, $2, $3, $4, $5, COALESCE($6::date, CURRENT_DATE + $7::int))
+			ON CONFLICT (codigo) DO NOTHING
+			RETURNING id`,
+			tr.Codigo, tr.Monto, tr.Moneda, tr.CompradorID, tr.Destinatario, nullSiVacio(tr.VenceEn),
+			configInt(db, "tarjeta_regalo_vigencia_dias")).Scan(&tr.ID)
+		if err != sql.ErrNoRows || intento == 3 {
+			break
+		}
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "comprador_id inexistente"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := tx.Exec(`INSERT INTO tarjeta_movimientos (tarjeta_id, tipo, monto) VALUES ($1, 'emision', $2)`, tr.ID, tr.Monto); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := scanTarjeta(tx.QueryRow("SELECT "+columnasTarjeta+" FROM tarjetas_regalo WHERE id=$1", tr.ID), &tr); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tr)
+}
+
+// POST /tarjetas_regalo/:codigo/anular
+func anularTarjetaRegalo(c *gin.Context, db *sql.DB) {
+	res, err := db.Exec("UPDATE tarjetas_regalo SET activo=false WHERE codigo=$1", normalizarCodigoTarjeta(c.Param("codigo")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tarjeta de regalo no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "tarjeta de regalo anulada"})
+}
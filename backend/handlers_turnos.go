@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -34,6 +35,89 @@ func capitalize(s string) string {
 	return strings.ToUpper(string(s[0])) + s[1:]
 }
 
+// Estados posibles de un turno
+var estadosTurno = map[string]bool{
+	"pendiente":      true,
+	"pendiente_pago": true, // esperando el pago de la seña
+	"confirmado":     true,
+	"cancelado":      true,
+	"completado":     true,
+	"no_show":        true,
+}
+
+// Cambios de estado permitidos al editar un turno (además de dejarlo igual).
+// pendiente_pago solo lo asigna la seña; completado y no_show son finales salvo cancelar
+// y un turno cancelado no se reactiva: se reserva uno nuevo.
+var transicionesTurno = map[string][]string{
+	"pendiente":      {"confirmado", "completado", "no_show", "cancelado"},
+	"pendiente_pago": {"confirmado", "cancelado"},
+	"confirmado":     {"pendiente", "completado", "no_show", "cancelado"},
+	"completado":     {"cancelado"},
+	"no_show":        {"cancelado"},
+	"cancelado":      {}, // el canje, el cupón, la membresía y los prepagos ya se liberaron
+}
+
+func transicionValida(desde, hasta string) bool {
+	if desde == hasta {
+		return true
+	}
+	for _, e := range transicionesTurno[desde] {
+		if e == hasta {
+			return true
+		}
+	}
+	return false
+}
+
+// Motivos de cancelación (opcional al cancelar)
+var motivosCancelacion = map[string]string{
+	"cliente":        "A pedido del cliente",
+	"enfermedad":     "Enfermedad",
+	"reprogramacion": "Reprogramación",
+	"clima":          "Clima",
+	"negocio":        "Cancelado por el local",
+	"sena_vencida":   "Seña no pagada",
+	"sena_sin_cobro": "No se pudo generar el cobro de la seña",
+	"otro":           "Otro",
+}
+
+// Motivos que no dependen del cliente: no cuentan como cancelación tardía
+var motivosAjenosCliente = []string{"clima", "negocio", "sena_vencida", "sena_sin_cobro"}
+
+// Condición SQL sobre la columna de motivo: la cancelación fue decisión del cliente (o sin motivo)
+func cancelacionDelCliente(columna string) string {
+	return "COALESCE(" + columna + ", '') NOT IN ('" + strings.Join(motivosAjenosCliente, "', '") + "')"
+}
+
+// Completa valores por defecto y valida estado/origen
+func normalizarTurno(t *Turno) error {
+	if t.Estado == "" {
+		t.Estado = "pendiente"
+	}
+	if !estadosTurno[t.Estado] {
+		return fmt.Errorf("estado inválido: %s", t.Estado)
+	}
+	if t.Origen == "" {
+		t.Origen = "local"
+	}
+	if t.Origen != "local" && t.Origen != "online" {
+		return fmt.Errorf("origen inválido: %s", t.Origen)
+	}
+	if t.Estado != "cancelado" {
+		t.MotivoCancelacion = ""
+	}
+	if t.MotivoCancelacion != "" && motivosCancelacion[t.MotivoCancelacion] == "" {
+		return fmt.Errorf("motivo_cancelacion inválido: %s", t.MotivoCancelacion)
+	}
+	return nil
+}
+
+// Jornada laboral (horarios disponibles y huecos libres de la agenda)
+const (
+	jornadaInicio = "09:00"
+	jornadaFin    = "20:00"
+)
+
 // Validaciones comunes
 func validarTurno(db *sql.DB, t Turno) error {
 	var tmp int
@@ -56,14 +140,21 @@ func validarTurno(db *sql.DB, t Turno) error {
 		return err
 	}
 
-	// 3. Validar servicio existe
-	err = db.QueryRow("SELECT id FROM servicios WHERE id=$1", t.ServicioID).Scan(&tmp)
+	// 3. Validar servicio existe, no está archivado y (si es online) se puede reservar online
+	var activo, reservableOnline bool
+	err = db.QueryRow("SELECT activo, reservable_online FROM servicios WHERE id=$1", t.ServicioID).Scan(&activo, &reservableOnline)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return errors.New("servicio no encontrado")
 		}
 		return err
 	}
+	if !activo {
+		return errors.New("el servicio está archivado")
+	}
+	if t.Origen == "online" && !reservableOnline {
+		return errors.New("el servicio no se puede reservar online")
+	}
 
 	// 4. Validar rango de horas (parsear HH:MM)
 	hi, err := time.Parse("15:04", t.HoraInicio)
@@ -79,11 +170,12 @@ func validarTurno(db *sql.DB, t Turno) error {
 	}
 
 	// 5. Validar que el empleado no tenga solapamiento en la misma fecha
+	// (al editar, t.ID excluye al propio turno; los cancelados no ocupan el horario)
 	count := 0
 	query := `SELECT COUNT(*) FROM turnos 
-              WHERE empleado_id=$1 AND fecha=$2
-              AND hora_inicio < $4 AND hora_fin > $3`
-	err = db.QueryRow(query, t.EmpleadoID, t.Fecha, t.HoraInicio, t.HoraFin).Scan(&count)
+              WHERE empleado_id=$1 AND fecha=$2 AND estado != 'cancelado'
+              AND hora_inicio < $4 AND hora_fin > $3 AND id != $5`
+	err = db.QueryRow(query, t.EmpleadoID, t.Fecha, t.HoraInicio, t.HoraFin, t.ID).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -91,6 +183,38 @@ func validarTurno(db *sql.DB, t Turno) error {
 		return errors.New("el empleado ya tiene un turno en ese horario")
 	}
 
+	// 6. Restricciones por ausencias del cliente (seña, un turno activo, bloqueo online)
+	if err := validarRestriccionesCliente(db, t); err != nil {
+		return err
+	}
+
+	// 7. No se agregan turnos a un período de comisiones ya liquidado
+	liquidado, err := periodoLiquidado(db, t.EmpleadoID, t.Fecha)
+	if err != nil {
+		return err
+	}
+	if liquidado {
+		return errors.New("la fecha pertenece a un período de comisiones ya liquidado para el empleado")
+	}
+
+	// 8. Anticipación máxima para reservar online; los miembros tienen días extra (prioridad)
+	if maxDias := configInt(db, "reserva_online_anticipacion_dias"); t.Origen == "online" && maxDias > 0 {
+		m, err := membresiaVigente(db, t.ClienteID, t.Fecha)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			maxDias += m.Plan.AnticipacionExtraDias
+		}
+		var permitido bool
+		if err := db.QueryRow("SELECT $1::date <= CURRENT_DATE + $2::int", t.Fecha, maxDias).Scan(&permitido); err != nil {
+			return err
+		}
+		if !permitido {
+			return fmt.Errorf("las reservas online se toman con hasta %d días de anticipación", maxDias)
+		}
+	}
+
 	return nil
 }
 
@@ -208,6 +332,7 @@ func empleadoOcupado(db *sql.DB, empleadoID int, fecha string, inicio, fin time.
 
 // GET /horarios_disponibles?empleado_id=1&servicio_id=1&fecha=2025-09-16
 // También soporta: /horarios_disponibles?empleado_id=all&servicio_id=1&fecha=2025-09-16
+// Con &con_precio=true (y opcionalmente &cliente_id=3) devuelve el precio de cada slot por empleado
 func getHorariosDisponibles(c *gin.Context, db *sql.DB) {
 	empleadoID := c.Query("empleado_id")
 	servicioID := c.Query("servicio_id")
@@ -269,8 +394,8 @@ func getHorariosDisponibles(c *gin.Context, db *sql.DB) {
 
 	// 3. Definir rango laboral
 	layout := "15:04"
-	workStart, _ := time.Parse(layout, "09:00")
-	workEnd, _ := time.Parse(layout, "20:00")
+	workStart, _ := time.Parse(layout, jornadaInicio)
+	workEnd, _ := time.Parse(layout, jornadaFin)
 
 	// 4. Ajustar fecha
 	fechaParsed, _ := time.Parse(layoutDate, fecha)
@@ -293,8 +418,9 @@ func getHorariosDisponibles(c *gin.Context, db *sql.DB) {
 
 	// 5. Generar slots disponibles
 	type Slot struct {
-		Hora      string `json:"hora"`
-		Empleados []int  `json:"empleados"`
+		Hora      string         `json:"hora"`
+		Empleados []int          `json:"empleados"`
+		Precios   map[int]Dinero `json:"precios,omitempty"` // empleado_id -> precio cotizado
 	}
 
 	var slots []Slot
@@ -350,29 +476,30 @@ func getHorariosDisponibles(c *gin.Context, db *sql.DB) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"disponibles": slots})
-}
-
-// GET /turnos
-func getTurnos(c *gin.Context, db *sql.DB) {
-	rows, err := db.Query("SELECT id, cliente_id, empleado_id, servicio_id, fecha, hora_inicio, hora_fin, estado FROM turnos")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	var turnos []Turno
-	for rows.Next() {
-		var t Turno
-		if err := rows.Scan(&t.ID, &t.ClienteID, &t.EmpleadoID, &t.ServicioID, &t.Fecha, &t.HoraInicio, &t.HoraFin, &t.Estado); err != nil {
+	// 6. Precio de cada slot según las reglas de precio dinámico (reglas y precios se cargan una vez)
+	if c.Query("con_precio") == "true" {
+		servID, _ := strconv.Atoi(servicioID)
+		clienteID, _ := strconv.Atoi(c.Query("cliente_id"))
+		cz, err := nuevoCotizador(db, servID, clienteID, fecha)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		turnos = append(turnos, t)
+		for i := range slots {
+			inicio := strings.Split(slots[i].Hora, " - ")[0]
+			slots[i].Precios = map[int]Dinero{}
+			for _, empID := range slots[i].Empleados {
+				cot, err := cz.cotizar(empID, inicio)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				slots[i].Precios[empID] = cot.Precio
+			}
+		}
 	}
 
-	c.JSON(http.StatusOK, turnos)
+	c.JSON(http.StatusOK, gin.H{"disponibles": slots})
 }
 
 // GET /turnos/cliente/:id
@@ -466,6 +593,20 @@ func getTurnosPorCliente(c *gin.Context, db *sql.DB) {
 	c.JSON(http.StatusOK, turnos)
 }
 
+// Suma un descuento al turno y recalcula el precio final (que no puede quedar negativo)
+func aplicarDescuento(tx *sql.Tx, t *Turno, monto Dinero) error {
+	if monto <= 0 {
+		return nil
+	}
+	if t.Descuento+monto > t.PrecioLista {
+		return fmt.Errorf("el descuento (%s) supera el precio del turno (%s)", (t.Descuento + monto).String(), t.PrecioLista.String())
+	}
+	t.Descuento += monto
+	t.PrecioFinal = t.PrecioLista - t.Descuento
+	_, err := tx.Exec(`UPDATE turnos SET descuento=$1, precio_final=$2 WHERE id=$3`, t.Descuento, t.PrecioFinal, t.ID)
+	return err
+}
+
 // POST /turnos
 func createTurno(c *gin.Context, db *sql.DB) {
 	var t Turno
@@ -474,27 +615,143 @@ func createTurno(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := normalizarTurno(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Completar o cancelar se hace editando el turno, donde se acreditan o devuelven
+	// puntos, cupón y prepagos; pendiente_pago lo asigna la seña
+	if t.Estado != "pendiente" && t.Estado != "confirmado" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("un turno nuevo no puede crearse %s: usar pendiente o confirmado", t.Estado)})
+		return
+	}
+
 	if err := validarTurno(db, t); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validarPrepagosTurno(t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
 
-	query := `INSERT INTO turnos (cliente_id, empleado_id, servicio_id, fecha, hora_inicio, hora_fin, estado, duracion_min)
-              VALUES ($1,$2,$3,$4,$5,$6,$7,$8) 
+	// Congelar el precio cotizado (precio vigente + reglas de precio dinámico)
+	cot, err := cotizar(tx, t.ServicioID, t.EmpleadoID, t.ClienteID, t.Fecha, t.HoraInicio)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	t.PrecioLista, t.Moneda, t.AjustesPrecio = cot.Precio, cot.Moneda, cot.Ajustes
+	t.Descuento = 0
+	t.PrecioFinal = t.PrecioLista
+	ajustes, _ := json.Marshal(t.AjustesPrecio)
+
+	query := `INSERT INTO turnos (cliente_id, empleado_id, servicio_id, fecha, hora_inicio, hora_fin, estado, duracion_min, origen,
+                                  precio_lista, descuento, precio_final, moneda, ajustes_precio)
+              VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14) 
               RETURNING id`
-	err := db.QueryRow(query, t.ClienteID, t.EmpleadoID, t.ServicioID, t.Fecha, t.HoraInicio, t.HoraFin, t.Estado, t.DuracionMin).
+	err = tx.QueryRow(query, t.ClienteID, t.EmpleadoID, t.ServicioID, t.Fecha, t.HoraInicio, t.HoraFin, t.Estado, t.DuracionMin, t.Origen,
+		t.PrecioLista, t.Descuento, t.PrecioFinal, t.Moneda, ajustes).
 		Scan(&t.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Turno incluido en la membresía: descuenta del cupo del período
+	if cot.IncluidoMembresia {
+		if err := registrarUsoMembresia(tx, cot.SuscripcionID, t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Cupón promocional (se aplica antes que los puntos)
+	if strings.TrimSpace(t.CodigoCupon) != "" {
+		descuento, err := canjearCupon(tx, &t)
+		if err == nil {
+			err = aplicarDescuento(tx, &t, descuento)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Canje de puntos como descuento
+	if t.PuntosCanje > 0 {
+		descuento, err := canjearPuntos(db, tx, t.ClienteID, t.ID, t.PuntosCanje)
+		if err == nil {
+			err = aplicarDescuento(tx, &t, descuento)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Prepagos: un crédito de paquete cubre el turno; la tarjeta de regalo, hasta su saldo
+	if t.UsarPaquete {
+		if err := consumirCreditoPaquete(tx, &t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if strings.TrimSpace(t.CodigoTarjeta) != "" {
+		if err := consumirTarjetaRegalo(tx, &t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Seña: el turno queda pendiente_pago hasta que la pasarela confirme el cobro
+	sena, err := senaRequerida(db, tx, t)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	senaID := 0
+	if sena > 0 {
+		if senaID, err = crearSena(db, tx, &t, sena); err != nil {
+			status := http.StatusInternalServerError
+			if err == errSinPasarela {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// El link de pago se pide con el turno ya guardado
+	if senaID > 0 {
+		if err := generarCheckoutSena(db, senaID, &t); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "turno_id": t.ID, "estado": t.Estado})
+			return
+		}
+	}
+
 	c.JSON(http.StatusCreated, t)
 }
 
 // PUT /turnos/:id
 func updateTurno(c *gin.Context, db *sql.DB) {
-	id := c.Param("id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
 
 	var t Turno
 	if err := c.ShouldBindJSON(&t); err != nil {
@@ -502,10 +759,78 @@ func updateTurno(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := normalizarTurno(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// cancelado_en guarda cuándo se canceló (para detectar cancelaciones tardías);
+	// el motivo se conserva si el turno ya estaba cancelado y no se informa otro
 	query := `UPDATE turnos 
-              SET cliente_id=$1, empleado_id=$2, servicio_id=$3, fecha=$4, hora_inicio=$5, hora_fin=$6, estado=$7 
+              SET cliente_id=$1, empleado_id=$2, servicio_id=$3, fecha=$4, hora_inicio=$5, hora_fin=$6, estado=$7,
+                  cancelado_en = CASE WHEN $7 != 'cancelado' THEN NULL
+                                      WHEN estado != 'cancelado' THEN NOW()
+                                      ELSE cancelado_en END,
+                  motivo_cancelacion = CASE WHEN $7 != 'cancelado' THEN NULL
+                                            ELSE COALESCE(NULLIF($9, ''), motivo_cancelacion) END
               WHERE id=$8`
-	res, err := db.Exec(query, t.ClienteID, t.EmpleadoID, t.ServicioID, t.Fecha, t.HoraInicio, t.HoraFin, t.Estado, id)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// El precio congelado solo se recalcula si cambia el servicio
+	var anterior Turno
+	var descuento Dinero
+	err = tx.QueryRow(`SELECT cliente_id, empleado_id, servicio_id, TO_CHAR(fecha, 'YYYY-MM-DD'), TO_CHAR(hora_inicio, 'HH24:MI'),
+	                          TO_CHAR(hora_fin, 'HH24:MI'), estado, descuento
+	                   FROM turnos WHERE id=$1 FOR UPDATE`, id).
+		Scan(&anterior.ClienteID, &anterior.EmpleadoID, &anterior.ServicioID, &anterior.Fecha, &anterior.HoraInicio,
+			&anterior.HoraFin, &anterior.Estado, &descuento)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "turno no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	servicioAnterior := anterior.ServicioID
+
+	if !transicionValida(anterior.Estado, t.Estado) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("un turno %s no puede pasar a %s", anterior.Estado, t.Estado)})
+		return
+	}
+
+	// Reprogramación o cambio de cliente, empleado o servicio: mismas validaciones que al
+	// reservar (existencia, horario, solapamiento sin contar al propio turno, restricciones)
+	if t.ClienteID != anterior.ClienteID || t.EmpleadoID != anterior.EmpleadoID || t.ServicioID != anterior.ServicioID ||
+		t.Fecha != anterior.Fecha || t.HoraInicio != anterior.HoraInicio || t.HoraFin != anterior.HoraFin {
+		t.ID = id
+		if err := validarTurno(db, t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Los turnos de períodos ya liquidados no se modifican (ni se mueven a uno)
+	liquidado, err := turnoLiquidado(tx, id)
+	if err == nil && !liquidado {
+		liquidado, err = periodoLiquidado(tx, t.EmpleadoID, t.Fecha)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if liquidado {
+		c.JSON(http.StatusConflict, gin.H{"error": "el turno pertenece a un período de comisiones ya liquidado"})
+		return
+	}
+
+	res, err := tx.Exec(query, t.ClienteID, t.EmpleadoID, t.ServicioID, t.Fecha, t.HoraInicio, t.HoraFin, t.Estado, id, t.MotivoCancelacion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -517,13 +842,138 @@ func updateTurno(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "turno actualizado"})
+	if t.ServicioID != servicioAnterior {
+		// El uso de la membresía se recalcula con el servicio nuevo
+		if err := liberarUsoMembresia(tx, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cot, err := cotizar(tx, t.ServicioID, t.EmpleadoID, t.ClienteID, t.Fecha, t.HoraInicio)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if cot.IncluidoMembresia {
+			t.ID = id
+			if err := registrarUsoMembresia(tx, cot.SuscripcionID, t); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if descuento > cot.Precio {
+			descuento = cot.Precio
+		}
+		ajustes, _ := json.Marshal(cot.Ajustes)
+		_, err = tx.Exec(`UPDATE turnos SET precio_lista=$1, descuento=$2, precio_final=$3, moneda=$4, ajustes_precio=$5 WHERE id=$6`,
+			cot.Precio, descuento, cot.Precio-descuento, cot.Moneda, ajustes, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Puntos: acreditar al completar; al cancelar, devolver el canje y anular lo acreditado
+	// si el turno ya estaba completado (todo idempotente).
+	// Al cancelar también se libera el uso del cupón y de la membresía, se reintegran los prepagos según la política
+	// y la seña pendiente se da por vencida.
+	switch t.Estado {
+	case "completado":
+		err = acreditarPuntosTurno(db, tx, id)
+	case "cancelado":
+		err = reintegrarCanjePuntos(db, tx, id)
+		if err == nil {
+			err = anularAcreditacionPuntos(tx, id)
+		}
+		if err == nil {
+			err = anularCanjeCupon(tx, id)
+		}
+		if err == nil {
+			err = reintegrarPrepagos(db, tx, id, true)
+		}
+		if err == nil {
+			err = liberarUsoMembresia(tx, id)
+		}
+		if err == nil {
+			err = anularSenaPendiente(tx, id)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Completar con saldo pendiente se permite, pero se avisa
+	resp := gin.H{"status": "turno actualizado"}
+	if t.Estado == "completado" {
+		_, _, saldo, err := saldoTurno(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if saldo > 0 {
+			resp["advertencia"] = fmt.Sprintf("el turno tiene saldo pendiente de %s", saldo.String())
+			resp["saldo"] = saldo
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // DELETE /turnos/:id
 func deleteTurno(c *gin.Context, db *sql.DB) {
-	id := c.Param("id")
-	res, err := db.Exec("DELETE FROM turnos WHERE id=$1", id)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id inválido"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Un turno con pagos no se borra: el libro de pagos no admite bajas
+	var tienePagos bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM pagos WHERE turno_id=$1)", id).Scan(&tienePagos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tienePagos {
+		c.JSON(http.StatusConflict, gin.H{"error": "el turno tiene pagos registrados: cancelarlo en lugar de borrarlo"})
+		return
+	}
+	liquidado, err := turnoLiquidado(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if liquidado {
+		c.JSON(http.StatusConflict, gin.H{"error": "el turno pertenece a un período de comisiones ya liquidado"})
+		return
+	}
+
+	// Devolver los puntos canjeados, anular los acreditados y liberar el cupón antes de borrar el turno
+	if err := reintegrarCanjePuntos(db, tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := anularAcreditacionPuntos(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := anularCanjeCupon(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := tx.Exec("DELETE FROM turnos WHERE id=$1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -535,5 +985,10 @@ func deleteTurno(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "turno eliminado"})
 }
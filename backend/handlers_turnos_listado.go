@@ -0,0 +1,250 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Listado de turnos con filtros, orden y paginación por cursor (keyset):
+// el cursor codifica la clave de orden de la última fila devuelta, así que pedir
+// la página siguiente no recorre las anteriores como haría un OFFSET.
+
+// Turno con los nombres resueltos
+type TurnoListado struct {
+	Turno
+	Cliente  string `json:"cliente"`
+	Empleado string `json:"empleado"`
+	Servicio string `json:"servicio"`
+	Notas    string `json:"notas"`
+}
+
+const columnasTurnoListado = `t.id, t.cliente_id, t.empleado_id, t.servicio_id, TO_CHAR(t.fecha, 'YYYY-MM-DD'),
+	TO_CHAR(t.hora_inicio, 'HH24:MI'), TO_CHAR(t.hora_fin, 'HH24:MI'), t.estado, t.duracion_min, t.origen,
+	COALESCE(t.precio_lista, 0), COALESCE(t.descuento, 0), COALESCE(t.precio_final, 0), COALESCE(t.moneda, ''),
+	COALESCE(t.motivo_cancelacion, ''), c.nombre || ' ' || c.apellido, e.nombre || ' ' || e.apellido, s.nombre, COALESCE(t.notas, '')`
+
+const fromTurnosListado = ` FROM turnos t
+	JOIN clientes c ON c.id = t.cliente_id
+	JOIN empleados e ON e.id = t.empleado_id
+	JOIN servicios s ON s.id = t.servicio_id`
+
+func scanTurnoListado(sc scanner, t *TurnoListado) error {
+	return sc.Scan(&t.ID, &t.ClienteID, &t.EmpleadoID, &t.ServicioID, &t.Fecha, &t.HoraInicio, &t.HoraFin, &t.Estado,
+		&t.DuracionMin, &t.Origen, &t.PrecioLista, &t.Descuento, &t.PrecioFinal, &t.Moneda, &t.MotivoCancelacion,
+		&t.Cliente, &t.Empleado, &t.Servicio, &t.Notas)
+}
+
+// Orden del listado: columnas de la clave (la última siempre t.id) y el tipo de cada valor del cursor
+type ordenTurnos struct {
+	columnas []string
+	tipos    []string
+	desc     bool
+}
+
+var ordenesTurnos = map[string]ordenTurnos{
+	"fecha":   {columnas: []string{"t.fecha", "t.hora_inicio", "t.id"}, tipos: []string{"date", "time", "int"}},
+	"-fecha":  {columnas: []string{"t.fecha", "t.hora_inicio", "t.id"}, tipos: []string{"date", "time", "int"}, desc: true},
+	"precio":  {columnas: []string{"COALESCE(t.precio_final, 0)", "t.id"}, tipos: []string{"numeric", "int"}},
+	"-precio": {columnas: []string{"COALESCE(t.precio_final, 0)", "t.id"}, tipos: []string{"numeric", "int"}, desc: true},
+}
+
+// Valores de la clave de orden de una fila, para armar el cursor siguiente
+func (o ordenTurnos) clave(t TurnoListado) []string {
+	if o.tipos[0] == "numeric" {
+		return []string{t.PrecioFinal.String(), strconv.Itoa(t.ID)}
+	}
+	return []string{t.Fecha, t.HoraInicio, strconv.Itoa(t.ID)}
+}
+
+func codificarCursor(valores []string) string {
+	b, _ := json.Marshal(valores)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decodifica el cursor y valida cada valor con el tipo de su columna, para que un
+// cursor alterado sea un 400 y no un error de conversión en la base
+func decodificarCursor(cursor string, tipos []string) ([]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	var valores []string
+	if err == nil {
+		err = json.Unmarshal(b, &valores)
+	}
+	if err != nil || len(valores) != len(tipos) {
+		return nil, errors.New("cursor inválido")
+	}
+	for i, v := range valores {
+		switch tipos[i] {
+		case "date":
+			_, err = time.Parse("2006-01-02", v)
+		case "time":
+			_, err = time.Parse("15:04", v)
+		case "int":
+			_, err = strconv.ParseInt(v, 10, 32) // id SERIAL
+		case "numeric":
+			_, err = parseDinero(v)
+		}
+		if err != nil {
+			return nil, errors.New("cursor inválido")
+		}
+	}
+	return valores, nil
+}
+
+// Filtros comunes de turnos desde la query:
+// desde, hasta, empleado_id, cliente_id, servicio_id, estado (repetible o separado por comas) y q (texto libre).
+// Las condiciones usan los alias de fromTurnosListado (t, c, e, s).
+func filtrosTurnos(c *gin.Context) ([]string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	for _, f := range []struct{ nombre, columna string }{{"desde", "t.fecha >= "}, {"hasta", "t.fecha <= "}} {
+		if v := c.Query(f.nombre); v != "" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return nil, nil, fmt.Errorf("%s inválido: usar YYYY-MM-DD", f.nombre)
+			}
+			conds = append(conds, f.columna+param(v)+"::date")
+		}
+	}
+
+	for _, f := range []struct{ nombre, columna string }{
+		{"empleado_id", "t.empleado_id"}, {"cliente_id", "t.cliente_id"}, {"servicio_id", "t.servicio_id"},
+	} {
+		if v := c.Query(f.nombre); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s inválido: %s", f.nombre, v)
+			}
+			conds = append(conds, f.columna+" = "+param(id))
+		}
+	}
+
+	var estados []string
+	for _, v := range c.QueryArray("estado") {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			if !estadosTurno[e] {
+				return nil, nil, fmt.Errorf("estado inválido: %s", e)
+			}
+			estados = append(estados, param(e))
+		}
+	}
+	if len(estados) > 0 {
+		conds = append(conds, "t.estado IN ("+strings.Join(estados, ", ")+")")
+	}
+
+	if v := strings.TrimSpace(c.Query("q")); v != "" {
+		p := param("%" + v + "%")
+		conds = append(conds, "(c.nombre || ' ' || c.apellido ILIKE "+p+" OR c.telefono ILIKE "+p+
+			" OR s.nombre ILIKE "+p+" OR t.notas ILIKE "+p+")")
+	}
+
+	return conds, args, nil
+}
+
+// GET /turnos?desde=&hasta=&empleado_id=&cliente_id=&servicio_id=&estado=pendiente,confirmado&q=&orden=-fecha&por_pagina=50&cursor=
+func getTurnos(c *gin.Context, db *sql.DB) {
+	conds, args, err := filtrosTurnos(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nombreOrden := c.DefaultQuery("orden", "fecha")
+	orden, ok := ordenesTurnos[nombreOrden]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "orden inválido: usar fecha, -fecha, precio o -precio"})
+		return
+	}
+	_, porPagina := paginacion(c)
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	// Totales del filtro completo (sin el cursor)
+	var total int
+	var totalPrecio Dinero
+	err = db.QueryRow("SELECT COUNT(*), COALESCE(SUM(t.precio_final), 0)"+fromTurnosListado+where, args...).Scan(&total, &totalPrecio)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keyset: (clave) > (cursor) en orden ascendente, < en descendente
+	if cursor := c.Query("cursor"); cursor != "" {
+		valores, err := decodificarCursor(cursor, orden.tipos)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ps := make([]string, len(valores))
+		for i, v := range valores {
+			args = append(args, v)
+			ps[i] = fmt.Sprintf("$%d::%s", len(args), orden.tipos[i])
+		}
+		op := ">"
+		if orden.desc {
+			op = "<"
+		}
+		conds = append(conds, "("+strings.Join(orden.columnas, ", ")+") "+op+" ("+strings.Join(ps, ", ")+")")
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	direccion := ""
+	if orden.desc {
+		direccion = " DESC"
+	}
+	args = append(args, porPagina+1) // una fila de más indica que hay otra página
+	query := "SELECT " + columnasTurnoListado + fromTurnosListado + where +
+		" ORDER BY " + strings.Join(orden.columnas, direccion+", ") + direccion +
+		fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	turnos := []TurnoListado{}
+	for rows.Next() {
+		var t TurnoListado
+		if err := scanTurnoListado(rows, &t); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		turnos = append(turnos, t)
+	}
+
+	var siguiente *string
+	if len(turnos) > porPagina {
+		turnos = turnos[:porPagina]
+		cursor := codificarCursor(orden.clave(turnos[porPagina-1]))
+		siguiente = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"turnos":       turnos,
+		"next_cursor":  siguiente,
+		"total":        total,
+		"total_precio": totalPrecio,
+		"por_pagina":   porPagina,
+		"orden":        nombreOrden,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	porFecha := ordenesTurnos["fecha"].tipos
+	porPrecio := ordenesTurnos["precio"].tipos
+
+	casos := []struct {
+		valores []string
+		tipos   []string
+	}{
+		{[]string{"2024-05-01", "10:30", "42"}, porFecha},
+		{[]string{"1500.00", "7"}, porPrecio},
+		{[]string{"-20.5", "1"}, porPrecio},
+	}
+	for _, c := range casos {
+		got, err := decodificarCursor(codificarCursor(c.valores), c.tipos)
+		if err != nil {
+			t.Errorf("decodificarCursor(codificarCursor(%q)): %v", c.valores, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.valores) {
+			t.Errorf("cursor %q decodificado como %q", c.valores, got)
+		}
+	}
+
+	invalidos := []struct {
+		cursor string
+		tipos  []string
+	}{
+		{codificarCursor([]string{"2024-05-01", "10:30", "42"}), porPrecio}, // cursor de otro orden
+		{codificarCursor([]string{"2024-13-01", "10:30", "42"}), porFecha},
+		{codificarCursor([]string{"2024-05-01", "25:00", "42"}), porFecha},
+		{codificarCursor([]string{"2024-05-01", "10:30", "x"}), porFecha},
+		{codificarCursor([]string{"mil", "7"}), porPrecio},
+		{codificarCursor([]string{"10", "99999999999"}), porPrecio},
+		{codificarCursor([]string{"", ""}), porPrecio},
+		{"no-es-base64!", porFecha},
+		{"e30", []string{"int"}}, // {} no es una lista
+		{"W10", []string{"int"}}, // lista vacía
+		{"", []string{"int"}},
+	}
+	for _, c := range invalidos {
+		if _, err := decodificarCursor(c.cursor, c.tipos); err == nil {
+			t.Errorf("decodificarCursor(%q, %q) debería fallar", c.cursor, c.tipos)
+		}
+	}
+}
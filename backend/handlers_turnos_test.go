@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestTransicionValida(t *testing.T) {
+	casos := []struct {
+		desde, hasta string
+		want         bool
+	}{
+		{"pendiente", "pendiente", true},
+		{"pendiente", "confirmado", true},
+		{"pendiente", "completado", true},
+		{"pendiente", "pendiente_pago", false},
+		{"pendiente_pago", "confirmado", true},
+		{"pendiente_pago", "completado", false},
+		{"confirmado", "no_show", true},
+		{"confirmado", "pendiente_pago", false},
+		{"completado", "cancelado", true},
+		{"completado", "pendiente", false},
+		{"completado", "no_show", false},
+		{"no_show", "completado", false},
+		{"cancelado", "cancelado", true},
+		{"cancelado", "pendiente", false},
+		{"cancelado", "confirmado", false},
+	}
+	for _, c := range casos {
+		if got := transicionValida(c.desde, c.hasta); got != c.want {
+			t.Errorf("transicionValida(%s, %s) = %v, se esperaba %v", c.desde, c.hasta, got, c.want)
+		}
+	}
+}
+
+func TestCancelacionDelCliente(t *testing.T) {
+	want := "COALESCE(b.motivo_cancelacion, '') NOT IN ('clima', 'negocio', 'sena_vencida', 'sena_sin_cobro')"
+	if got := cancelacionDelCliente("b.motivo_cancelacion"); got != want {
+		t.Errorf("cancelacionDelCliente = %q, se esperaba %q", got, want)
+	}
+	for _, m := range motivosAjenosCliente {
+		if motivosCancelacion[m] == "" {
+			t.Errorf("motivo ajeno al cliente desconocido: %s", m)
+		}
+	}
+}
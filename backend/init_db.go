@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"time"
 
 	// "gorm.io/driver/postgres"
 	// "gorm.io/gorm"
@@ -18,6 +19,55 @@ type Cliente struct {
 	Telefono string `json:"telefono"`
 	Email    string `json:"email"`
 	Dni      string `json:"dni"`
+
+	// Datos fiscales (facturación electrónica)
+	CondicionIVA string `json:"condicion_iva"` // consumidor_final, responsable_inscripto, monotributo, exento
+	CUIT         string `json:"cuit"`
+
+	// Consentimientos (Ley 25.326)
+	ConsentimientoDatos          bool       `json:"consentimiento_datos"`
+	ConsentimientoDatosFecha     *time.Time `json:"consentimiento_datos_fecha,omitempty"`
+	ConsentimientoMarketing      bool       `json:"consentimiento_marketing"`
+	ConsentimientoMarketingFecha *time.Time `json:"consentimiento_marketing_fecha,omitempty"`
+	AnonimizadoEn                *time.Time `json:"anonimizado_en,omitempty"`
+
+	CreadoEn *time.Time `json:"creado_en,omitempty"` // NULL en clientes anteriores sin turnos
+
+	Etiquetas     []string `json:"etiquetas,omitempty"`
+	Confiabilidad *int     `json:"confiabilidad,omitempty"` // puntaje 0-100
+}
+
+// Registro histórico de consentimientos otorgados/revocados
+type Consentimiento struct {
+	ID        int       `json:"id"`
+	ClienteID int       `json:"cliente_id"`
+	Tipo      string    `json:"tipo"` // datos, marketing
+	Otorgado  bool      `json:"otorgado"`
+	Fecha     time.Time `json:"fecha"`
+}
+
+// Etiqueta libre para clientes (VIP, nuevo, moroso...)
+type Etiqueta struct {
+	ID     int    `json:"id"`
+	Nombre string `json:"nombre"`
+	Color  string `json:"color"`
+}
+
+// Segmento dinámico de clientes: se cumplen todas las reglas (AND)
+type Segmento struct {
+	ID          int             `json:"id"`
+	Nombre      string          `json:"nombre"`
+	Descripcion string          `json:"descripcion"`
+	Reglas      []ReglaSegmento `json:"reglas"`
+}
+
+type ReglaSegmento struct {
+	Tipo       string  `json:"tipo"` // etiqueta, sin_etiqueta, sin_visita_dias, min_turnos, max_turnos, uso_servicio, visita_atrasada
+	Etiqueta   string  `json:"etiqueta,omitempty"`
+	Dias       int     `json:"dias,omitempty"`
+	Cantidad   int     `json:"cantidad,omitempty"`
+	ServicioID int     `json:"servicio_id,omitempty"`
+	Factor     float64 `json:"factor,omitempty"` // visita_atrasada: veces el intervalo habitual (por defecto 1.5)
 }
 
 type Empleado struct {
@@ -27,26 +77,354 @@ type Empleado struct {
 	Especialidad string `json:"especialidad"`
 }
 
+// Franja del horario semanal de un empleado
+type HorarioEmpleado struct {
+	DiaSemana  int    `json:"dia_semana"`  // 1 lunes ... 7 domingo
+	HoraInicio string `json:"hora_inicio"` // "09:00"
+	HoraFin    string `json:"hora_fin"`
+}
+
 type Servicio struct {
-	ID          int     `json:"id"`
-	Nombre      string  `json:"nombre"`
-	DuracionMin int     `json:"duracion_min"`
-	Precio      float64 `json:"precio"`
+	ID          int    `json:"id"`
+	Nombre      string `json:"nombre"`
+	DuracionMin int    `json:"duracion_min"`
+	Precio      Dinero `json:"precio"` // precio vigente hoy
+	Moneda      string `json:"moneda"`
+	Puntos      *int   `json:"puntos"` // puntos fijos al completarlo (nil = según precio)
+
+	// Al actualizar: desde cuándo rige el nuevo precio (por defecto, ahora)
+	PrecioVigenteDesde *time.Time `json:"precio_vigente_desde,omitempty"`
+
+	// Catálogo
+	CategoriaID      *int   `json:"categoria_id"`
+	Categoria        string `json:"categoria"` // nombre de la categoría (solo lectura)
+	Descripcion      string `json:"descripcion"`
+	ImagenURL        string `json:"imagen_url"`
+	Orden            int    `json:"orden"`
+	Activo           bool   `json:"activo"`            // false = archivado
+	ReservableOnline bool   `json:"reservable_online"` // se ofrece en la reserva online
+
+	Sena Dinero `json:"sena"` // seña para reservar (0 = no requiere)
+}
+
+// Historial de precios de un servicio
+type PrecioServicio struct {
+	ID           int       `json:"id"`
+	ServicioID   int       `json:"servicio_id"`
+	Precio       Dinero    `json:"precio"`
+	Moneda       string    `json:"moneda"`
+	VigenteDesde time.Time `json:"vigente_desde"`
+}
+
+// Regla de precio dinámico. Los campos en nil (o dias_semana vacío) no restringen.
+type ReglaPrecio struct {
+	ID           int     `json:"id"`
+	Nombre       string  `json:"nombre"`
+	ServicioID   *int    `json:"servicio_id"`
+	EmpleadoID   *int    `json:"empleado_id"`
+	SegmentoID   *int    `json:"segmento_id"`
+	DiasSemana   []int64 `json:"dias_semana"` // 1 = lunes ... 7 = domingo
+	HoraDesde    *string `json:"hora_desde"`  // "18:00", según la hora de inicio del turno
+	HoraHasta    *string `json:"hora_hasta"`
+	VigenteDesde *string `json:"vigente_desde"` // "2025-09-01"
+	VigenteHasta *string `json:"vigente_hasta"`
+	Tipo         string  `json:"tipo"`  // porcentaje, monto
+	Valor        Dinero  `json:"valor"` // positivo recargo, negativo descuento (15 = 15% si es porcentaje)
+	Prioridad    int     `json:"prioridad"`
+	Activo       bool    `json:"activo"`
+}
+
+type Cupon struct {
+	ID             int     `json:"id"`
+	Codigo         string  `json:"codigo"`
+	Campania       string  `json:"campania"`
+	Descripcion    string  `json:"descripcion"`
+	Tipo           string  `json:"tipo"`  // porcentaje, monto
+	Valor          Dinero  `json:"valor"` // 20 = 20% si es porcentaje
+	VigenteDesde   *string `json:"vigente_desde"`
+	VigenteHasta   *string `json:"vigente_hasta"`
+	DiasSemana     []int64 `json:"dias_semana"` // 1 = lunes ... 7 = domingo
+	Servicios      []int64 `json:"servicios"`
+	UsosMax        *int    `json:"usos_max"`
+	UsosPorCliente *int    `json:"usos_por_cliente"`
+	Acumulable     bool    `json:"acumulable"`
+	Activo         bool    `json:"activo"`
+	Usos           int     `json:"usos"`
+}
+
+type CategoriaServicio struct {
+	ID     int    `json:"id"`
+	Nombre string `json:"nombre"`
+	Orden  int    `json:"orden"`
 }
 
 // Estructura mínima para mapear JSON
 type Turno struct {
-	ID          int    `json:"id"`
-	ClienteID   int    `json:"cliente_id"`
-	EmpleadoID  int    `json:"empleado_id"`
-	ServicioID  int    `json:"servicio_id"`
-	Fecha       string `json:"fecha"`       // "2025-08-20"
-	HoraInicio  string `json:"hora_inicio"` // "15:30"
-	HoraFin     string `json:"hora_fin"`    // "16:00"
-	Estado      string `json:"estado"`
-	DuracionMin int    `json:"duracion_min"`
+	ID            int    `json:"id"`
+	ClienteID     int    `json:"cliente_id"`
+	EmpleadoID    int    `json:"empleado_id"`
+	ServicioID    int    `json:"servicio_id"`
+	Fecha         string `json:"fecha"`       // "2025-08-20"
+	HoraInicio    string `json:"hora_inicio"` // "15:30"
+	HoraFin       string `json:"hora_fin"`    // "16:00"
+	Estado        string `json:"estado"`
+	DuracionMin   int    `json:"duracion_min"`
+	Origen        string `json:"origen"` // local (personal) u online (autogestión)
+	PuntosCanje   int    `json:"puntos_canje,omitempty"`
+	CodigoCupon   string `json:"codigo_cupon,omitempty"`
+	CheckoutURL   string `json:"checkout_url,omitempty"`   // link de pago de la seña (estado pendiente_pago)
+	UsarPaquete   bool   `json:"usar_paquete,omitempty"`   // consumir un crédito de un paquete del cliente
+	CodigoTarjeta string `json:"codigo_tarjeta,omitempty"` // pagar con el saldo de una tarjeta de regalo
+
+	// Precio congelado al reservar (no cambia si después cambia el precio del servicio)
+	PrecioLista Dinero `json:"precio_lista"`
+	Descuento   Dinero `json:"descuento"`
+	PrecioFinal Dinero `json:"precio_final"`
+	Moneda      string `json:"moneda"`
+
+	AjustesPrecio []AjustePrecio `json:"ajustes_precio,omitempty"` // reglas de precio aplicadas
+
+	// Solo en estado cancelado (ver motivosCancelacion)
+	MotivoCancelacion string `json:"motivo_cancelacion,omitempty"`
 }
 
+// Factura electrónica de un turno
+type Factura struct {
+	ID                   int        `json:"id"`
+	TurnoID              int        `json:"turno_id"`
+	Estado               string     `json:"estado"` // pendiente, en_proceso, autorizada, error, rechazada
+	Letra                *string    `json:"letra"`
+	TipoComprobante      *int       `json:"tipo_comprobante"`
+	PuntoVenta           *int       `json:"punto_venta"`
+	Numero               *int       `json:"numero"`
+	Fecha                *string    `json:"fecha"`
+	DocTipo              *int       `json:"doc_tipo"`
+	DocNro               *string    `json:"doc_nro"`
+	CondicionIVAReceptor *string    `json:"condicion_iva_receptor"`
+	Neto                 *Dinero    `json:"neto"`
+	IVA                  *Dinero    `json:"iva"`
+	Total                *Dinero    `json:"total"`
+	CAE                  *string    `json:"cae"`
+	CAEVencimiento       *string    `json:"cae_vencimiento"`
+	Intentos             int        `json:"intentos"`
+	UltimoError          string     `json:"ultimo_error"`
+	ProximoIntento       time.Time  `json:"proximo_intento"`
+	CreadoEn             time.Time  `json:"creado_en"`
+	AutorizadaEn         *time.Time `json:"autorizada_en"`
+}
+
+// Paquete prepago a la venta
+type Paquete struct {
+	ID           int    `json:"id"`
+	Nombre       string `json:"nombre"`
+	ServicioID   int    `json:"servicio_id"`
+	Cantidad     int    `json:"cantidad"`
+	Precio       Dinero `json:"precio"`
+	VigenciaDias int    `json:"vigencia_dias"`
+	Activo       bool   `json:"activo"`
+}
+
+// Paquete comprado por un cliente
+type PaqueteCliente struct {
+	ID          int                 `json:"id"`
+	PaqueteID   int                 `json:"paquete_id"`
+	Nombre      string              `json:"nombre"`
+	ClienteID   int                 `json:"cliente_id"`
+	ServicioID  int                 `json:"servicio_id"`
+	Precio      Dinero              `json:"precio"`
+	VenceEn     string              `json:"vence_en"`
+	CompradoEn  time.Time           `json:"comprado_en"`
+	Saldo       int                 `json:"saldo"` // créditos disponibles
+	Vencido     bool                `json:"vencido"`
+	Movimientos []MovimientoPaquete `json:"movimientos,omitempty"`
+}
+
+type MovimientoPaquete struct {
+	ID       int       `json:"id"`
+	TurnoID  *int      `json:"turno_id,omitempty"`
+	Tipo     string    `json:"tipo"` // compra, consumo, reintegro
+	Creditos int       `json:"creditos"`
+	CreadoEn time.Time `json:"creado_en"`
+}
+
+type TarjetaRegalo struct {
+	ID           int                 `json:"id"`
+	Codigo       string              `json:"codigo"`
+	Monto        Dinero              `json:"monto"` // monto inicial
+	Moneda       string              `json:"moneda"`
+	CompradorID  *int                `json:"comprador_id"`
+	Destinatario string              `json:"destinatario"`
+	VenceEn      string              `json:"vence_en"`
+	Activo       bool                `json:"activo"`
+	CreadoEn     time.Time           `json:"creado_en"`
+	Saldo        Dinero              `json:"saldo"`
+	Movimientos  []MovimientoTarjeta `json:"movimientos,omitempty"`
+}
+
+type MovimientoTarjeta struct {
+	ID       int       `json:"id"`
+	TurnoID  *int      `json:"turno_id,omitempty"`
+	Tipo     string    `json:"tipo"` // emision, consumo, reintegro
+	Monto    Dinero    `json:"monto"`
+	CreadoEn time.Time `json:"creado_en"`
+}
+
+// Plan de membresía mensual
+type PlanMembresia struct {
+	ID                    int     `json:"id"`
+	Nombre                string  `json:"nombre"`
+	Precio                Dinero  `json:"precio"`
+	Servicios             []int64 `json:"servicios"` // servicios incluidos
+	IncluidosPorPeriodo   int     `json:"incluidos_por_periodo"`
+	DescuentoPorcentaje   float64 `json:"descuento_porcentaje"` // sobre los servicios no incluidos
+	AnticipacionExtraDias int     `json:"anticipacion_extra_dias"`
+	Activo                bool    `json:"activo"`
+}
+
+// Suscripción de un cliente a un plan
+type Suscripcion struct {
+	ID                   int                  `json:"id"`
+	PlanID               int                  `json:"plan_id"`
+	Plan                 string               `json:"plan"`
+	ClienteID            int                  `json:"cliente_id"`
+	Estado               string               `json:"estado"` // activa, vencida, cancelada
+	Inicio               string               `json:"inicio"`
+	PeriodoHasta         string               `json:"periodo_hasta"`
+	RenovacionAutomatica bool                 `json:"renovacion_automatica"`
+	CreadoEn             time.Time            `json:"creado_en"`
+	CanceladaEn          *time.Time           `json:"cancelada_en"`
+	Periodos             []PeriodoSuscripcion `json:"periodos,omitempty"`
+}
+
+type PeriodoSuscripcion struct {
+	ID       int        `json:"id"`
+	Desde    string     `json:"desde"`
+	Hasta    string     `json:"hasta"`
+	Precio   Dinero     `json:"precio"`
+	Metodo   *string    `json:"metodo"`
+	PagadoEn *time.Time `json:"pagado_en"`
+	Usados   int        `json:"usados"` // turnos cubiertos en el período
+}
+
+// Movimiento del libro de pagos de un turno
+type Pago struct {
+	ID         int       `json:"id"`
+	TurnoID    int       `json:"turno_id"`
+	ClienteID  int       `json:"cliente_id"`
+	Tipo       string    `json:"tipo"`    // pago, reintegro
+	Metodo     string    `json:"metodo"`  // efectivo, debito, transferencia, mercado_pago
+	Monto      Dinero    `json:"monto"`   // negativo en los reintegros
+	Propina    Dinero    `json:"propina"` // aparte del monto: no cuenta para el saldo
+	Moneda     string    `json:"moneda"`
+	Referencia string    `json:"referencia"`
+	Nota       string    `json:"nota"`
+	CreadoEn   time.Time `json:"creado_en"`
+}
+
+// Regla de comisión de empleados
+type ReglaComision struct {
+	ID         int             `json:"id"`
+	EmpleadoID *int            `json:"empleado_id"` // nil = todos
+	ServicioID *int            `json:"servicio_id"` // nil = todos
+	Tipo       string          `json:"tipo"`        // porcentaje, fijo, escalonado
+	Valor      Dinero          `json:"valor"`       // % o monto fijo por turno
+	Tramos     []TramoComision `json:"tramos"`      // escalonado
+	Activo     bool            `json:"activo"`
+}
+
+// Porcentaje que rige cuando las ventas del mes alcanzan Desde
+type TramoComision struct {
+	Desde      Dinero  `json:"desde"`
+	Porcentaje float64 `json:"porcentaje"`
+}
+
+// Liquidación de comisiones y propinas de un empleado
+type Liquidacion struct {
+	ID            int               `json:"id,omitempty"` // 0 = vista previa sin cerrar
+	EmpleadoID    int               `json:"empleado_id"`
+	Empleado      string            `json:"empleado"`
+	Desde         string            `json:"desde"`
+	Hasta         string            `json:"hasta"`
+	Items         []ItemLiquidacion `json:"items,omitempty"`
+	TotalVentas   Dinero            `json:"total_ventas"`
+	TotalComision Dinero            `json:"total_comision"`
+	TotalPropinas Dinero            `json:"total_propinas"`
+	Total         Dinero            `json:"total"`
+	CerradaEn     *time.Time        `json:"cerrada_en"`
+}
+
+type ItemLiquidacion struct {
+	TurnoID  int    `json:"turno_id"`
+	Fecha    string `json:"fecha"`
+	Servicio string `json:"servicio"`
+	Base     Dinero `json:"base"`
+	Regla    string `json:"regla"`
+	Comision Dinero `json:"comision"`
+	Propinas Dinero `json:"propinas"`
+}
+
+// Movimiento del programa de puntos
+type MovimientoPuntos struct {
+	ID          int        `json:"id"`
+	ClienteID   int        `json:"cliente_id"`
+	TurnoID     *int       `json:"turno_id,omitempty"`
+	Tipo        string     `json:"tipo"` // acreditacion, canje, reintegro, anulacion, ajuste, vencimiento
+	Puntos      int        `json:"puntos"`
+	VenceEn     *time.Time `json:"vence_en,omitempty"`
+	Descripcion string     `json:"descripcion"`
+	CreadoEn    time.Time  `json:"creado_en"`
+	Saldo       int        `json:"saldo"` // saldo acumulado luego del movimiento
+}
+
+// Suscripción a un reporte que se envía por email según una expresión cron
+type ReporteProgramado struct {
+	ID            int               `json:"id"`
+	Nombre        string            `json:"nombre"`
+	Reporte       string            `json:"reporte"` // resumen, ingresos, ocupacion, cancelaciones
+	Parametros    ParametrosReporte `json:"parametros"`
+	Cron          string            `json:"cron"` // "0 8 * * 1": lunes a las 8
+	Destinatarios []string          `json:"destinatarios"`
+	Formato       string            `json:"formato"` // pdf, csv, html (en el cuerpo del email)
+	Activo        bool              `json:"activo"`
+	ProximoEnvio  *time.Time        `json:"proximo_envio"`
+	UltimoEnvio   *time.Time        `json:"ultimo_envio"`
+}
+
+type ParametrosReporte struct {
+	Periodo    string `json:"periodo"`           // semana_anterior, mes_anterior, ayer, ultimos_7_dias, ultimos_30_dias
+	Agrupar    string `json:"agrupar,omitempty"` // ingresos: empleado, servicio, metodo, dia, semana, mes
+	EmpleadoID int    `json:"empleado_id,omitempty"`
+	ServicioID int    `json:"servicio_id,omitempty"`
+}
+
+// Envío de un reporte programado (el historial queda aunque se borre la suscripción)
+type EnvioReporte struct {
+	ID                  int       `json:"id"`
+	ReporteProgramadoID *int      `json:"reporte_programado_id"`
+	Nombre              string    `json:"nombre"`
+	Reporte             string    `json:"reporte"`
+	Desde               string    `json:"desde"`
+	Hasta               string    `json:"hasta"`
+	Destinatarios       []string  `json:"destinatarios"`
+	Formato             string    `json:"formato"`
+	Origen              string    `json:"origen"` // programado, manual
+	Estado              string    `json:"estado"` // enviado, no_enviado, error
+	Error               string    `json:"error,omitempty"`
+	Notificador         string    `json:"notificador"`
+	Bytes               int       `json:"bytes"` // tamaño del mensaje
+	EnviadoEn           time.Time `json:"enviado_en"`
+}
+
+// Permite usar las mismas funciones con *sql.DB o dentro de una *sql.Tx
+type ejecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Cadena de conexión a la base (la usan también las conexiones de LISTEN/NOTIFY)
+var dsnBarberia string
+
 func initDB() *sql.DB {
 	user := "admin"
 	password := "admin123"
@@ -74,6 +452,7 @@ func initDB() *sql.DB {
 	connStrDB := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
 
+	dsnBarberia = connStrDB
 	dbBarberia, err := sql.Open("postgres", connStrDB)
 	if err != nil {
 		log.Fatal("Error conectando a barberia:", err)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,6 +12,25 @@ import (
 func main() {
 	db := initDB() // inicializar conexión y schema
 
+	var err error
+	if pasarela, err = nuevaPasarela(); err != nil {
+		log.Fatal("Error configurando la pasarela de pagos: ", err)
+	}
+	iniciarVencimientoSenas(db)
+
+	facturador = nuevoFacturador()
+	iniciarReintentosFacturas(db)
+
+	iniciarRenovacionMembresias(db)
+	iniciarVencimientoPuntos(db)
+
+	iniciarInvalidacionDashboard()
+
+	if notificador, err = nuevoNotificador(); err != nil {
+		log.Fatal("Error configurando el notificador: ", err)
+	}
+	iniciarReportesProgramados(db)
+
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
@@ -24,11 +44,44 @@ func main() {
 
 	// CRUD clientes            // VERIFICADO
 	r.GET("/clientes", func(c *gin.Context) { getClientes(c, db) })
+	r.GET("/clientes/export", func(c *gin.Context) { exportClientes(c, db) })
 	r.GET("/clientes/:id", func(c *gin.Context) { getCliente(c, db) })
 	r.POST("/clientes", func(c *gin.Context) { createCliente(c, db) })
+	r.POST("/clientes/import", func(c *gin.Context) { importClientes(c, db) })
 	r.PUT("/clientes/:id", func(c *gin.Context) { updateCliente(c, db) })
 	r.DELETE("/clientes/:id", func(c *gin.Context) { deleteCliente(c, db) })
 
+	// Datos personales (Ley 25.326)
+	r.PUT("/clientes/:id/consentimiento", func(c *gin.Context) { updateConsentimiento(c, db) })
+	r.GET("/clientes/:id/export", func(c *gin.Context) { exportCliente(c, db) })
+	r.POST("/clientes/:id/anonimizar", func(c *gin.Context) { anonimizarClienteHandler(c, db) })
+
+	// Etiquetas de clientes
+	r.GET("/etiquetas", func(c *gin.Context) { getEtiquetas(c, db) })
+	r.POST("/etiquetas", func(c *gin.Context) { createEtiqueta(c, db) })
+	r.PUT("/etiquetas/:id", func(c *gin.Context) { updateEtiqueta(c, db) })
+	r.DELETE("/etiquetas/:id", func(c *gin.Context) { deleteEtiqueta(c, db) })
+	r.GET("/clientes/:id/etiquetas", func(c *gin.Context) { getEtiquetasCliente(c, db) })
+	r.POST("/clientes/:id/etiquetas", func(c *gin.Context) { addEtiquetaCliente(c, db) })
+	r.DELETE("/clientes/:id/etiquetas/:etiqueta_id", func(c *gin.Context) { removeEtiquetaCliente(c, db) })
+
+	// Confiabilidad de clientes (ausencias y restricciones)
+	r.GET("/clientes/:id/confiabilidad", func(c *gin.Context) { getConfiabilidadCliente(c, db) })
+	r.PUT("/clientes/:id/excepcion", func(c *gin.Context) { updateExcepcionCliente(c, db) })
+
+	// Programa de puntos
+	r.GET("/clientes/:id/puntos", func(c *gin.Context) { getPuntosCliente(c, db) })
+	r.GET("/clientes/:id/puntos/movimientos", func(c *gin.Context) { getMovimientosPuntos(c, db) })
+	r.POST("/clientes/:id/puntos/ajustes", func(c *gin.Context) { createAjustePuntos(c, db) })
+
+	// Segmentos de clientes
+	r.GET("/segmentos", func(c *gin.Context) { getSegmentos(c, db) })
+	r.GET("/segmentos/:id", func(c *gin.Context) { getSegmento(c, db) })
+	r.GET("/segmentos/:id/clientes", func(c *gin.Context) { getClientesSegmento(c, db) })
+	r.POST("/segmentos", func(c *gin.Context) { createSegmento(c, db) })
+	r.PUT("/segmentos/:id", func(c *gin.Context) { updateSegmento(c, db) })
+	r.DELETE("/segmentos/:id", func(c *gin.Context) { deleteSegmento(c, db) })
+
 	// CRUD de empleados        // VERIFICADO
 	r.GET("/empleados", func(c *gin.Context) { getEmpleados(c, db) })
 	r.GET("/empleados/:id", func(c *gin.Context) { getEmpleado(c, db) })
@@ -38,18 +91,125 @@ func main() {
 
 	// CRUD servicios           // VERIFICADO
 	r.GET("/servicios", func(c *gin.Context) { getServicios(c, db) })
+	r.GET("/servicios/export", func(c *gin.Context) { exportServicios(c, db) })
 	r.GET("/servicios/:id", func(c *gin.Context) { getServicio(c, db) })
 	r.POST("/servicios", func(c *gin.Context) { createServicio(c, db) })
 	r.PUT("/servicios/:id", func(c *gin.Context) { updateServicio(c, db) })
 	r.DELETE("/servicios/:id", func(c *gin.Context) { deleteServicio(c, db) })
+	r.POST("/servicios/:id/archivar", func(c *gin.Context) { setServicioActivo(c, db, false) })
+	r.POST("/servicios/:id/restaurar", func(c *gin.Context) { setServicioActivo(c, db, true) })
+	r.GET("/servicios/:id/precios", func(c *gin.Context) { getPreciosServicio(c, db) })
+
+	// Precios dinámicos
+	r.GET("/reglas_precio", func(c *gin.Context) { getReglasPrecio(c, db) })
+	r.GET("/reglas_precio/:id", func(c *gin.Context) { getReglaPrecio(c, db) })
+	r.POST("/reglas_precio", func(c *gin.Context) { createReglaPrecio(c, db) })
+	r.PUT("/reglas_precio/:id", func(c *gin.Context) { updateReglaPrecio(c, db) })
+	r.DELETE("/reglas_precio/:id", func(c *gin.Context) { deleteReglaPrecio(c, db) })
+	r.GET("/cotizacion", func(c *gin.Context) { getCotizacion(c, db) })
+
+	// Cupones
+	r.GET("/cupones", func(c *gin.Context) { getCupones(c, db) })
+	r.GET("/cupones/:id", func(c *gin.Context) { getCupon(c, db) })
+	r.POST("/cupones", func(c *gin.Context) { createCupon(c, db) })
+	r.PUT("/cupones/:id", func(c *gin.Context) { updateCupon(c, db) })
+	r.DELETE("/cupones/:id", func(c *gin.Context) { deleteCupon(c, db) })
+	r.GET("/reportes/cupones", func(c *gin.Context) { getReporteCupones(c, db) })
+
+	// Paquetes prepagos y tarjetas de regalo
+	r.GET("/paquetes", func(c *gin.Context) { getPaquetes(c, db) })
+	r.POST("/paquetes", func(c *gin.Context) { createPaquete(c, db) })
+	r.PUT("/paquetes/:id", func(c *gin.Context) { updatePaquete(c, db) })
+	r.DELETE("/paquetes/:id", func(c *gin.Context) { deletePaquete(c, db) })
+	r.GET("/clientes/:id/paquetes", func(c *gin.Context) { getPaquetesCliente(c, db) })
+	r.POST("/clientes/:id/paquetes", func(c *gin.Context) { venderPaquete(c, db) })
+	r.GET("/tarjetas_regalo", func(c *gin.Context) { getTarjetasRegalo(c, db) })
+	r.GET("/tarjetas_regalo/:codigo", func(c *gin.Context) { getTarjetaRegalo(c, db) })
+	r.POST("/tarjetas_regalo", func(c *gin.Context) { createTarjetaRegalo(c, db) })
+	r.POST("/tarjetas_regalo/:codigo/anular", func(c *gin.Context) { anularTarjetaRegalo(c, db) })
+
+	// Membresías
+	r.GET("/planes_membresia", func(c *gin.Context) { getPlanesMembresia(c, db) })
+	r.POST("/planes_membresia", func(c *gin.Context) { createPlanMembresia(c, db) })
+	r.PUT("/planes_membresia/:id", func(c *gin.Context) { updatePlanMembresia(c, db) })
+	r.DELETE("/planes_membresia/:id", func(c *gin.Context) { deletePlanMembresia(c, db) })
+	r.GET("/suscripciones", func(c *gin.Context) { getSuscripciones(c, db) })
+	r.GET("/clientes/:id/suscripciones", func(c *gin.Context) { getSuscripcionesCliente(c, db) })
+	r.POST("/clientes/:id/suscripciones", func(c *gin.Context) { createSuscripcion(c, db) })
+	r.POST("/suscripciones/:id/cancelar", func(c *gin.Context) { cancelarSuscripcion(c, db) })
+	r.POST("/suscripciones/:id/pagos", func(c *gin.Context) { pagarPeriodoSuscripcion(c, db) })
+
+	// Categorías de servicios
+	r.GET("/categorias_servicio", func(c *gin.Context) { getCategoriasServicio(c, db) })
+	r.POST("/categorias_servicio", func(c *gin.Context) { createCategoriaServicio(c, db) })
+	r.PUT("/categorias_servicio/:id", func(c *gin.Context) { updateCategoriaServicio(c, db) })
+	r.DELETE("/categorias_servicio/:id", func(c *gin.Context) { deleteCategoriaServicio(c, db) })
 
 	// CRUD de turnos           // VERIFICADO
 	r.GET("/turnos", func(c *gin.Context) { getTurnos(c, db) })
+	r.GET("/turnos/export", func(c *gin.Context) { exportTurnos(c, db) })
 	r.GET("/horarios_disponibles", func(c *gin.Context) { getHorariosDisponibles(c, db) })
+	r.GET("/agenda", func(c *gin.Context) { getAgenda(c, db) })
 	r.GET("/turnos/cliente/:id", func(c *gin.Context) { getTurnosPorCliente(c, db) })	
 	r.POST("/turnos", func(c *gin.Context) { createTurno(c, db) })
 	r.PUT("/turnos/:id", func(c *gin.Context) { updateTurno(c, db) })
 	r.DELETE("/turnos/:id", func(c *gin.Context) { deleteTurno(c, db) })
 
+	// Pagos
+	r.GET("/turnos/:id/pagos", func(c *gin.Context) { getPagosTurno(c, db) })
+	r.POST("/turnos/:id/pagos", func(c *gin.Context) { createPago(c, db) })
+	r.GET("/pagos", func(c *gin.Context) { getPagos(c, db) })
+	r.GET("/turnos/:id/comprobante", func(c *gin.Context) { getComprobante(c, db) })
+
+	// Facturación electrónica
+	r.POST("/turnos/:id/factura", func(c *gin.Context) { createFactura(c, db) })
+	r.GET("/turnos/:id/factura", func(c *gin.Context) { getFacturaTurno(c, db) })
+	r.GET("/facturas", func(c *gin.Context) { getFacturas(c, db) })
+	r.POST("/facturas/:id/reintentar", func(c *gin.Context) { reintentarFactura(c, db) })
+	r.PUT("/clientes/:id/fiscal", func(c *gin.Context) { updateDatosFiscales(c, db) })
+
+	// Señas por pasarela de pago
+	if pasarela != nil {
+		r.POST("/webhooks/pagos", func(c *gin.Context) { webhookPagos(c, db) })
+	}
+	if _, ok := pasarela.(*pasarelaFake); ok {
+		r.POST("/pasarela/fake/checkout/:referencia", func(c *gin.Context) { pagarCheckoutFake(c, db) })
+	}
+
+	// Comisiones y liquidaciones de empleados
+	r.GET("/reglas_comision", func(c *gin.Context) { getReglasComision(c, db) })
+	r.POST("/reglas_comision", func(c *gin.Context) { createReglaComision(c, db) })
+	r.PUT("/reglas_comision/:id", func(c *gin.Context) { updateReglaComision(c, db) })
+	r.DELETE("/reglas_comision/:id", func(c *gin.Context) { deleteReglaComision(c, db) })
+	r.GET("/empleados/:id/liquidacion", func(c *gin.Context) { getLiquidacionEmpleado(c, db) })
+	r.GET("/empleados/:id/liquidaciones", func(c *gin.Context) { getLiquidacionesEmpleado(c, db) })
+	r.POST("/empleados/:id/liquidaciones", func(c *gin.Context) { cerrarLiquidacion(c, db) })
+	r.GET("/liquidaciones/:id", func(c *gin.Context) { getLiquidacion(c, db) })
+
+	// Horarios de trabajo de empleados y reportes
+	r.GET("/empleados/:id/horarios", func(c *gin.Context) { getHorariosEmpleado(c, db) })
+	r.PUT("/empleados/:id/horarios", func(c *gin.Context) { updateHorariosEmpleado(c, db) })
+	r.GET("/reportes/ocupacion", func(c *gin.Context) { getReporteOcupacion(c, db) })
+	r.GET("/reportes/ingresos", func(c *gin.Context) { getReporteIngresos(c, db) })
+	r.GET("/reportes/cancelaciones", func(c *gin.Context) { getReporteCancelaciones(c, db) })
+	r.GET("/reportes/retencion", func(c *gin.Context) { getReporteRetencion(c, db) })
+	r.GET("/reportes/clientes_atrasados", func(c *gin.Context) { getClientesAtrasados(c, db) })
+
+	// Tablero del dueño
+	r.GET("/dashboard", func(c *gin.Context) { getDashboard(c, db) })
+
+	// Reportes programados por email
+	r.GET("/reportes_programados", func(c *gin.Context) { getReportesProgramados(c, db) })
+	r.POST("/reportes_programados", func(c *gin.Context) { createReporteProgramado(c, db) })
+	r.PUT("/reportes_programados/:id", func(c *gin.Context) { updateReporteProgramado(c, db) })
+	r.DELETE("/reportes_programados/:id", func(c *gin.Context) { deleteReporteProgramado(c, db) })
+	r.POST("/reportes_programados/:id/enviar", func(c *gin.Context) { enviarReporteProgramado(c, db) })
+	r.GET("/reportes_programados/:id/vista", func(c *gin.Context) { vistaReporteProgramado(c, db) })
+	r.GET("/envios_reportes", func(c *gin.Context) { getEnviosReportes(c, db) })
+
+	// Configuración del negocio
+	r.GET("/configuracion", func(c *gin.Context) { getConfiguracion(c, db) })
+	r.PUT("/configuracion", func(c *gin.Context) { updateConfiguracion(c, db) })
+
 	r.Run(":2020")
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Envío de emails. La implementación se elige con NOTIFICADOR: "smtp" (SMTP_HOST,
+// SMTP_PUERTO, SMTP_USUARIO, SMTP_CLAVE, SMTP_REMITENTE) o "archivo" (solo desarrollo:
+// guarda cada mensaje como .eml en NOTIFICADOR_DIR y no lo envía). Sin NOTIFICADOR no
+// se envían emails y los reportes programados quedan registrados como no_enviado.
+
+type Email struct {
+	Para     []string
+	Asunto   string
+	HTML     string
+	Adjuntos []Adjunto
+}
+
+type Adjunto struct {
+	Nombre    string
+	Tipo      string // tipo MIME
+	Contenido []byte
+}
+
+type Notificador interface {
+	Nombre() string
+	// Devuelve el tamaño del mensaje enviado, para el historial
+	Enviar(e Email) (int, error)
+}
+
+var notificador Notificador
+
+var errSinNotificador = errors.New("no hay notificador de emails configurado (NOTIFICADOR)")
+
+// Devuelve nil si no hay notificador configurado
+func nuevoNotificador() (Notificador, error) {
+	switch nombre := os.Getenv("NOTIFICADOR"); nombre {
+	case "":
+		log.Println("Notificador: ninguno (no se envían emails)")
+		return nil, nil
+	case "smtp":
+		n := &notificadorSMTP{
+			host:      os.Getenv("SMTP_HOST"),
+			puerto:    env("SMTP_PUERTO", "587"),
+			usuario:   os.Getenv("SMTP_USUARIO"),
+			clave:     os.Getenv("SMTP_CLAVE"),
+			remitente: os.Getenv("SMTP_REMITENTE"),
+		}
+		if n.host == "" || n.remitente == "" {
+			return nil, errors.New("SMTP_HOST y SMTP_REMITENTE son requeridos")
+		}
+		return n, nil
+	case "archivo":
+		log.Println("Notificador: archivo (solo desarrollo, no envía emails)")
+		return &notificadorArchivo{dir: env("NOTIFICADOR_DIR", "emails"), remitente: env("SMTP_REMITENTE", "turnos@localhost")}, nil
+	default:
+		return nil, fmt.Errorf("NOTIFICADOR inválido: %s (smtp o archivo)", nombre)
+	}
+}
+
+// Arma el mensaje MIME: cuerpo HTML y adjuntos, todo en base64
+func armarMensaje(remitente string, e Email) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", remitente)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.Para, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.Asunto))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parte := func(h textproto.MIMEHeader, contenido []byte) error {
+		h.Set("Content-Transfer-Encoding", "base64")
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		// Líneas de 76 caracteres (RFC 2045)
+		cod := base64.StdEncoding.EncodeToString(contenido)
+		for len(cod) > 76 {
+			if _, err := w.Write([]byte(cod[:76] + "\r\n")); err != nil {
+				return err
+			}
+			cod = cod[76:]
+		}
+		_, err = w.Write([]byte(cod + "\r\n"))
+		return err
+	}
+
+	if err := parte(textproto.MIMEHeader{"Content-Type": {"text/html; charset=utf-8"}}, []byte(e.HTML)); err != nil {
+		return nil, err
+	}
+	for _, a := range e.Adjuntos {
+		h := textproto.MIMEHeader{
+			"Content-Type":        {mime.FormatMediaType(a.Tipo, map[string]string{"name": a.Nombre})},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": a.Nombre})},
+		}
+		if err := parte(h, a.Contenido); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type notificadorSMTP struct {
+	host, puerto, usuario, clave, remitente string
+}
+
+func (n *notificadorSMTP) Nombre() string { return "smtp" }
+
+// smtp.SendMail usa STARTTLS si el servidor lo ofrece
+func (n *notificadorSMTP) Enviar(e Email) (int, error) {
+	if n.host == "" || n.remitente == "" {
+		return 0, errors.New("SMTP_HOST y SMTP_REMITENTE son requeridos")
+	}
+	msg, err := armarMensaje(n.remitente, e)
+	if err != nil {
+		return 0, err
+	}
+	var auth smtp.Auth
+	if n.usuario != "" {
+		auth = smtp.PlainAuth("", n.usuario, n.clave, n.host)
+	}
+	if err := smtp.SendMail(n.host+":"+n.puerto, auth, n.remitente, e.Para, msg); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+// Notificador local: escribe el mensaje completo en un archivo .eml que se
+// puede abrir con cualquier cliente de correo
+type notificadorArchivo struct {
+	dir, remitente string
+}
+
+func (n *notificadorArchivo) Nombre() string { return "archivo" }
+
+func (n *notificadorArchivo) Enviar(e Email) (int, error) {
+	msg, err := armarMensaje(n.remitente, e)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(n.dir, 0o755); err != nil {
+		return 0, err
+	}
+	ruta := filepath.Join(n.dir, time.Now().Format("20060102-150405.000000000")+".eml")
+	if err := os.WriteFile(ruta, msg, 0o644); err != nil {
+		return 0, err
+	}
+	log.Printf("Email a %s: %q guardado en %s", strings.Join(e.Para, ", "), e.Asunto, ruta)
+	return len(msg), nil
+}
+
+// Borra los .eml guardados por el notificador de archivo que mencionan alguno de
+// los datos (se usa al anonimizar un cliente). Los adjuntos que no son texto (PDF,
+// XLSX) no se pueden revisar y pueden contener los datos: esos mensajes también se borran.
+func borrarEmailsCliente(datos []string) error {
+	n, ok := notificador.(*notificadorArchivo)
+	if !ok {
+		return nil
+	}
+	var buscar [][]byte
+	for _, d := range datos {
+		if d = strings.TrimSpace(d); d != "" {
+			buscar = append(buscar, bytes.ToLower([]byte(d)), bytes.ToLower([]byte(html.EscapeString(d))))
+		}
+	}
+	if len(buscar) == 0 {
+		return nil
+	}
+
+	rutas, err := filepath.Glob(filepath.Join(n.dir, "*.eml"))
+	if err != nil {
+		return err
+	}
+	for _, ruta := range rutas {
+		msg, err := os.ReadFile(ruta)
+		if err != nil {
+			return err
+		}
+		if !emailMenciona(msg, buscar) {
+			continue
+		}
+		if err := os.Remove(ruta); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		log.Printf("Email %s borrado: mencionaba a un cliente anonimizado", ruta)
+	}
+	return nil
+}
+
+// Revisa los encabezados y las partes de texto decodificadas. Un mensaje que no se
+// puede leer o con adjuntos binarios se considera que menciona los datos.
+func emailMenciona(msg []byte, buscar [][]byte) bool {
+	contiene := func(b []byte) bool {
+		b = bytes.ToLower(b)
+		for _, s := range buscar {
+			if bytes.Contains(b, s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return true
+	}
+	for _, h := range []string{"To", "Subject"} {
+		v, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get(h))
+		if err != nil || contiene([]byte(v)) {
+			return true
+		}
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return true
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			return true
+		}
+		tipo, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if !strings.HasPrefix(tipo, "text/") {
+			return true
+		}
+		var r io.Reader = p
+		if strings.EqualFold(p.Header.Get("Content-Transfer-Encoding"), "base64") {
+			r = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		contenido, err := io.ReadAll(r)
+		if err != nil || contiene(contenido) {
+			return true
+		}
+	}
+}
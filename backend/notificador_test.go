@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestEmailMenciona(t *testing.T) {
+	buscar := [][]byte{[]byte("juan pérez"), []byte("juan@example.com")}
+	casos := []struct {
+		nombre string
+		email  Email
+		want   bool
+	}{
+		{"sin datos", Email{Para: []string{"duenio@barberia.com"}, Asunto: "Resumen", HTML: "<p>Total: $ 1.000</p>"}, false},
+		{"en el cuerpo", Email{Para: []string{"duenio@barberia.com"}, Asunto: "Atrasados", HTML: "<td>Juan Pérez</td>"}, true},
+		{"en el destinatario", Email{Para: []string{"JUAN@example.com"}, Asunto: "Recordatorio", HTML: "<p>Hola</p>"}, true},
+		{"en el asunto", Email{Para: []string{"duenio@barberia.com"}, Asunto: "Turno de Juan Pérez", HTML: "<p>Hola</p>"}, true},
+		{"csv de texto", Email{Para: []string{"duenio@barberia.com"}, Asunto: "Resumen", HTML: "<p>Adjunto</p>",
+			Adjuntos: []Adjunto{{Nombre: "r.csv", Tipo: "text/csv", Contenido: []byte("cliente,total\nAna,100\n")}}}, false},
+		{"adjunto binario", Email{Para: []string{"duenio@barberia.com"}, Asunto: "Resumen", HTML: "<p>Adjunto</p>",
+			Adjuntos: []Adjunto{{Nombre: "r.pdf", Tipo: "application/pdf", Contenido: []byte("%PDF-1.3")}}}, true},
+	}
+	for _, c := range casos {
+		msg, err := armarMensaje("turnos@localhost", c.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailMenciona(msg, buscar); got != c.want {
+			t.Errorf("%s: emailMenciona = %v, se esperaba %v", c.nombre, got, c.want)
+		}
+	}
+	if !emailMenciona([]byte("no es un email"), buscar) {
+		t.Error("un mensaje ilegible debería considerarse que menciona los datos")
+	}
+}
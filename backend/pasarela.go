@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Pasarela de pagos para cobrar señas. La implementación se elige con la variable
+// de entorno PASARELA_PAGOS: "mercadopago" (MP_ACCESS_TOKEN, MP_WEBHOOK_SECRET) o
+// "fake" (solo desarrollo, PASARELA_FAKE_SECRET). Sin PASARELA_PAGOS no se cobran
+// señas: los turnos que la requieren se rechazan.
+
+// Cobro a generar en la pasarela
+type Cobro struct {
+	Referencia string // identifica la seña en nuestros webhooks ("sena-12")
+	Titulo     string
+	Monto      Dinero
+	Moneda     string
+	VenceEn    time.Time
+}
+
+// Link de pago generado por la pasarela
+type Checkout struct {
+	ID  string
+	URL string
+}
+
+// Notificación de la pasarela ya verificada y normalizada
+type EventoPago struct {
+	EventoID   string `json:"evento_id"`  // único por notificación, para idempotencia
+	Referencia string `json:"referencia"` // la Referencia del Cobro
+	PagoID     string `json:"pago_id"`    // id del pago en la pasarela
+	Estado     string `json:"estado"`     // aprobado, rechazado, pendiente, vencido
+	Monto      Dinero `json:"monto"`
+}
+
+type PasarelaPago interface {
+	Nombre() string
+	Metodo() string // método con el que se registra el cobro en el libro de pagos
+	CrearCobro(c Cobro) (Checkout, error)
+	// Verifica la firma del webhook y devuelve el evento. Referencia vacía = evento a ignorar.
+	LeerWebhook(r *http.Request, body []byte) (EventoPago, error)
+}
+
+var errFirmaInvalida = errors.New("firma inválida")
+
+var errSinPasarela = errors.New("el turno requiere seña y no hay pasarela de pagos configurada")
+
+var pasarela PasarelaPago
+
+func env(clave, porDefecto string) string {
+	if v := os.Getenv(clave); v != "" {
+		return v
+	}
+	return porDefecto
+}
+
+// URL pública del backend, usada en los links de checkout y notificaciones
+func urlPublica() string {
+	return env("URL_PUBLICA", "http://localhost:2020")
+}
+
+// Devuelve nil si no hay pasarela configurada. Una configuración incompleta es un
+// error: los webhooks firmados con un secreto vacío o conocido serían falsificables.
+func nuevaPasarela() (PasarelaPago, error) {
+	switch nombre := os.Getenv("PASARELA_PAGOS"); nombre {
+	case "":
+		log.Println("Pasarela de pagos: ninguna (no se cobran señas)")
+		return nil, nil
+	case "mercadopago":
+		mp := &mercadoPago{
+			accessToken:   os.Getenv("MP_ACCESS_TOKEN"),
+			webhookSecret: os.Getenv("MP_WEBHOOK_SECRET"),
+			cliente:       &http.Client{Timeout: 15 * time.Second},
+		}
+		if mp.accessToken == "" || mp.webhookSecret == "" {
+			return nil, errors.New("MP_ACCESS_TOKEN y MP_WEBHOOK_SECRET son requeridos")
+		}
+		return mp, nil
+	case "fake":
+		secreto := os.Getenv("PASARELA_FAKE_SECRET")
+		if secreto == "" {
+			return nil, errors.New("PASARELA_FAKE_SECRET es requerido")
+		}
+		log.Println("Pasarela de pagos: fake (solo desarrollo)")
+		return &pasarelaFake{secreto: secreto}, nil
+	default:
+		return nil, fmt.Errorf("PASARELA_PAGOS inválida: %s (mercadopago o fake)", nombre)
+	}
+}
+
+// Pasarela local para desarrollo y pruebas: el checkout se simula con
+// POST /pasarela/fake/checkout/:referencia y los webhooks se firman con HMAC-SHA256 del body.
+type pasarelaFake struct {
+	secreto string
+}
+
+func (p *pasarelaFake) Nombre() string { return "fake" }
+
+func (p *pasarelaFake) Metodo() string { return "mercado_pago" }
+
+func (p *pasarelaFake) CrearCobro(c Cobro) (Checkout, error) {
+	return Checkout{
+		ID:  "fake-" + c.Referencia,
+		URL: urlPublica() + "/pasarela/fake/checkout/" + c.Referencia,
+	}, nil
+}
+
+func (p *pasarelaFake) firmar(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.secreto))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Header X-Firma: hex(HMAC-SHA256(secreto, body))
+func (p *pasarelaFake) LeerWebhook(r *http.Request, body []byte) (EventoPago, error) {
+	var ev EventoPago
+	if !hmac.Equal([]byte(r.Header.Get("X-Firma")), []byte(p.firmar(body))) {
+		return ev, errFirmaInvalida
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return ev, err
+	}
+	if ev.EventoID == "" {
+		return ev, errors.New("evento_id es requerido")
+	}
+	return ev, nil
+}
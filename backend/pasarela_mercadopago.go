@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Mercado Pago Checkout Pro: cada seña es una preferencia con external_reference = Referencia.
+// Las notificaciones solo traen el id del pago; el estado se consulta a la API.
+
+const mercadoPagoAPI = "https://api.mercadopago.com"
+
+type mercadoPago struct {
+	accessToken   string
+	webhookSecret string
+	cliente       *http.Client
+}
+
+func (mp *mercadoPago) Nombre() string { return "mercadopago" }
+
+func (mp *mercadoPago) Metodo() string { return "mercado_pago" }
+
+func (mp *mercadoPago) llamar(metodo, ruta string, body, destino interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(metodo, mercadoPagoAPI+ruta, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+mp.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := mp.cliente.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("mercado pago respondió %s en %s", resp.Status, ruta)
+	}
+	return json.NewDecoder(resp.Body).Decode(destino)
+}
+
+func (mp *mercadoPago) CrearCobro(c Cobro) (Checkout, error) {
+	pref := map[string]interface{}{
+		"items": []map[string]interface{}{{
+			"title":       c.Titulo,
+			"quantity":    1,
+			"unit_price":  c.Monto.Float64(),
+			"currency_id": c.Moneda,
+		}},
+		"external_reference": c.Referencia,
+		"notification_url":   urlPublica() + "/webhooks/pagos",
+		"expires":            true,
+		"expiration_date_to": c.VenceEn.Format("2006-01-02T15:04:05.000-07:00"),
+	}
+
+	var resp struct {
+		ID        string `json:"id"`
+		InitPoint string `json:"init_point"`
+	}
+	if err := mp.llamar("POST", "/checkout/preferences", pref, &resp); err != nil {
+		return Checkout{}, err
+	}
+	return Checkout{ID: resp.ID, URL: resp.InitPoint}, nil
+}
+
+// Valida x-signature ("ts=...,v1=...") según el manifiesto "id:<data.id>;request-id:<x-request-id>;ts:<ts>;"
+func (mp *mercadoPago) firmaValida(r *http.Request, dataID string) bool {
+	var ts, v1 string
+	for _, parte := range strings.Split(r.Header.Get("x-signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(parte), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "ts":
+			ts = kv[1]
+		case "v1":
+			v1 = kv[1]
+		}
+	}
+	if ts == "" || v1 == "" || mp.webhookSecret == "" {
+		return false
+	}
+
+	manifiesto := fmt.Sprintf("id:%s;request-id:%s;ts:%s;", strings.ToLower(dataID), r.Header.Get("x-request-id"), ts)
+	mac := hmac.New(sha256.New, []byte(mp.webhookSecret))
+	mac.Write([]byte(manifiesto))
+	return hmac.Equal([]byte(v1), []byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+func (mp *mercadoPago) LeerWebhook(r *http.Request, body []byte) (EventoPago, error) {
+	var ev EventoPago
+	var notif struct {
+		Type string `json:"type"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(body, &notif)
+
+	dataID := r.URL.Query().Get("data.id")
+	if dataID == "" {
+		dataID = notif.Data.ID
+	}
+	if !mp.firmaValida(r, dataID) {
+		return ev, errFirmaInvalida
+	}
+	if notif.Type != "payment" && r.URL.Query().Get("type") != "payment" {
+		return ev, nil // otras notificaciones (merchant_order, etc.) se ignoran
+	}
+
+	var pago struct {
+		Status            string `json:"status"`
+		ExternalReference string `json:"external_reference"`
+		TransactionAmount Dinero `json:"transaction_amount"`
+	}
+	if err := mp.llamar("GET", "/v1/payments/"+dataID, nil, &pago); err != nil {
+		return ev, err
+	}
+
+	ev.Referencia = pago.ExternalReference
+	ev.PagoID = dataID
+	ev.Monto = pago.TransactionAmount
+	// Un mismo pago notifica varias veces al cambiar de estado: cada estado se procesa una vez
+	ev.EventoID = dataID + ":" + pago.Status
+	switch pago.Status {
+	case "approved":
+		ev.Estado = "aprobado"
+	case "rejected", "cancelled":
+		ev.Estado = "rechazado"
+	default:
+		ev.Estado = "pendiente"
+	}
+	return ev, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPasarelaFakeLeerWebhook(t *testing.T) {
+	p := &pasarelaFake{secreto: "secreto-test"}
+	body := []byte(`{"evento_id":"e1","referencia":"sena-3","pago_id":"p1","estado":"aprobado","monto":1500.00}`)
+	casos := []struct {
+		nombre string
+		body   []byte
+		firma  string
+		err    error
+	}{
+		{"firma válida", body, p.firmar(body), nil},
+		{"sin firma", body, "", errFirmaInvalida},
+		{"otro secreto", body, (&pasarelaFake{secreto: "otro"}).firmar(body), errFirmaInvalida},
+		{"body alterado", []byte(strings.Replace(string(body), "1500.00", "1.00", 1)), p.firmar(body), errFirmaInvalida},
+	}
+	for _, c := range casos {
+		r := httptest.NewRequest("POST", "/webhooks/pagos", nil)
+		r.Header.Set("X-Firma", c.firma)
+		ev, err := p.LeerWebhook(r, c.body)
+		if err != c.err {
+			t.Errorf("%s: error = %v, se esperaba %v", c.nombre, err, c.err)
+			continue
+		}
+		if err == nil && (ev.Referencia != "sena-3" || ev.Monto != pesos(1500)) {
+			t.Errorf("%s: evento = %+v", c.nombre, ev)
+		}
+	}
+}
+
+func TestMercadoPagoFirmaValida(t *testing.T) {
+	mp := &mercadoPago{webhookSecret: "secreto-mp"}
+	firmar := func(manifiesto string) string {
+		mac := hmac.New(sha256.New, []byte("secreto-mp"))
+		mac.Write([]byte(manifiesto))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	v1 := firmar("id:abc123;request-id:req-1;ts:1700000000;")
+	casos := []struct {
+		nombre, firma, requestID, dataID string
+		want                             bool
+	}{
+		{"válida", "ts=1700000000,v1=" + v1, "req-1", "abc123", true},
+		{"data.id en mayúsculas", "ts=1700000000, v1=" + v1, "req-1", "ABC123", true},
+		{"otro request-id", "ts=1700000000,v1=" + v1, "req-2", "abc123", false},
+		{"otro ts", "ts=1700000001,v1=" + v1, "req-1", "abc123", false},
+		{"otro pago", "ts=1700000000,v1=" + v1, "req-1", "abc124", false},
+		{"sin v1", "ts=1700000000", "req-1", "abc123", false},
+		{"vacía", "", "req-1", "abc123", false},
+	}
+	for _, c := range casos {
+		r := httptest.NewRequest("POST", "/webhooks/pagos", nil)
+		r.Header.Set("x-signature", c.firma)
+		r.Header.Set("x-request-id", c.requestID)
+		if got := mp.firmaValida(r, c.dataID); got != c.want {
+			t.Errorf("%s: firmaValida = %v, se esperaba %v", c.nombre, got, c.want)
+		}
+	}
+	if (&mercadoPago{}).firmaValida(httptest.NewRequest("POST", "/", nil), "abc123") {
+		t.Error("sin secreto configurado ninguna firma debería ser válida")
+	}
+}
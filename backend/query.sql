@@ -40,3 +40,542 @@ CREATE TABLE IF NOT EXISTS turnos (
 );
 
 
+
+-- Consentimientos de clientes (Ley 25.326)
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS consentimiento_datos BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS consentimiento_datos_fecha TIMESTAMP;
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS consentimiento_marketing BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS consentimiento_marketing_fecha TIMESTAMP;
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS anonimizado_en TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS consentimientos (
+    id SERIAL PRIMARY KEY,
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    tipo VARCHAR(20) NOT NULL,      -- datos, marketing
+    otorgado BOOLEAN NOT NULL,
+    fecha TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Etiquetas de clientes
+CREATE TABLE IF NOT EXISTS etiquetas (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(50) NOT NULL UNIQUE,
+    color VARCHAR(20) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS cliente_etiquetas (
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    etiqueta_id INT NOT NULL REFERENCES etiquetas(id) ON DELETE CASCADE,
+    PRIMARY KEY (cliente_id, etiqueta_id)
+);
+
+-- Segmentos dinámicos (reglas evaluadas en SQL)
+CREATE TABLE IF NOT EXISTS segmentos (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL UNIQUE,
+    descripcion TEXT NOT NULL DEFAULT '',
+    reglas JSONB NOT NULL DEFAULT '[]'
+);
+
+-- Configuración del negocio (clave/valor)
+CREATE TABLE IF NOT EXISTS configuracion (
+    clave VARCHAR(100) PRIMARY KEY,
+    valor TEXT NOT NULL
+);
+
+-- Ausencias, cancelaciones tardías y restricciones de reserva
+-- estado de turnos: pendiente, confirmado, cancelado, completado, no_show
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS cancelado_en TIMESTAMP;
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS origen VARCHAR(20) NOT NULL DEFAULT 'local'; -- local, online
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS excepcion_restricciones BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Programa de puntos
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS puntos INT; -- puntos fijos por servicio (NULL = según precio)
+
+CREATE TABLE IF NOT EXISTS puntos_movimientos (
+    id SERIAL PRIMARY KEY,
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    turno_id INT REFERENCES turnos(id) ON DELETE SET NULL,
+    tipo VARCHAR(20) NOT NULL,      -- acreditacion, canje, reintegro, anulacion, ajuste, vencimiento
+    puntos INT NOT NULL,            -- positivo suma, negativo resta
+    vence_en DATE,
+    descripcion TEXT NOT NULL DEFAULT '',
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Un turno acredita, canjea, reintegra y anula como máximo una vez
+CREATE UNIQUE INDEX IF NOT EXISTS puntos_movimientos_turno_tipo_idx
+    ON puntos_movimientos (turno_id, tipo) WHERE turno_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS puntos_movimientos_cliente_idx ON puntos_movimientos (cliente_id);
+
+-- Catálogo de servicios
+CREATE TABLE IF NOT EXISTS categorias_servicio (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL UNIQUE,  -- Cortes, Barba, Color
+    orden INT NOT NULL DEFAULT 0
+);
+
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS categoria_id INT REFERENCES categorias_servicio(id) ON DELETE SET NULL;
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS descripcion TEXT NOT NULL DEFAULT '';
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS imagen_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS orden INT NOT NULL DEFAULT 0;
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS activo BOOLEAN NOT NULL DEFAULT TRUE;             -- false = archivado
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS reservable_online BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Importes: moneda, historial de precios y precio congelado en cada turno
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS moneda VARCHAR(3) NOT NULL DEFAULT 'ARS';
+
+CREATE TABLE IF NOT EXISTS servicio_precios (
+    id SERIAL PRIMARY KEY,
+    servicio_id INT NOT NULL REFERENCES servicios(id) ON DELETE CASCADE,
+    precio NUMERIC(10,2) NOT NULL,
+    moneda VARCHAR(3) NOT NULL DEFAULT 'ARS',
+    vigente_desde TIMESTAMP NOT NULL,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS servicio_precios_vigencia_idx ON servicio_precios (servicio_id, vigente_desde DESC);
+
+-- Precio inicial para los servicios que todavía no tienen historial
+INSERT INTO servicio_precios (servicio_id, precio, moneda, vigente_desde)
+SELECT s.id, s.precio, s.moneda, '1970-01-01'
+FROM servicios s
+WHERE NOT EXISTS (SELECT 1 FROM servicio_precios sp WHERE sp.servicio_id = s.id);
+
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS precio_lista NUMERIC(10,2);
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS descuento NUMERIC(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS precio_final NUMERIC(10,2);
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS moneda VARCHAR(3) NOT NULL DEFAULT 'ARS';
+
+-- Los turnos anteriores al precio congelado toman el precio del servicio
+UPDATE turnos t SET precio_lista = s.precio, precio_final = s.precio - t.descuento
+FROM servicios s
+WHERE s.id = t.servicio_id AND t.precio_final IS NULL;
+
+-- Precios dinámicos (recargos y descuentos por día, franja, empleado o segmento)
+CREATE TABLE IF NOT EXISTS reglas_precio (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL,
+    servicio_id INT REFERENCES servicios(id) ON DELETE CASCADE,   -- NULL = todos
+    empleado_id INT REFERENCES empleados(id) ON DELETE CASCADE,   -- NULL = todos
+    segmento_id INT REFERENCES segmentos(id) ON DELETE RESTRICT,  -- NULL = todos los clientes
+    dias_semana INT[] NOT NULL DEFAULT '{}',                      -- 1 = lunes ... 7 = domingo, vacío = todos
+    hora_desde TIME,
+    hora_hasta TIME,
+    vigente_desde DATE,
+    vigente_hasta DATE,
+    tipo VARCHAR(20) NOT NULL,                                    -- porcentaje, monto
+    valor NUMERIC(10,2) NOT NULL,                                 -- positivo recargo, negativo descuento
+    prioridad INT NOT NULL DEFAULT 0,
+    activo BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Un segmento con reglas de precio no se borra: antes se borraban las reglas en cascada
+DO $$
+DECLARE
+    fk RECORD;
+BEGIN
+    FOR fk IN SELECT conname FROM pg_constraint
+              WHERE contype = 'f' AND conrelid = 'reglas_precio'::regclass
+                AND confrelid = 'segmentos'::regclass AND confdeltype = 'c'
+    LOOP
+        EXECUTE format('ALTER TABLE reglas_precio DROP CONSTRAINT %I', fk.conname);
+        EXECUTE format('ALTER TABLE reglas_precio ADD CONSTRAINT %I FOREIGN KEY (segmento_id) REFERENCES segmentos(id) ON DELETE RESTRICT', fk.conname);
+    END LOOP;
+END $$;
+
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS ajustes_precio JSONB NOT NULL DEFAULT '[]';
+
+-- Cupones y códigos promocionales
+CREATE TABLE IF NOT EXISTS cupones (
+    id SERIAL PRIMARY KEY,
+    codigo VARCHAR(40) NOT NULL UNIQUE,          -- se guarda en mayúsculas: BIENVENIDO20
+    campania VARCHAR(100) NOT NULL DEFAULT '',
+    descripcion TEXT NOT NULL DEFAULT '',
+    tipo VARCHAR(20) NOT NULL,                   -- porcentaje, monto
+    valor NUMERIC(10,2) NOT NULL,
+    vigente_desde DATE,
+    vigente_hasta DATE,
+    dias_semana INT[] NOT NULL DEFAULT '{}',     -- días del turno en que vale, vacío = todos
+    servicios INT[] NOT NULL DEFAULT '{}',       -- servicios en los que vale, vacío = todos
+    usos_max INT,                                -- NULL = sin límite
+    usos_por_cliente INT,                        -- NULL = sin límite
+    acumulable BOOLEAN NOT NULL DEFAULT FALSE,   -- se puede combinar con el canje de puntos
+    activo BOOLEAN NOT NULL DEFAULT TRUE,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS cupon_canjes (
+    id SERIAL PRIMARY KEY,
+    cupon_id INT NOT NULL REFERENCES cupones(id) ON DELETE CASCADE,
+    turno_id INT REFERENCES turnos(id) ON DELETE SET NULL,
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    descuento NUMERIC(10,2) NOT NULL,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    anulado_en TIMESTAMP                         -- turno cancelado o borrado: el uso se libera
+);
+CREATE UNIQUE INDEX IF NOT EXISTS cupon_canjes_turno_idx ON cupon_canjes (turno_id) WHERE turno_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS cupon_canjes_cupon_idx ON cupon_canjes (cupon_id);
+
+-- Pagos: libro de movimientos por turno (solo se agregan filas, nunca se modifican)
+CREATE TABLE IF NOT EXISTS pagos (
+    id SERIAL PRIMARY KEY,
+    turno_id INT NOT NULL REFERENCES turnos(id),
+    tipo VARCHAR(20) NOT NULL,                    -- pago, reintegro
+    metodo VARCHAR(20) NOT NULL,                  -- efectivo, debito, transferencia, mercado_pago
+    monto NUMERIC(10,2) NOT NULL,                 -- positivo pago, negativo reintegro
+    moneda VARCHAR(3) NOT NULL DEFAULT 'ARS',
+    referencia TEXT NOT NULL DEFAULT '',          -- nro. de operación, comprobante de transferencia
+    nota TEXT NOT NULL DEFAULT '',
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS pagos_turno_idx ON pagos (turno_id);
+CREATE INDEX IF NOT EXISTS pagos_creado_idx ON pagos (creado_en);
+
+CREATE OR REPLACE FUNCTION pagos_inmutables() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'los pagos no se modifican ni se borran: registrar un reintegro';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS pagos_inmutables ON pagos;
+CREATE TRIGGER pagos_inmutables BEFORE UPDATE OR DELETE ON pagos
+    FOR EACH ROW EXECUTE FUNCTION pagos_inmutables();
+
+-- Saldo de cada turno: precio final menos lo cobrado
+CREATE OR REPLACE VIEW turno_saldos AS
+SELECT t.id AS turno_id,
+       COALESCE(t.precio_final, 0) AS precio_final,
+       COALESCE(SUM(p.monto), 0) AS pagado,
+       COALESCE(t.precio_final, 0) - COALESCE(SUM(p.monto), 0) AS saldo
+FROM turnos t
+LEFT JOIN pagos p ON p.turno_id = t.id
+GROUP BY t.id, t.precio_final;
+
+-- Señas cobradas por pasarela de pago
+ALTER TABLE servicios ADD COLUMN IF NOT EXISTS sena NUMERIC(10,2) NOT NULL DEFAULT 0;  -- 0 = no requiere seña
+
+CREATE TABLE IF NOT EXISTS senas (
+    id SERIAL PRIMARY KEY,
+    turno_id INT NOT NULL UNIQUE REFERENCES turnos(id) ON DELETE CASCADE,
+    monto NUMERIC(10,2) NOT NULL,
+    moneda VARCHAR(3) NOT NULL DEFAULT 'ARS',
+    estado VARCHAR(20) NOT NULL DEFAULT 'pendiente',   -- pendiente, aprobada, vencida, a_reintegrar (cobrada con el turno cancelado)
+    pasarela VARCHAR(30) NOT NULL,
+    checkout_id TEXT NOT NULL DEFAULT '',
+    checkout_url TEXT NOT NULL DEFAULT '',
+    pago_externo_id TEXT NOT NULL DEFAULT '',
+    vence_en TIMESTAMP NOT NULL,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    resuelto_en TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS senas_pendientes_idx ON senas (vence_en) WHERE estado = 'pendiente';
+
+-- Eventos de webhook ya procesados (idempotencia)
+CREATE TABLE IF NOT EXISTS webhook_eventos (
+    pasarela VARCHAR(30) NOT NULL,
+    evento_id TEXT NOT NULL,
+    recibido_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (pasarela, evento_id)
+);
+
+-- Comprobantes de pago (PDF guardado para que cada re-descarga sea idéntica)
+CREATE TABLE IF NOT EXISTS numeradores (
+    sucursal INT NOT NULL,
+    tipo VARCHAR(30) NOT NULL,          -- comprobante
+    ultimo INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (sucursal, tipo)
+);
+
+CREATE TABLE IF NOT EXISTS comprobantes (
+    id SERIAL PRIMARY KEY,
+    turno_id INT NOT NULL UNIQUE REFERENCES turnos(id),
+    sucursal INT NOT NULL,
+    numero INT NOT NULL,
+    pdf BYTEA NOT NULL,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (sucursal, numero)
+);
+
+-- Facturación electrónica (ARCA, ex AFIP)
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS condicion_iva VARCHAR(30) NOT NULL DEFAULT 'consumidor_final';
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS cuit VARCHAR(11);
+
+CREATE TABLE IF NOT EXISTS facturas (
+    id SERIAL PRIMARY KEY,
+    turno_id INT NOT NULL UNIQUE REFERENCES turnos(id),
+    estado VARCHAR(20) NOT NULL DEFAULT 'pendiente',  -- pendiente, en_proceso, autorizada, error (se reintenta), rechazada
+    letra CHAR(1),
+    tipo_comprobante INT,                             -- 1 Factura A, 6 Factura B, 11 Factura C
+    punto_venta INT,
+    numero INT,
+    fecha DATE,
+    doc_tipo INT,                                     -- 80 CUIT, 96 DNI
+    doc_nro VARCHAR(11),
+    condicion_iva_receptor VARCHAR(30),
+    neto NUMERIC(10,2),
+    iva NUMERIC(10,2),
+    total NUMERIC(10,2),
+    cae VARCHAR(14),
+    cae_vencimiento DATE,
+    intentos INT NOT NULL DEFAULT 0,
+    ultimo_error TEXT NOT NULL DEFAULT '',
+    proximo_intento TIMESTAMP NOT NULL DEFAULT NOW(),
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    autorizada_en TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS facturas_numero_idx ON facturas (punto_venta, tipo_comprobante, numero) WHERE numero IS NOT NULL;
+CREATE INDEX IF NOT EXISTS facturas_cola_idx ON facturas (proximo_intento) WHERE estado IN ('pendiente', 'error');
+CREATE INDEX IF NOT EXISTS facturas_en_proceso_idx ON facturas (proximo_intento) WHERE estado = 'en_proceso';
+
+-- Paquetes prepagos de servicios ("pack 5 cortes")
+CREATE TABLE IF NOT EXISTS paquetes (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL,
+    servicio_id INT NOT NULL REFERENCES servicios(id),
+    cantidad INT NOT NULL,                    -- créditos (turnos) incluidos
+    precio NUMERIC(10,2) NOT NULL,
+    vigencia_dias INT NOT NULL DEFAULT 180,
+    activo BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Paquetes comprados por cada cliente
+CREATE TABLE IF NOT EXISTS paquetes_cliente (
+    id SERIAL PRIMARY KEY,
+    paquete_id INT NOT NULL REFERENCES paquetes(id),
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    servicio_id INT NOT NULL REFERENCES servicios(id),
+    precio NUMERIC(10,2) NOT NULL,
+    vence_en DATE NOT NULL,
+    comprado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS paquetes_cliente_cliente_idx ON paquetes_cliente (cliente_id);
+
+CREATE TABLE IF NOT EXISTS paquete_movimientos (
+    id SERIAL PRIMARY KEY,
+    paquete_cliente_id INT NOT NULL REFERENCES paquetes_cliente(id),
+    turno_id INT REFERENCES turnos(id) ON DELETE SET NULL,
+    tipo VARCHAR(20) NOT NULL,                -- compra, consumo, reintegro
+    creditos INT NOT NULL,                    -- positivo compra/reintegro, negativo consumo
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS paquete_movimientos_turno_idx
+    ON paquete_movimientos (turno_id, tipo) WHERE turno_id IS NOT NULL;
+
+-- Tarjetas de regalo con saldo en pesos
+CREATE TABLE IF NOT EXISTS tarjetas_regalo (
+    id SERIAL PRIMARY KEY,
+    codigo VARCHAR(20) NOT NULL UNIQUE,
+    monto NUMERIC(10,2) NOT NULL,             -- monto inicial
+    moneda VARCHAR(3) NOT NULL DEFAULT 'ARS',
+    comprador_id INT REFERENCES clientes(id),
+    destinatario VARCHAR(100) NOT NULL DEFAULT '',
+    vence_en DATE NOT NULL,
+    activo BOOLEAN NOT NULL DEFAULT TRUE,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS tarjeta_movimientos (
+    id SERIAL PRIMARY KEY,
+    tarjeta_id INT NOT NULL REFERENCES tarjetas_regalo(id),
+    turno_id INT REFERENCES turnos(id) ON DELETE SET NULL,
+    tipo VARCHAR(20) NOT NULL,                -- emision, consumo, reintegro
+    monto NUMERIC(10,2) NOT NULL,             -- positivo emision/reintegro, negativo consumo
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS tarjeta_movimientos_turno_idx
+    ON tarjeta_movimientos (turno_id, tipo) WHERE turno_id IS NOT NULL;
+
+-- Membresías ("Club"): servicios incluidos por período, descuento y reserva anticipada
+CREATE TABLE IF NOT EXISTS planes_membresia (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL,
+    precio NUMERIC(10,2) NOT NULL,            -- por período mensual
+    servicios INT[] NOT NULL DEFAULT '{}',    -- servicios incluidos
+    incluidos_por_periodo INT NOT NULL DEFAULT 0,
+    descuento_porcentaje NUMERIC(5,2) NOT NULL DEFAULT 0, -- sobre los servicios no incluidos
+    anticipacion_extra_dias INT NOT NULL DEFAULT 0,       -- prioridad para reservar online
+    activo BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE IF NOT EXISTS suscripciones (
+    id SERIAL PRIMARY KEY,
+    plan_id INT NOT NULL REFERENCES planes_membresia(id),
+    cliente_id INT NOT NULL REFERENCES clientes(id),
+    estado VARCHAR(20) NOT NULL DEFAULT 'activa', -- activa, vencida, cancelada
+    inicio DATE NOT NULL,                     -- ancla de los períodos mensuales
+    periodo_hasta DATE NOT NULL,              -- fin del último período generado
+    renovacion_automatica BOOLEAN NOT NULL DEFAULT TRUE,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW(),
+    cancelada_en TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS suscripciones_activa_idx ON suscripciones (cliente_id) WHERE estado = 'activa';
+
+-- Períodos facturados de cada suscripción
+CREATE TABLE IF NOT EXISTS suscripcion_periodos (
+    id SERIAL PRIMARY KEY,
+    suscripcion_id INT NOT NULL REFERENCES suscripciones(id),
+    desde DATE NOT NULL,
+    hasta DATE NOT NULL,
+    precio NUMERIC(10,2) NOT NULL,
+    metodo VARCHAR(20),
+    pagado_en TIMESTAMP,
+    UNIQUE (suscripcion_id, desde)
+);
+
+-- Turnos cubiertos por la membresía (uno por turno)
+CREATE TABLE IF NOT EXISTS membresia_usos (
+    id SERIAL PRIMARY KEY,
+    suscripcion_id INT NOT NULL REFERENCES suscripciones(id),
+    turno_id INT NOT NULL UNIQUE REFERENCES turnos(id) ON DELETE CASCADE,
+    periodo_desde DATE NOT NULL,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS membresia_usos_periodo_idx ON membresia_usos (suscripcion_id, periodo_desde);
+
+-- Propinas: se registran junto al pago y no cuentan para el saldo del turno
+ALTER TABLE pagos ADD COLUMN IF NOT EXISTS propina NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- Comisiones de empleados (la regla más específica gana: empleado+servicio, empleado, servicio, general)
+CREATE TABLE IF NOT EXISTS reglas_comision (
+    id SERIAL PRIMARY KEY,
+    empleado_id INT REFERENCES empleados(id),   -- NULL = todos
+    servicio_id INT REFERENCES servicios(id),   -- NULL = todos
+    tipo VARCHAR(20) NOT NULL,                  -- porcentaje, fijo, escalonado
+    valor NUMERIC(10,2) NOT NULL DEFAULT 0,     -- % o monto fijo por turno
+    tramos JSONB NOT NULL DEFAULT '[]',         -- escalonado: [{"desde": 0, "porcentaje": 40}, ...] por ventas del mes
+    activo BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Liquidaciones cerradas: guardan el detalle calculado para que no cambie después
+CREATE TABLE IF NOT EXISTS liquidaciones (
+    id SERIAL PRIMARY KEY,
+    empleado_id INT NOT NULL REFERENCES empleados(id),
+    desde DATE NOT NULL,
+    hasta DATE NOT NULL,
+    total_ventas NUMERIC(12,2) NOT NULL,
+    total_comision NUMERIC(12,2) NOT NULL,
+    total_propinas NUMERIC(12,2) NOT NULL,
+    total NUMERIC(12,2) NOT NULL,
+    cerrada_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS liquidaciones_empleado_idx ON liquidaciones (empleado_id, desde);
+
+CREATE TABLE IF NOT EXISTS liquidacion_items (
+    id SERIAL PRIMARY KEY,
+    liquidacion_id INT NOT NULL REFERENCES liquidaciones(id),
+    turno_id INT NOT NULL UNIQUE REFERENCES turnos(id),
+    fecha DATE NOT NULL,
+    servicio VARCHAR(100) NOT NULL,
+    base NUMERIC(10,2) NOT NULL,                -- precio final del turno
+    regla VARCHAR(100) NOT NULL,
+    comision NUMERIC(10,2) NOT NULL,
+    propinas NUMERIC(10,2) NOT NULL
+);
+
+-- Índices para el listado de turnos (filtros y orden por fecha)
+CREATE INDEX IF NOT EXISTS turnos_fecha_idx ON turnos (fecha, hora_inicio, id);
+CREATE INDEX IF NOT EXISTS turnos_empleado_fecha_idx ON turnos (empleado_id, fecha, hora_inicio);
+CREATE INDEX IF NOT EXISTS turnos_cliente_fecha_idx ON turnos (cliente_id, fecha);
+CREATE INDEX IF NOT EXISTS turnos_servicio_fecha_idx ON turnos (servicio_id, fecha);
+CREATE INDEX IF NOT EXISTS turnos_estado_fecha_idx ON turnos (estado, fecha);
+CREATE INDEX IF NOT EXISTS turnos_precio_idx ON turnos ((COALESCE(precio_final, 0)), id);
+
+-- Horario de trabajo de cada empleado (sin filas: la jornada general todos los días)
+CREATE TABLE IF NOT EXISTS horarios_empleado (
+    id SERIAL PRIMARY KEY,
+    empleado_id INT NOT NULL REFERENCES empleados(id),
+    dia_semana INT NOT NULL CHECK (dia_semana BETWEEN 1 AND 7),  -- ISO: 1 lunes ... 7 domingo
+    hora_inicio TIME NOT NULL,
+    hora_fin TIME NOT NULL CHECK (hora_fin > hora_inicio)
+);
+CREATE INDEX IF NOT EXISTS horarios_empleado_idx ON horarios_empleado (empleado_id, dia_semana);
+
+-- Motivo de cancelación de los turnos (ver motivosCancelacion)
+ALTER TABLE turnos ADD COLUMN IF NOT EXISTS motivo_cancelacion VARCHAR(30);
+
+-- Alta de clientes (los existentes toman la fecha de su primer turno)
+ALTER TABLE clientes ADD COLUMN IF NOT EXISTS creado_en TIMESTAMP;
+ALTER TABLE clientes ALTER COLUMN creado_en SET DEFAULT NOW();
+UPDATE clientes c SET creado_en = (SELECT MIN(t.fecha) FROM turnos t WHERE t.cliente_id = c.id)
+WHERE c.creado_en IS NULL AND EXISTS (SELECT 1 FROM turnos t WHERE t.cliente_id = c.id);
+CREATE INDEX IF NOT EXISTS clientes_creado_idx ON clientes (creado_en);
+
+-- Avisos de cambios para invalidar el caché del tablero (GET /dashboard)
+CREATE OR REPLACE FUNCTION notificar_cambio_dashboard() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('cambios_dashboard', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS turnos_dashboard ON turnos;
+CREATE TRIGGER turnos_dashboard AFTER INSERT OR UPDATE OR DELETE ON turnos
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS pagos_dashboard ON pagos;
+CREATE TRIGGER pagos_dashboard AFTER INSERT ON pagos
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS clientes_dashboard ON clientes;
+CREATE TRIGGER clientes_dashboard AFTER INSERT OR DELETE ON clientes
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS horarios_empleado_dashboard ON horarios_empleado;
+CREATE TRIGGER horarios_empleado_dashboard AFTER INSERT OR UPDATE OR DELETE ON horarios_empleado
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS paquetes_cliente_dashboard ON paquetes_cliente;
+CREATE TRIGGER paquetes_cliente_dashboard AFTER INSERT OR UPDATE OR DELETE ON paquetes_cliente
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS tarjetas_regalo_dashboard ON tarjetas_regalo;
+CREATE TRIGGER tarjetas_regalo_dashboard AFTER INSERT OR UPDATE OR DELETE ON tarjetas_regalo
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+DROP TRIGGER IF EXISTS suscripcion_periodos_dashboard ON suscripcion_periodos;
+CREATE TRIGGER suscripcion_periodos_dashboard AFTER INSERT OR UPDATE OR DELETE ON suscripcion_periodos
+    FOR EACH STATEMENT EXECUTE FUNCTION notificar_cambio_dashboard();
+
+-- Reportes programados por email (ver handlers_reportes_programados.go)
+CREATE TABLE IF NOT EXISTS reportes_programados (
+    id SERIAL PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL,
+    reporte VARCHAR(30) NOT NULL,                -- resumen, ingresos, ocupacion, cancelaciones
+    parametros JSONB NOT NULL DEFAULT '{}',
+    cron VARCHAR(100) NOT NULL,                  -- expresión de 5 campos ("0 8 * * 1"), sin @descriptores; como mucho un envío por hora
+    destinatarios TEXT[] NOT NULL,
+    formato VARCHAR(10) NOT NULL DEFAULT 'pdf' CHECK (formato IN ('pdf', 'csv', 'html')),
+    activo BOOLEAN NOT NULL DEFAULT true,
+    proximo_envio TIMESTAMP,
+    ultimo_envio TIMESTAMP,
+    creado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS reportes_programados_proximo_idx ON reportes_programados (proximo_envio) WHERE activo;
+
+CREATE TABLE IF NOT EXISTS envios_reportes (
+    id SERIAL PRIMARY KEY,
+    reporte_programado_id INT REFERENCES reportes_programados(id) ON DELETE SET NULL,
+    nombre VARCHAR(100) NOT NULL,
+    reporte VARCHAR(30) NOT NULL,
+    desde DATE NOT NULL,
+    hasta DATE NOT NULL,
+    destinatarios TEXT[] NOT NULL,
+    formato VARCHAR(10) NOT NULL,
+    origen VARCHAR(20) NOT NULL,                 -- programado, manual
+    estado VARCHAR(20) NOT NULL,                 -- enviado, no_enviado (sin notificador o archivo), error
+    error TEXT,
+    notificador VARCHAR(20) NOT NULL,
+    bytes INT NOT NULL DEFAULT 0,
+    enviado_en TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS envios_reportes_programado_idx ON envios_reportes (reporte_programado_id, enviado_en);
+
+-- Anonimización: el id del cliente es su DNI, así que al anonimizarlo se reemplaza por
+-- -nextval(clientes_anonimos_seq). Las FK a clientes actualizan en cascada.
+CREATE SEQUENCE IF NOT EXISTS clientes_anonimos_seq;
+DO $$
+DECLARE
+    fk RECORD;
+BEGIN
+    FOR fk IN SELECT conrelid::regclass AS tabla, conname, pg_get_constraintdef(oid) AS def
+              FROM pg_constraint
+              WHERE contype = 'f' AND confrelid = 'clientes'::regclass AND confupdtype <> 'c'
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', fk.tabla, fk.conname);
+        EXECUTE format('ALTER TABLE %s ADD CONSTRAINT %I %s ON UPDATE CASCADE', fk.tabla, fk.conname, fk.def);
+    END LOOP;
+END $$;
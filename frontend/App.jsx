@@ -122,16 +122,33 @@ const BarberBookingApp = () => {
   const API_BASE = 'http://localhost:2020';
 
   // Funciones de API
+
+  // La agenda muestra los turnos desde hoy; GET /turnos pagina por cursor, así que se siguen todas las páginas
+  const fetchTurnos = async () => {
+    const hoy = new Date().toISOString().split('T')[0];
+    let todos = [];
+    let cursor = null;
+    do {
+      const params = new URLSearchParams({ desde: hoy, orden: 'fecha', por_pagina: '200' });
+      if (cursor) params.set('cursor', cursor);
+      const res = await fetch(`${API_BASE}/turnos?${params}`);
+      const data = await res.json();
+      todos = todos.concat(data.turnos || []);
+      cursor = data.next_cursor;
+    } while (cursor);
+    return todos;
+  };
+
   const fetchData = async () => {
     try {
-      const [turnosRes, clientesRes, empleadosRes, serviciosRes] = await Promise.all([
-        fetch(`${API_BASE}/turnos`),
+      const [turnosDesdeHoy, clientesRes, empleadosRes, serviciosRes] = await Promise.all([
+        fetchTurnos(),
         fetch(`${API_BASE}/clientes`),
         fetch(`${API_BASE}/empleados`),
         fetch(`${API_BASE}/servicios`)
       ]);
 
-      setTurnos(await turnosRes.json() || []);
+      setTurnos(turnosDesdeHoy);
       setClientes(await clientesRes.json() || []);
       setEmpleados(await empleadosRes.json() || []);
       setServicios(await serviciosRes.json() || []);